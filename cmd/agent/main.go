@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -37,6 +38,109 @@ func setupRetrier(conf *agent.Config, logger logging.ILogger) utils.Retrier {
 	}
 }
 
+// newCollectors creates all the collectors known to the agent.
+func newCollectors(
+	conf *agent.Config, schedule map[string]time.Duration, logger logging.ILogger,
+) ([]entities.Collector, error) {
+	filesystems, err := adapters.NewFilter(conf.DiskIncludeFS, conf.DiskExcludeFS)
+	if err != nil {
+		return nil, fmt.Errorf("disk filesystems: %w", err)
+	}
+	devices, err := adapters.NewFilter(conf.DiskIncludeDevices, conf.DiskExcludeDevices)
+	if err != nil {
+		return nil, fmt.Errorf("disk devices: %w", err)
+	}
+	interfaces, err := adapters.NewFilter(conf.NetIncludeInterfaces, conf.NetExcludeInterfaces)
+	if err != nil {
+		return nil, fmt.Errorf("network interfaces: %w", err)
+	}
+	processes, err := adapters.ParseProcessMatchers(conf.Processes)
+	if err != nil {
+		return nil, err
+	}
+	scripts, err := adapters.ParseScripts(conf.Scripts)
+	if err != nil {
+		return nil, err
+	}
+	targets, err := adapters.ParseScrapeTargets(conf.ScrapeTargets)
+	if err != nil {
+		return nil, err
+	}
+	probes, err := adapters.ParseProbes(conf.Probes)
+	if err != nil {
+		return nil, err
+	}
+	probeTimeout := time.Duration(conf.ProbeTimeout) * time.Second
+	if conf.CollectorEnabled(adapters.ProbeCollectorName) {
+		probeInterval := conf.CollectorInterval(schedule, adapters.ProbeCollectorName)
+		err := adapters.CheckProbeInterval(probes, probeTimeout, int(conf.ProbeConcurrency), probeInterval)
+		if err != nil {
+			return nil, err
+		}
+	}
+	logFiles, err := adapters.ParseLogFiles(conf.LogFiles)
+	if err != nil {
+		return nil, err
+	}
+	logPatterns, err := adapters.ParseLogPatterns(conf.LogPatterns)
+	if err != nil {
+		return nil, err
+	}
+	logTail, err := adapters.NewLogTailCollector(logFiles, logPatterns, conf.LogOffsetsPath, logger)
+	if err != nil {
+		return nil, err
+	}
+	return []entities.Collector{
+		adapters.NewRuntimeCollector(),
+		adapters.NewMemoryCollector(),
+		adapters.NewCPUCollector(),
+		adapters.NewDiskCollector(filesystems, devices, logger),
+		adapters.NewNetCollector(interfaces),
+		adapters.NewProcessCollector(processes, logger),
+		adapters.NewCgroupCollector(conf.CgroupRoot),
+		adapters.NewHostCollector(logger),
+		adapters.NewExecCollector(scripts, time.Duration(conf.ScriptTimeout)*time.Second, logger),
+		adapters.NewScrapeCollector(targets, logger),
+		adapters.NewProbeCollector(probes, probeTimeout, int(conf.ProbeConcurrency), logger),
+		logTail,
+	}, nil
+}
+
+// setupCollectors registers the enabled collectors in the poller with their configured intervals.
+func setupCollectors(conf *agent.Config, poller *poll.Poller, logger logging.ILogger) error {
+	schedule, err := conf.CollectorSchedule()
+	if err != nil {
+		return err
+	}
+	collectors, err := newCollectors(conf, schedule, logger)
+	if err != nil {
+		return err
+	}
+	known := make(map[string]bool, len(collectors))
+	for _, collector := range collectors {
+		name := collector.Name()
+		known[name] = true
+		if !conf.CollectorEnabled(name) {
+			logger.Infof("Collector %s is disabled\n", name)
+			continue
+		}
+		if err := poller.Register(collector, conf.CollectorInterval(schedule, name)); err != nil {
+			return fmt.Errorf("%w: %s", err, name)
+		}
+	}
+	for name := range schedule {
+		if !known[name] {
+			return fmt.Errorf("unknown collector %q", name)
+		}
+	}
+	for _, name := range strings.Split(conf.DisabledCollectors, ",") {
+		if name = strings.TrimSpace(name); name != "" && !known[name] {
+			return fmt.Errorf("unknown disabled collector %q", name)
+		}
+	}
+	return nil
+}
+
 // main is the entry function of the application. It sets up logging, configuration,
 // data reporting, and polling mechanisms. It orchestrates the agent's lifecycle,
 // including handling graceful shutdowns.
@@ -71,11 +175,15 @@ func main() {
 		),
 	}
 	poller := poll.Poller{
-		Logger:    logger,
-		PollCount: 0,
-		Data:      &dataExchange,
-		Ticker:    time.NewTicker(time.Duration(conf.PollInterval) * time.Second),
-		Done:      done,
+		Logger:       logger,
+		PollCount:    0,
+		Data:         &dataExchange,
+		Ticker:       time.NewTicker(time.Duration(conf.PollInterval) * time.Second),
+		PollInterval: time.Duration(conf.PollInterval) * time.Second,
+		Done:         done,
+	}
+	if err := setupCollectors(conf, &poller, logger); err != nil {
+		logger.Fatal(err)
 	}
 	go reporter.Report()
 	go poller.Poll()
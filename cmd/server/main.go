@@ -8,6 +8,7 @@ import (
 	"crypto/rsa"
 	"errors"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -75,31 +76,100 @@ func setupRetrier(conf *server.Config, logger logging.ILogger) utils.Retrier {
 	}
 }
 
-// setupKeeper initializes and returns the appropriate Keeper (database or file) based on configuration.
-// It configures the storage mechanism for the server, handling data persistence.
+// setupKeeper initializes and returns the appropriate Keeper (database, embedded databases or file)
+// based on configuration. It configures the storage mechanism for the server, handling data persistence.
 func setupKeeper(conf *server.Config, logger logging.ILogger, retrier utils.Retrier) entities.Keeper {
-	if conf.Flushes() {
-		if conf.DatabaseDSN != "" {
-			db := adapters.OpenDB(conf.DatabaseDSN)
-			return adapters.NewDBKeeper(db, logger, retrier)
-		} else {
-			return adapters.NewFileKeeper(conf, logger, retrier)
-		}
+	kind, location, _ := conf.Storage() // validated by InitConfig
+	switch kind {
+	case server.StoragePostgres:
+		db := adapters.OpenDB(location)
+		return adapters.NewDBKeeper(db, logger, retrier)
+	case server.StorageSQLite:
+		db := adapters.OpenSQLite(location)
+		return adapters.NewSQLiteKeeper(db, logger, retrier)
+	case server.StorageBolt:
+		db := adapters.OpenBolt(location)
+		return adapters.NewBoltKeeper(db, logger)
+	case server.StorageFile:
+		return adapters.NewFileKeeper(conf, logger, retrier)
+	default:
+		return nil
 	}
-	return nil
+}
+
+// setupWAL opens the write-ahead log if the server is configured to use it.
+// Returns nil otherwise.
+func setupWAL(conf *server.Config, logger logging.ILogger) *adapters.WAL {
+	if !conf.UsesWAL() {
+		return nil
+	}
+	wal, err := adapters.OpenWAL(conf.WALPath, logger)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	return wal
 }
 
 // setupTicker creates and returns a ticker channel based on the configuration.
-// It's used for periodic operations like data flushing.
+// It's used for periodic operations like data flushing. Returns nil if data is flushed synchronously.
 func setupTicker(conf *server.Config) <-chan time.Time {
 	if conf.FlushesSync() {
-		return make(chan time.Time) // will never be used
+		return nil
 	} else {
-		ticker := time.NewTicker(time.Duration(conf.StoreInterval) * time.Second)
+		ticker := time.NewTicker(conf.FlushInterval())
 		return ticker.C
 	}
 }
 
+// setupPersistence restores the in-memory state from the Keeper and the WAL, if configured,
+// and launches the periodic flushes.
+func setupPersistence(
+	conf *server.Config, storage entities.Storage, keeper entities.Keeper, wal *adapters.WAL, logger logging.ILogger,
+) {
+	if !conf.Flushes() {
+		return
+	}
+	if conf.Restore {
+		state := keeper.Restore()
+		storage.Init(state)
+		if err := storage.Replay(); err != nil {
+			logger.Fatal(err)
+		}
+	} else if err := wal.Reset(); err != nil {
+		logger.Fatal(err)
+	}
+	if !conf.FlushesSync() {
+		go storage.FlushPeriodic(context.Background())
+	}
+}
+
+// setupFederator creates the job shipping the metrics to the upstream server. The replicas sharing
+// a database keep the shipped state in it, and a standalone server keeps it in a file.
+func setupFederator(
+	conf *server.Config,
+	storage entities.Storage,
+	elector entities.Elector,
+	shipped entities.ShippedState,
+	logger logging.ILogger,
+) *adapters.Federator {
+	key, err := conf.ReadUpstreamPublicKey()
+	if err != nil {
+		logger.Fatal(err)
+	}
+	origin, err := conf.OriginName()
+	if err != nil {
+		logger.Fatal(err)
+	}
+	upstream := adapters.NewHTTPUpstream(conf.UpstreamAddr, conf.UpstreamKey, key, logger)
+	federator := adapters.NewFederator(
+		storage, upstream, elector, shipped, origin, int(conf.UpstreamBatchSize), logger,
+	)
+	if err := federator.Init(context.Background()); err != nil {
+		logger.Fatal(err)
+	}
+	return federator
+}
+
 // main is the entry function of the application. It sets up and starts the HTTP server,
 // including configuration, logging, storage, and routing. It also manages the application's lifecycle,
 // handling initialization and graceful shutdown.
@@ -113,32 +183,68 @@ func main() {
 	}
 
 	done := make(chan struct{}, 1)
-	tickerChan := setupTicker(conf)
 	retrier := setupRetrier(conf, logger)
-
-	keeper := setupKeeper(conf, logger, retrier)
-	if keeper != nil {
-		defer keeper.Shutdown()
+	tiers, err := adapters.ParseRetention(conf.HistoryRetention)
+	if err != nil {
+		logger.Fatal(err)
 	}
-	storage := adapters.NewMemStorage(done, tickerChan, logger, keeper)
+	history := adapters.NewHistory(int(conf.HistorySize), tiers)
+	hub := adapters.NewHub(logger, int(conf.StreamBufferSize))
+	staleAfter := time.Duration(conf.StaleAfter) * time.Second
+	// the base context is cancelled on shutdown, so that event streams don't hold it forever
+	// and the leadership is released
+	baseCtx, cancel := context.WithCancel(context.Background())
 
-	if conf.Flushes() {
-		if conf.Restore {
-			state := keeper.Restore()
-			storage.Init(state)
+	var storage entities.Storage
+	var elector = adapters.NewStandaloneElector()
+	var shipped entities.ShippedState // the state shipped upstream isn't persisted if nil
+	if conf.DatabaseNative {
+		_, dsn, _ := conf.Storage() // validated by InitConfig
+		db := adapters.OpenDB(dsn)
+		defer db.Close()
+		storage = adapters.NewDBStorage(db, logger, retrier, staleAfter, history, hub)
+		advisory := adapters.NewAdvisoryElector(db, conf.LeaderLockID, logger)
+		elector = advisory
+		shipped = adapters.NewDBShippedState(db, logger, retrier)
+		go advisory.Run(baseCtx, time.NewTicker(server.DefElectionInterval).C)
+	} else {
+		keeper := setupKeeper(conf, logger, retrier)
+		if keeper != nil {
+			defer keeper.Shutdown()
 		}
-		if !conf.FlushesSync() {
-			go storage.FlushPeriodic(context.Background())
+		wal := setupWAL(conf, logger)
+		defer wal.Close()
+		storage = adapters.NewMemStorage(done, setupTicker(conf), logger, keeper, staleAfter, history, hub, wal)
+		setupPersistence(conf, storage, keeper, wal, logger)
+		if conf.UpstreamStatePath != "" {
+			shipped = adapters.NewFileShippedState(conf.UpstreamStatePath)
 		}
 	}
 
-	controller := usecases.NewBaseController(logger, storage, conf.TemplatePath)
+	if conf.Federates() {
+		federator := setupFederator(conf, storage, elector, shipped, logger)
+		go federator.Run(baseCtx, time.NewTicker(time.Duration(conf.UpstreamInterval)*time.Second).C)
+	}
+
+	if conf.Evicts() {
+		ttl := time.Duration(conf.MetricTTL) * time.Second
+		go storage.EvictPeriodic(context.Background(), elector.Gate(baseCtx, time.NewTicker(ttl).C), ttl)
+	}
+
+	go storage.CompactPeriodic(context.Background(), time.NewTicker(history.CompactInterval()).C)
+
+	controller := usecases.NewBaseController(logger, storage, elector, conf.HMACKey)
 	key, err := conf.ReadPrivateKey()
 	if err != nil {
 		panic(err)
 	}
 	r := setupServer(logger, controller, conf.HMACKey, key)
-	srv := http.Server{Addr: conf.Addr, Handler: r}
+	srv := http.Server{
+		Addr:        conf.Addr,
+		Handler:     r,
+		BaseContext: func(net.Listener) context.Context { return baseCtx },
+	}
+	srv.RegisterOnShutdown(cancel)
 	go func() {
 		logger.Infof("Launching the server at %s\n", conf.Addr)
 		if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
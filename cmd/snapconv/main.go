@@ -0,0 +1,57 @@
+// Package main is the entry point for the snapshot converter. It converts the storage
+// files of the server between the snapshot formats, e.g. from JSON to gob and back.
+// The format of the input file is detected automatically.
+//
+// Usage:
+//
+//	snapconv -in /tmp/metrics-db.json -out /tmp/metrics-db.gob -format gob
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/matthiasBT/monitoring/internal/infra/config/server"
+	"github.com/matthiasBT/monitoring/internal/server/adapters"
+)
+
+// convert reads the snapshot from the input file and writes it to the output file in the given format.
+// It returns the number of converted metrics and an error, if any.
+func convert(in, out, format string) (int, error) {
+	data, err := os.ReadFile(in)
+	if err != nil {
+		return 0, err
+	}
+	metrics, err := adapters.DecodeSnapshot(data)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s snapshot: %w", adapters.SnapshotFormat(data), err)
+	}
+	result, err := adapters.EncodeSnapshot(metrics, format)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.WriteFile(out, result, 0666); err != nil {
+		return 0, err
+	}
+	return len(metrics), nil
+}
+
+// main parses the command line flags and runs the conversion.
+func main() {
+	in := flag.String("in", "", "Path to the input snapshot")
+	out := flag.String("out", "", "Path to the output snapshot")
+	format := flag.String("format", server.StoreFormatGob, "Format of the output snapshot: json or gob")
+	flag.Parse()
+	if *in == "" || *out == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	count, err := convert(*in, *out, *format)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Converted %d metrics to %s\n", count, *format)
+}
@@ -17,8 +17,8 @@ import (
 func Example() {
 	logger := logging.SetupLogger()
 	logger.SetLevel(logrus.FatalLevel) // to avoid printing unnecessary logs
-	storage := adapters.NewMemStorage(nil, nil, logger, nil)
-	controller := usecases.NewBaseController(logger, storage, "/")
+	storage := adapters.NewMemStorage(nil, nil, logger, nil, 0, adapters.NewHistory(10, nil), nil, nil)
+	controller := usecases.NewBaseController(logger, storage, nil, "")
 
 	ping(controller)
 	updateCounter(100500, controller)
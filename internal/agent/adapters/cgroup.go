@@ -0,0 +1,187 @@
+// Package adapters provides the collector of the resource usage and limits of the cgroup
+// (e.g. the container) the agent runs in.
+package adapters
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/matthiasBT/monitoring/internal/agent/entities"
+)
+
+const (
+	// CgroupCollectorName is the name of the CgroupCollector in the configuration.
+	CgroupCollectorName = "cgroup"
+
+	// cgroupUnlimited is the lower bound of the values meaning "no limit" in cgroup v1, which are
+	// the maximal int64 rounded down to the page size
+	cgroupUnlimited = 1 << 62
+)
+
+// ErrNoCgroup is returned when the cgroup filesystem isn't mounted, e.g. on macOS.
+var ErrNoCgroup = errors.New("cgroup filesystem not found")
+
+// CgroupCollector reports the memory, CPU and PID usage and limits of a cgroup. Unlike the host-wide
+// collectors, it reflects the resources of the container the agent runs in. Both the unified hierarchy
+// of cgroup v2 and the per-controller hierarchies of cgroup v1 are supported. The CPU usage and
+// throttling counters are reported as increments since the previous collection, in microseconds.
+// The metrics of the controllers which aren't enabled and the limits which aren't set are skipped.
+type CgroupCollector struct {
+	FS       fs.FS         // Cgroup filesystem, like /sys/fs/cgroup
+	Counters *DeltaTracker // Converts the CPU counters to increments
+}
+
+// NewCgroupCollector creates and returns a new CgroupCollector reading the cgroup filesystem at the root.
+func NewCgroupCollector(root string) entities.Collector {
+	return &CgroupCollector{FS: os.DirFS(root), Counters: NewDeltaTracker()}
+}
+
+// Name returns the name of the collector.
+func (c *CgroupCollector) Name() string {
+	return CgroupCollectorName
+}
+
+// Collect reads the cgroup files. Returns ErrNoCgroup if there is no cgroup filesystem at the root.
+func (c *CgroupCollector) Collect(ctx context.Context) (*entities.Snapshot, error) {
+	gauges := make(map[string]float64)
+	counters := make(map[string]uint64)
+	var version string
+	switch {
+	case c.exists("cgroup.controllers"):
+		version = "v2"
+		c.collectV2(gauges, counters)
+	case c.exists("memory") || c.exists("cpu") || c.exists("pids"):
+		version = "v1"
+		c.collectV1(gauges, counters)
+	default:
+		return nil, ErrNoCgroup
+	}
+	snapshot := entities.NewSnapshot()
+	labels := map[string]string{"cgroup_version": version}
+	for name, value := range gauges {
+		snapshot.Gauges[name] = value
+		snapshot.Labels[name] = labels
+	}
+	for name, value := range counters {
+		snapshot.Counters[name] = c.Counters.Delta(name, value)
+		snapshot.Labels[name] = labels
+	}
+	return snapshot, nil
+}
+
+// collectV2 reads the files of the unified hierarchy
+func (c *CgroupCollector) collectV2(gauges map[string]float64, counters map[string]uint64) {
+	c.readValue("memory.current", "CgroupMemoryUsage", gauges)
+	c.readValue("memory.max", "CgroupMemoryLimit", gauges)
+	c.readValue("pids.current", "CgroupPids", gauges)
+	c.readValue("pids.max", "CgroupPidsLimit", gauges)
+	if fields, err := c.readFields("cpu.max"); err == nil && len(fields) == 2 {
+		// the quota is "max" if there is no limit
+		setCPULimit(fields[0], fields[1], gauges)
+	}
+	stat := c.readStat("cpu.stat")
+	for key, name := range map[string]string{
+		"usage_usec":     "CgroupCPUUsageUsec",
+		"nr_periods":     "CgroupCPUPeriods",
+		"nr_throttled":   "CgroupCPUThrottledPeriods",
+		"throttled_usec": "CgroupCPUThrottledUsec",
+	} {
+		if value, ok := stat[key]; ok {
+			counters[name] = value
+		}
+	}
+}
+
+// collectV1 reads the files of the per-controller hierarchies, converting nanoseconds to microseconds
+func (c *CgroupCollector) collectV1(gauges map[string]float64, counters map[string]uint64) {
+	c.readValue("memory/memory.usage_in_bytes", "CgroupMemoryUsage", gauges)
+	c.readValue("memory/memory.limit_in_bytes", "CgroupMemoryLimit", gauges)
+	if limit, ok := gauges["CgroupMemoryLimit"]; ok && limit >= cgroupUnlimited {
+		delete(gauges, "CgroupMemoryLimit")
+	}
+	c.readValue("pids/pids.current", "CgroupPids", gauges)
+	c.readValue("pids/pids.max", "CgroupPidsLimit", gauges)
+	quota, errQuota := c.readFields("cpu/cpu.cfs_quota_us")
+	period, errPeriod := c.readFields("cpu/cpu.cfs_period_us")
+	if errQuota == nil && errPeriod == nil && len(quota) == 1 && len(period) == 1 {
+		// the quota is -1 if there is no limit
+		setCPULimit(quota[0], period[0], gauges)
+	}
+	if usage, err := c.readFields("cpuacct/cpuacct.usage"); err == nil && len(usage) == 1 {
+		if value, err := strconv.ParseUint(usage[0], 10, 64); err == nil {
+			counters["CgroupCPUUsageUsec"] = value / 1000
+		}
+	}
+	stat := c.readStat("cpu/cpu.stat")
+	if value, ok := stat["nr_periods"]; ok {
+		counters["CgroupCPUPeriods"] = value
+	}
+	if value, ok := stat["nr_throttled"]; ok {
+		counters["CgroupCPUThrottledPeriods"] = value
+	}
+	if value, ok := stat["throttled_time"]; ok {
+		counters["CgroupCPUThrottledUsec"] = value / 1000
+	}
+}
+
+// exists checks whether the file or directory exists
+func (c *CgroupCollector) exists(path string) bool {
+	_, err := fs.Stat(c.FS, path)
+	return err == nil
+}
+
+// readFields reads a single-line file and splits it into fields
+func (c *CgroupCollector) readFields(path string) ([]string, error) {
+	raw, err := fs.ReadFile(c.FS, path)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(raw)), nil
+}
+
+// readValue reads a file with a single number into the metric. Missing files and values
+// which aren't numbers, like "max" meaning no limit, are skipped.
+func (c *CgroupCollector) readValue(path, name string, values map[string]float64) {
+	fields, err := c.readFields(path)
+	if err != nil || len(fields) != 1 {
+		return
+	}
+	if value, err := strconv.ParseUint(fields[0], 10, 64); err == nil {
+		values[name] = float64(value)
+	}
+}
+
+// setCPULimit converts the CPU quota and period to the number of CPUs. Quotas which aren't
+// positive numbers mean no limit and are skipped.
+func setCPULimit(quota, period string, gauges map[string]float64) {
+	quotaValue, errQuota := strconv.ParseUint(quota, 10, 64)
+	periodValue, errPeriod := strconv.ParseUint(period, 10, 64)
+	if errQuota == nil && errPeriod == nil && periodValue > 0 {
+		gauges["CgroupCPULimit"] = float64(quotaValue) / float64(periodValue)
+	}
+}
+
+// readStat reads a file of "key value" lines, like cpu.stat
+func (c *CgroupCollector) readStat(path string) map[string]uint64 {
+	stat := make(map[string]uint64)
+	raw, err := fs.ReadFile(c.FS, path)
+	if err != nil {
+		return stat
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	for scanner.Scan() {
+		var key string
+		var value uint64
+		if _, err := fmt.Sscanf(scanner.Text(), "%s %d", &key, &value); err == nil {
+			stat[key] = value
+		}
+	}
+	return stat
+}
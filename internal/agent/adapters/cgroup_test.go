@@ -0,0 +1,95 @@
+package adapters
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCgroupCollector_Collect(t *testing.T) {
+	tests := []struct {
+		name         string
+		files        fstest.MapFS
+		wantGauges   map[string]float64
+		wantCounters map[string]int64
+		wantVersion  string
+	}{
+		{
+			name: "cgroup v2",
+			files: fstest.MapFS{
+				"cgroup.controllers": {Data: []byte("cpu memory pids\n")},
+				"memory.current":     {Data: []byte("104857600\n")},
+				"memory.max":         {Data: []byte("268435456\n")},
+				"pids.current":       {Data: []byte("12\n")},
+				"pids.max":           {Data: []byte("max\n")},
+				"cpu.max":            {Data: []byte("150000 100000\n")},
+				"cpu.stat": {Data: []byte("usage_usec 5000\nuser_usec 4000\nsystem_usec 1000\n" +
+					"nr_periods 10\nnr_throttled 2\nthrottled_usec 300\n")},
+			},
+			wantGauges: map[string]float64{
+				"CgroupMemoryUsage": 104857600,
+				"CgroupMemoryLimit": 268435456,
+				"CgroupPids":        12,
+				"CgroupCPULimit":    1.5,
+			},
+			wantCounters: map[string]int64{
+				"CgroupCPUUsageUsec":        1000,
+				"CgroupCPUPeriods":          1,
+				"CgroupCPUThrottledPeriods": 1,
+				"CgroupCPUThrottledUsec":    100,
+			},
+			wantVersion: "v2",
+		},
+		{
+			name: "cgroup v1 without limits",
+			files: fstest.MapFS{
+				"memory/memory.usage_in_bytes": {Data: []byte("104857600\n")},
+				"memory/memory.limit_in_bytes": {Data: []byte("9223372036854771712\n")},
+				"cpu/cpu.cfs_quota_us":         {Data: []byte("-1\n")},
+				"cpu/cpu.cfs_period_us":        {Data: []byte("100000\n")},
+				"cpu/cpu.stat":                 {Data: []byte("nr_periods 10\nnr_throttled 2\nthrottled_time 300000\n")},
+				"cpuacct/cpuacct.usage":        {Data: []byte("5000000\n")},
+			},
+			wantGauges: map[string]float64{
+				"CgroupMemoryUsage": 104857600,
+			},
+			wantCounters: map[string]int64{
+				"CgroupCPUUsageUsec":        1000,
+				"CgroupCPUPeriods":          1,
+				"CgroupCPUThrottledPeriods": 1,
+				"CgroupCPUThrottledUsec":    100,
+			},
+			wantVersion: "v1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			collector := &CgroupCollector{FS: tt.files, Counters: NewDeltaTracker()}
+			if _, err := collector.Collect(context.Background()); err != nil {
+				t.Fatalf("Collect() error = %v", err)
+			}
+			// the CPU time grows by 1 ms, with 1 more period of which 1 is throttled for 0.1 ms
+			for path, file := range tt.files {
+				switch path {
+				case "cpu.stat":
+					file.Data = []byte("usage_usec 6000\nnr_periods 11\nnr_throttled 3\nthrottled_usec 400\n")
+				case "cpu/cpu.stat":
+					file.Data = []byte("nr_periods 11\nnr_throttled 3\nthrottled_time 400000\n")
+				case "cpuacct/cpuacct.usage":
+					file.Data = []byte("6000000\n")
+				}
+			}
+			snapshot, err := collector.Collect(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantGauges, snapshot.Gauges)
+			assert.Equal(t, tt.wantCounters, snapshot.Counters)
+			assert.Equal(t, map[string]string{"cgroup_version": tt.wantVersion}, snapshot.Labels["CgroupMemoryUsage"])
+		})
+	}
+
+	collector := &CgroupCollector{FS: fstest.MapFS{}, Counters: NewDeltaTracker()}
+	_, err := collector.Collect(context.Background())
+	assert.ErrorIs(t, err, ErrNoCgroup)
+}
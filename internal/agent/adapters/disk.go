@@ -0,0 +1,108 @@
+// Package adapters provides the collector of the disk usage and I/O statistics of the host.
+package adapters
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/matthiasBT/monitoring/internal/agent/entities"
+	"github.com/matthiasBT/monitoring/internal/infra/logging"
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+// DiskCollectorName is the name of the DiskCollector in the configuration.
+const DiskCollectorName = "disk"
+
+// DiskCollector reports the usage of every mounted filesystem and the I/O counters of every block device.
+// The usage gauges are named after the mountpoints, e.g. DiskUsed_var_lib, and the I/O counters after
+// the devices, e.g. DiskReadBytes_sda. The I/O counters are reported as increments since the previous
+// collection.
+type DiskCollector struct {
+	Filesystems *Filter         // Selects filesystems by mountpoint, type or device
+	Devices     *Filter         // Selects block devices by name
+	Counters    *DeltaTracker   // Converts the I/O counters to increments
+	Logger      logging.ILogger // Logger for logging activities
+
+	// Partitions, Usage and IOCounters read the disk statistics, they are replaced in tests
+	Partitions func(ctx context.Context, all bool) ([]disk.PartitionStat, error)
+	Usage      func(ctx context.Context, path string) (*disk.UsageStat, error)
+	IOCounters func(ctx context.Context, names ...string) (map[string]disk.IOCountersStat, error)
+}
+
+// NewDiskCollector creates and returns a new DiskCollector.
+func NewDiskCollector(filesystems, devices *Filter, logger logging.ILogger) entities.Collector {
+	return &DiskCollector{
+		Filesystems: filesystems,
+		Devices:     devices,
+		Counters:    NewDeltaTracker(),
+		Logger:      logger,
+		Partitions:  disk.PartitionsWithContext,
+		Usage:       disk.UsageWithContext,
+		IOCounters:  disk.IOCountersWithContext,
+	}
+}
+
+// Name returns the name of the collector.
+func (c *DiskCollector) Name() string {
+	return DiskCollectorName
+}
+
+// Collect reads the usage of the filesystems and the I/O counters of the devices. A filesystem
+// which can't be read, e.g. an unavailable network share, is skipped.
+func (c *DiskCollector) Collect(ctx context.Context) (*entities.Snapshot, error) {
+	partitions, err := c.Partitions(ctx, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list partitions: %w", err)
+	}
+	snapshot := entities.NewSnapshot()
+	for _, partition := range partitions {
+		if !c.Filesystems.Match(partition.Mountpoint, partition.Fstype, partition.Device) {
+			continue
+		}
+		usage, err := c.Usage(ctx, partition.Mountpoint)
+		if err != nil {
+			c.Logger.Errorf("Failed to get the usage of %s: %v\n", partition.Mountpoint, err.Error())
+			continue
+		}
+		suffix := metricSuffix(partition.Mountpoint)
+		labels := map[string]string{
+			"mountpoint": partition.Mountpoint,
+			"fstype":     partition.Fstype,
+			"device":     partition.Device,
+		}
+		for name, value := range map[string]uint64{
+			"DiskTotal":       usage.Total,
+			"DiskUsed":        usage.Used,
+			"DiskFree":        usage.Free,
+			"DiskInodesTotal": usage.InodesTotal,
+			"DiskInodesUsed":  usage.InodesUsed,
+			"DiskInodesFree":  usage.InodesFree,
+		} {
+			snapshot.Gauges[name+"_"+suffix] = float64(value)
+			snapshot.Labels[name+"_"+suffix] = labels
+		}
+	}
+
+	counters, err := c.IOCounters(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get I/O counters: %w", err)
+	}
+	for device, stat := range counters {
+		if !c.Devices.Match(device) {
+			continue
+		}
+		suffix := metricSuffix(device)
+		labels := map[string]string{"device": device}
+		for name, value := range map[string]uint64{
+			"DiskReadBytes":  stat.ReadBytes,
+			"DiskWriteBytes": stat.WriteBytes,
+			"DiskReadOps":    stat.ReadCount,
+			"DiskWriteOps":   stat.WriteCount,
+			"DiskIOTimeMs":   stat.IoTime,
+		} {
+			snapshot.Counters[name+"_"+suffix] = c.Counters.Delta(name+"_"+suffix, value)
+			snapshot.Labels[name+"_"+suffix] = labels
+		}
+	}
+	return snapshot, nil
+}
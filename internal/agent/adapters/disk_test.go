@@ -0,0 +1,64 @@
+package adapters
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/matthiasBT/monitoring/internal/infra/logging"
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiskCollector_Collect(t *testing.T) {
+	filesystems, _ := NewFilter("", "^/boot")
+	devices, _ := NewFilter("", `^loop\d+$`)
+	collector := NewDiskCollector(filesystems, devices, logging.SetupLogger()).(*DiskCollector)
+	collector.Partitions = func(ctx context.Context, all bool) ([]disk.PartitionStat, error) {
+		return []disk.PartitionStat{
+			{Device: "/dev/sda1", Mountpoint: "/", Fstype: "ext4"},
+			{Device: "/dev/sda2", Mountpoint: "/boot", Fstype: "vfat"},
+			{Device: "server:/share", Mountpoint: "/mnt/share", Fstype: "nfs"},
+		}, nil
+	}
+	collector.Usage = func(ctx context.Context, path string) (*disk.UsageStat, error) {
+		if path == "/mnt/share" {
+			return nil, errors.New("stale file handle")
+		}
+		return &disk.UsageStat{Total: 100, Used: 40, Free: 60, InodesTotal: 10, InodesUsed: 3, InodesFree: 7}, nil
+	}
+	readBytes := uint64(1000)
+	collector.IOCounters = func(ctx context.Context, names ...string) (map[string]disk.IOCountersStat, error) {
+		return map[string]disk.IOCountersStat{
+			"sda":   {ReadBytes: readBytes, WriteBytes: 500, ReadCount: 10, WriteCount: 5, IoTime: 20},
+			"loop0": {ReadBytes: 1},
+		}, nil
+	}
+
+	snapshot, err := collector.Collect(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]float64{
+		"DiskTotal_root":       100,
+		"DiskUsed_root":        40,
+		"DiskFree_root":        60,
+		"DiskInodesTotal_root": 10,
+		"DiskInodesUsed_root":  3,
+		"DiskInodesFree_root":  7,
+	}, snapshot.Gauges, "Excluded and unreadable filesystems must be skipped")
+	assert.Equal(t, map[string]string{"mountpoint": "/", "fstype": "ext4", "device": "/dev/sda1"},
+		snapshot.Labels["DiskUsed_root"])
+	assert.Equal(t, map[string]int64{
+		"DiskReadBytes_sda":  0,
+		"DiskWriteBytes_sda": 0,
+		"DiskReadOps_sda":    0,
+		"DiskWriteOps_sda":   0,
+		"DiskIOTimeMs_sda":   0,
+	}, snapshot.Counters, "The first collection must report no I/O")
+
+	readBytes = 4000
+	snapshot, err = collector.Collect(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3000), snapshot.Counters["DiskReadBytes_sda"])
+	assert.Equal(t, int64(0), snapshot.Counters["DiskWriteBytes_sda"])
+	assert.Equal(t, map[string]string{"device": "sda"}, snapshot.Labels["DiskReadBytes_sda"])
+}
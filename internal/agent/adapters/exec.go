@@ -0,0 +1,246 @@
+// Package adapters provides the collector of the custom metrics printed by the configured scripts.
+package adapters
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/matthiasBT/monitoring/internal/agent/entities"
+	common "github.com/matthiasBT/monitoring/internal/infra/entities"
+	"github.com/matthiasBT/monitoring/internal/infra/logging"
+)
+
+const (
+	// ExecCollectorName is the name of the ExecCollector in the configuration.
+	ExecCollectorName = "exec"
+
+	// ScriptLabel is the label of the metrics naming the script which printed them
+	ScriptLabel = "script"
+
+	// scriptWaitDelay limits the wait for the output of a killed script, e.g. if its children keep stdout open
+	scriptWaitDelay = time.Second
+)
+
+var (
+	// ErrInvalidScript is returned when a script is configured incorrectly.
+	ErrInvalidScript = errors.New("invalid script")
+
+	// ErrInvalidScriptOutput is returned when a script prints something other than metrics.
+	ErrInvalidScriptOutput = errors.New("invalid script output")
+)
+
+// Script is a command printing custom metrics.
+type Script struct {
+	Name    string   // Name of the script in the self-metrics and labels
+	Command []string // Executable and its arguments
+}
+
+// ParseScripts parses semicolon-separated name=command entries, like "queue=/opt/bin/queue-size --all".
+// The commands are split into arguments by whitespace and run without a shell.
+func ParseScripts(spec string) ([]*Script, error) {
+	var scripts []*Script
+	for _, entry := range strings.Split(spec, ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		name, command, ok := strings.Cut(entry, "=")
+		script := &Script{Name: strings.TrimSpace(name), Command: strings.Fields(command)}
+		if !ok || script.Name == "" || len(script.Command) == 0 {
+			return nil, fmt.Errorf("%w: %q, expected name=command", ErrInvalidScript, entry)
+		}
+		scripts = append(scripts, script)
+	}
+	return scripts, nil
+}
+
+// ExecCollector runs the scripts concurrently and reports the metrics they print to stdout, labeled with
+// the script names. A script prints either "name type value" lines, like "QueueSize gauge 12.5", or JSON
+// with a metric or an array of metrics in the format of the server API. Blank lines and lines starting
+// with # are ignored. For every script, the collector reports ScriptUp_<name>, which is 0 if the script
+// failed, timed out or printed invalid output, ScriptDuration_<name> in seconds, and the counters
+// ScriptErrors_<name> and ScriptTimeouts_<name>.
+type ExecCollector struct {
+	Scripts []*Script       // Scripts to run
+	Timeout time.Duration   // Maximal run time of a script, after which it's killed
+	Logger  logging.ILogger // Logger for logging activities
+
+	// Run runs a script and returns its stdout, it's replaced in tests
+	Run func(ctx context.Context, script *Script) ([]byte, error)
+}
+
+// NewExecCollector creates and returns a new ExecCollector.
+func NewExecCollector(scripts []*Script, timeout time.Duration, logger logging.ILogger) entities.Collector {
+	return &ExecCollector{Scripts: scripts, Timeout: timeout, Logger: logger, Run: runScript}
+}
+
+// Name returns the name of the collector.
+func (c *ExecCollector) Name() string {
+	return ExecCollectorName
+}
+
+// Collect runs the scripts. The failures of the scripts are reported as self-metrics, not as errors.
+func (c *ExecCollector) Collect(ctx context.Context) (*entities.Snapshot, error) {
+	results := make([]*entities.Snapshot, len(c.Scripts))
+	var wg sync.WaitGroup
+	for idx, script := range c.Scripts {
+		wg.Add(1)
+		go func(idx int, script *Script) {
+			defer wg.Done()
+			results[idx] = c.collectScript(ctx, script)
+		}(idx, script)
+	}
+	wg.Wait()
+	snapshot := entities.NewSnapshot()
+	for _, result := range results {
+		snapshot.Merge(result)
+	}
+	return snapshot, nil
+}
+
+// collectScript runs a single script and parses its output
+func (c *ExecCollector) collectScript(ctx context.Context, script *Script) *entities.Snapshot {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+	start := time.Now()
+	output, err := c.Run(ctx, script)
+	duration := time.Since(start)
+
+	var snapshot *entities.Snapshot
+	var timeouts, errs int64
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		c.Logger.Errorf("Script %s timed out after %v\n", script.Name, c.Timeout)
+		timeouts = 1
+	case err != nil:
+		c.Logger.Errorf("Script %s failed: %v\n", script.Name, err.Error())
+		errs = 1
+	default:
+		if snapshot, err = parseScriptOutput(output, script.Name); err != nil {
+			c.Logger.Errorf("Script %s printed invalid output: %v\n", script.Name, err.Error())
+			errs = 1
+		}
+	}
+	if snapshot == nil {
+		snapshot = entities.NewSnapshot()
+	}
+
+	suffix := metricSuffix(script.Name)
+	labels := map[string]string{ScriptLabel: script.Name}
+	up := 0.0
+	if timeouts == 0 && errs == 0 {
+		up = 1
+	}
+	snapshot.Gauges["ScriptUp_"+suffix] = up
+	snapshot.Gauges["ScriptDuration_"+suffix] = duration.Seconds()
+	snapshot.Counters["ScriptErrors_"+suffix] = errs
+	snapshot.Counters["ScriptTimeouts_"+suffix] = timeouts
+	for _, name := range []string{"ScriptUp_", "ScriptDuration_", "ScriptErrors_", "ScriptTimeouts_"} {
+		snapshot.Labels[name+suffix] = labels
+	}
+	return snapshot
+}
+
+// parseScriptOutput parses the metrics printed by a script, adding the script label to them
+func parseScriptOutput(output []byte, scriptName string) (*entities.Snapshot, error) {
+	var batch []*common.Metrics
+	var err error
+	trimmed := bytes.TrimSpace(output)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		err = json.Unmarshal(trimmed, &batch)
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		metrics := new(common.Metrics)
+		err = json.Unmarshal(trimmed, metrics)
+		batch = append(batch, metrics)
+	default:
+		batch, err = parseScriptLines(trimmed)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidScriptOutput, err.Error())
+	}
+
+	snapshot := entities.NewSnapshot()
+	for _, metrics := range batch {
+		if err := metrics.Validate(true); err != nil {
+			return nil, fmt.Errorf("%w: metric %q: %s", ErrInvalidScriptOutput, metrics.ID, err.Error())
+		}
+		labels := make(map[string]string, len(metrics.Labels)+1)
+		for name, value := range metrics.Labels {
+			labels[name] = value
+		}
+		if _, ok := labels[ScriptLabel]; !ok {
+			labels[ScriptLabel] = scriptName
+		}
+		if metrics.MType == common.TypeGauge {
+			snapshot.Gauges[metrics.ID] = *metrics.Value
+		} else {
+			snapshot.Counters[metrics.ID] = *metrics.Delta
+		}
+		snapshot.Labels[metrics.ID] = labels
+	}
+	return snapshot, nil
+}
+
+// parseScriptLines parses "name type value" lines
+func parseScriptLines(output []byte) ([]*common.Metrics, error) {
+	var batch []*common.Metrics
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("line %q, expected name type value", line)
+		}
+		metrics := &common.Metrics{ID: fields[0], MType: fields[1]}
+		switch metrics.MType {
+		case common.TypeGauge:
+			value, err := strconv.ParseFloat(fields[2], 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %q: %w", line, err)
+			}
+			metrics.Value = &value
+		case common.TypeCounter:
+			delta, err := strconv.ParseInt(fields[2], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %q: %w", line, err)
+			}
+			metrics.Delta = &delta
+		default:
+			return nil, fmt.Errorf("line %q: %w", line, common.ErrInvalidMetricType)
+		}
+		batch = append(batch, metrics)
+	}
+	return batch, scanner.Err()
+}
+
+// runScript runs the command and returns its stdout. If it fails, the error includes the beginning of stderr.
+func runScript(ctx context.Context, script *Script) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, script.Command[0], script.Command[1:]...)
+	cmd.WaitDelay = scriptWaitDelay
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if len(message) > 200 {
+			message = message[:200]
+		}
+		if message != "" {
+			return nil, fmt.Errorf("%w: %s", err, message)
+		}
+		return nil, err
+	}
+	return output, nil
+}
@@ -0,0 +1,111 @@
+package adapters
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/matthiasBT/monitoring/internal/infra/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseScripts(t *testing.T) {
+	scripts, err := ParseScripts("queue=/opt/bin/queue-size --all; backup=/opt/bin/backup-age;")
+	assert.NoError(t, err)
+	assert.Equal(t, []*Script{
+		{Name: "queue", Command: []string{"/opt/bin/queue-size", "--all"}},
+		{Name: "backup", Command: []string{"/opt/bin/backup-age"}},
+	}, scripts)
+	for _, invalid := range []string{"/opt/bin/queue-size", "queue=", "=/opt/bin/queue-size"} {
+		_, err := ParseScripts(invalid)
+		assert.ErrorIs(t, err, ErrInvalidScript, invalid)
+	}
+}
+
+func TestParseScriptOutput(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		wantG   map[string]float64
+		wantC   map[string]int64
+		wantErr bool
+	}{
+		{
+			name:   "lines",
+			output: "# queue statistics\nQueueSize gauge 12.5\n\nQueueProcessed counter 3\n",
+			wantG:  map[string]float64{"QueueSize": 12.5},
+			wantC:  map[string]int64{"QueueProcessed": 3},
+		},
+		{
+			name:   "JSON array",
+			output: `[{"id":"QueueSize","type":"gauge","value":12.5},{"id":"QueueProcessed","type":"counter","delta":3}]`,
+			wantG:  map[string]float64{"QueueSize": 12.5},
+			wantC:  map[string]int64{"QueueProcessed": 3},
+		},
+		{
+			name:   "JSON object",
+			output: `{"id":"QueueSize","type":"gauge","value":12.5}`,
+			wantG:  map[string]float64{"QueueSize": 12.5},
+			wantC:  map[string]int64{},
+		},
+		{name: "unknown type", output: "QueueSize histogram 12.5", wantErr: true},
+		{name: "invalid value", output: "QueueProcessed counter 1.5", wantErr: true},
+		{name: "missing value", output: "QueueSize gauge", wantErr: true},
+		{name: "JSON without value", output: `{"id":"QueueSize","type":"gauge"}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snapshot, err := parseScriptOutput([]byte(tt.output), "queue")
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidScriptOutput)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantG, snapshot.Gauges)
+			assert.Equal(t, tt.wantC, snapshot.Counters)
+			assert.Equal(t, map[string]string{ScriptLabel: "queue"}, snapshot.Labels["QueueSize"])
+		})
+	}
+}
+
+func TestExecCollector_Collect(t *testing.T) {
+	dir := t.TempDir()
+	scriptPath := filepath.Join(dir, "queue.sh")
+	if err := os.WriteFile(scriptPath, []byte("#!/bin/sh\necho QueueSize gauge 12.5\n"), 0o700); err != nil {
+		t.Fatalf("Failed to write the script: %v", err)
+	}
+	scripts := []*Script{
+		{Name: "queue", Command: []string{scriptPath}},
+		{Name: "broken", Command: []string{filepath.Join(dir, "missing.sh")}},
+		{Name: "slow", Command: []string{"sleep", "10"}},
+	}
+	collector := NewExecCollector(scripts, 200*time.Millisecond, logging.SetupLogger())
+
+	start := time.Now()
+	snapshot, err := collector.Collect(context.Background())
+	assert.NoError(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second, "A script running for too long must be killed")
+	assert.Equal(t, 12.5, snapshot.Gauges["QueueSize"])
+	assert.Equal(t, 1.0, snapshot.Gauges["ScriptUp_queue"])
+	assert.Equal(t, 0.0, snapshot.Gauges["ScriptUp_broken"])
+	assert.Equal(t, 0.0, snapshot.Gauges["ScriptUp_slow"])
+	assert.Equal(t, map[string]int64{
+		"ScriptErrors_queue":    0,
+		"ScriptTimeouts_queue":  0,
+		"ScriptErrors_broken":   1,
+		"ScriptTimeouts_broken": 0,
+		"ScriptErrors_slow":     0,
+		"ScriptTimeouts_slow":   1,
+	}, snapshot.Counters)
+	assert.Equal(t, map[string]string{ScriptLabel: "slow"}, snapshot.Labels["ScriptTimeouts_slow"])
+
+	collector.(*ExecCollector).Run = func(ctx context.Context, script *Script) ([]byte, error) {
+		return nil, errors.New("fake error")
+	}
+	snapshot, err = collector.Collect(context.Background())
+	assert.NoError(t, err, "Failed scripts must not fail the collector")
+	assert.NotContains(t, snapshot.Gauges, "QueueSize")
+}
@@ -0,0 +1,161 @@
+// Package adapters provides the collector of the load average, uptime and static information of the host.
+package adapters
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/matthiasBT/monitoring/internal/agent/entities"
+	"github.com/matthiasBT/monitoring/internal/infra/logging"
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/host"
+	"github.com/shirou/gopsutil/v3/load"
+)
+
+// HostCollectorName is the name of the HostCollector in the configuration.
+const HostCollectorName = "host"
+
+// ErrNoInterrupts is returned when /proc/stat has no interrupt counter.
+var ErrNoInterrupts = errors.New("no interrupt counter in /proc/stat")
+
+// HostCollector reports the load average, uptime, boot time, number of logged-in users and the context
+// switches and interrupts since the previous collection. The static information about the host, like
+// the kernel version and the CPU model, is read once and reported as the labels of the HostInfo gauge,
+// which is always 1. Only the load average is required, the other metrics are skipped if they can't
+// be read, e.g. on a platform without /proc/stat.
+type HostCollector struct {
+	Counters *DeltaTracker     // Converts the context switches and interrupts to increments
+	Info     map[string]string // Static information about the host, nil until it's read
+	Logger   logging.ILogger   // Logger for logging activities
+
+	// The functions reading the host statistics, they are replaced in tests
+	Load       func(ctx context.Context) (*load.AvgStat, error)
+	Misc       func(ctx context.Context) (*load.MiscStat, error)
+	Uptime     func(ctx context.Context) (uint64, error)
+	BootTime   func(ctx context.Context) (uint64, error)
+	Users      func(ctx context.Context) ([]host.UserStat, error)
+	Interrupts func(ctx context.Context) (uint64, error)
+	HostInfo   func(ctx context.Context) (map[string]string, error)
+}
+
+// NewHostCollector creates and returns a new HostCollector.
+func NewHostCollector(logger logging.ILogger) entities.Collector {
+	return &HostCollector{
+		Counters:   NewDeltaTracker(),
+		Logger:     logger,
+		Load:       load.AvgWithContext,
+		Misc:       load.MiscWithContext,
+		Uptime:     host.UptimeWithContext,
+		BootTime:   host.BootTimeWithContext,
+		Users:      host.UsersWithContext,
+		Interrupts: readInterrupts,
+		HostInfo:   readHostInfo,
+	}
+}
+
+// Name returns the name of the collector.
+func (c *HostCollector) Name() string {
+	return HostCollectorName
+}
+
+// Collect reads the host statistics.
+func (c *HostCollector) Collect(ctx context.Context) (*entities.Snapshot, error) {
+	avg, err := c.Load(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the load average: %w", err)
+	}
+	snapshot := entities.NewSnapshot()
+	snapshot.Gauges["Load1"] = avg.Load1
+	snapshot.Gauges["Load5"] = avg.Load5
+	snapshot.Gauges["Load15"] = avg.Load15
+
+	if uptime, err := c.Uptime(ctx); err != nil {
+		c.Logger.Errorf("Failed to get the uptime: %v\n", err.Error())
+	} else {
+		snapshot.Gauges["Uptime"] = float64(uptime)
+	}
+	if bootTime, err := c.BootTime(ctx); err != nil {
+		c.Logger.Errorf("Failed to get the boot time: %v\n", err.Error())
+	} else {
+		snapshot.Gauges["BootTime"] = float64(bootTime)
+	}
+	if users, err := c.Users(ctx); errors.Is(err, fs.ErrNotExist) {
+		// there is no user accounting database, e.g. in a container, so no one has logged in
+		snapshot.Gauges["LoggedInUsers"] = 0
+	} else if err != nil {
+		c.Logger.Errorf("Failed to get the logged-in users: %v\n", err.Error())
+	} else {
+		snapshot.Gauges["LoggedInUsers"] = float64(len(users))
+	}
+	if misc, err := c.Misc(ctx); err != nil {
+		c.Logger.Errorf("Failed to get the context switches: %v\n", err.Error())
+	} else {
+		snapshot.Counters["ContextSwitches"] = c.Counters.Delta("ContextSwitches", uint64(misc.Ctxt))
+	}
+	if interrupts, err := c.Interrupts(ctx); err != nil {
+		c.Logger.Errorf("Failed to get the interrupts: %v\n", err.Error())
+	} else {
+		snapshot.Counters["Interrupts"] = c.Counters.Delta("Interrupts", interrupts)
+	}
+
+	if c.Info == nil {
+		if c.Info, err = c.HostInfo(ctx); err != nil {
+			c.Logger.Errorf("Failed to get the host information: %v\n", err.Error())
+		}
+	}
+	if c.Info != nil {
+		snapshot.Gauges["HostInfo"] = 1
+		snapshot.Labels["HostInfo"] = c.Info
+	}
+	return snapshot, nil
+}
+
+// readHostInfo reads the static information about the host: the OS, the kernel and the CPU model
+func readHostInfo(ctx context.Context) (map[string]string, error) {
+	info, err := host.InfoWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]string{
+		"hostname":         info.Hostname,
+		"os":               info.OS,
+		"platform":         info.Platform,
+		"platform_version": info.PlatformVersion,
+		"kernel":           info.KernelVersion,
+		"arch":             info.KernelArch,
+	}
+	if cpus, err := cpu.InfoWithContext(ctx); err == nil && len(cpus) > 0 {
+		result["cpu_model"] = cpus[0].ModelName
+	}
+	return result, nil
+}
+
+// readInterrupts reads the total number of interrupts since boot from the "intr" line of /proc/stat.
+// Like gopsutil, it respects the HOST_PROC environment variable pointing to the proc filesystem.
+func readInterrupts(ctx context.Context) (uint64, error) {
+	proc := os.Getenv("HOST_PROC")
+	if proc == "" {
+		proc = "/proc"
+	}
+	raw, err := os.ReadFile(filepath.Join(proc, "stat"))
+	if err != nil {
+		return 0, err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(raw)+1) // the line lists the counters of every interrupt
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 1 && fields[0] == "intr" {
+			return strconv.ParseUint(fields[1], 10, 64)
+		}
+	}
+	return 0, ErrNoInterrupts
+}
@@ -0,0 +1,74 @@
+package adapters
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/matthiasBT/monitoring/internal/infra/logging"
+	"github.com/shirou/gopsutil/v3/host"
+	"github.com/shirou/gopsutil/v3/load"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHostCollector_Collect(t *testing.T) {
+	collector := NewHostCollector(logging.SetupLogger()).(*HostCollector)
+	switches := 1000
+	infoReads := 0
+	collector.Load = func(ctx context.Context) (*load.AvgStat, error) {
+		return &load.AvgStat{Load1: 0.5, Load5: 0.25, Load15: 0.125}, nil
+	}
+	collector.Misc = func(ctx context.Context) (*load.MiscStat, error) {
+		return &load.MiscStat{Ctxt: switches}, nil
+	}
+	collector.Uptime = func(ctx context.Context) (uint64, error) { return 3600, nil }
+	collector.BootTime = func(ctx context.Context) (uint64, error) { return 1700000000, nil }
+	collector.Users = func(ctx context.Context) ([]host.UserStat, error) {
+		return nil, errors.New("no utmp in a container")
+	}
+	collector.Interrupts = func(ctx context.Context) (uint64, error) { return 500, nil }
+	collector.HostInfo = func(ctx context.Context) (map[string]string, error) {
+		infoReads++
+		return map[string]string{"kernel": "6.1.0", "cpu_model": "Fake CPU"}, nil
+	}
+
+	collector.Collect(context.Background()) //nolint:errcheck // only the second collection is checked
+	switches = 1500
+	snapshot, err := collector.Collect(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]float64{
+		"Load1":    0.5,
+		"Load5":    0.25,
+		"Load15":   0.125,
+		"Uptime":   3600,
+		"BootTime": 1700000000,
+		"HostInfo": 1,
+	}, snapshot.Gauges, "Metrics which can't be read must be skipped")
+	assert.Equal(t, map[string]int64{"ContextSwitches": 500, "Interrupts": 0}, snapshot.Counters)
+	assert.Equal(t, map[string]string{"kernel": "6.1.0", "cpu_model": "Fake CPU"}, snapshot.Labels["HostInfo"])
+	assert.Equal(t, 1, infoReads, "The host information must be read once")
+
+	collector.Load = func(ctx context.Context) (*load.AvgStat, error) { return nil, errors.New("fake error") }
+	_, err = collector.Collect(context.Background())
+	assert.Error(t, err)
+}
+
+func TestReadInterrupts(t *testing.T) {
+	proc := t.TempDir()
+	t.Setenv("HOST_PROC", proc)
+	stat := "cpu  100 0 50 1000 0 0 0 0 0 0\nintr 123456 10 0 5\nctxt 789\n"
+	if err := os.WriteFile(filepath.Join(proc, "stat"), []byte(stat), 0o600); err != nil {
+		t.Fatalf("Failed to write the stat file: %v", err)
+	}
+	interrupts, err := readInterrupts(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(123456), interrupts)
+
+	if err := os.WriteFile(filepath.Join(proc, "stat"), []byte("ctxt 789\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write the stat file: %v", err)
+	}
+	_, err = readInterrupts(context.Background())
+	assert.ErrorIs(t, err, ErrNoInterrupts)
+}
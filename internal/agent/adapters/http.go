@@ -7,13 +7,7 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
-	"crypto/aes"
-	"crypto/cipher"
-	"crypto/hmac"
-	"crypto/rand"
 	"crypto/rsa"
-	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"io"
@@ -22,6 +16,7 @@ import (
 
 	common "github.com/matthiasBT/monitoring/internal/infra/entities"
 	"github.com/matthiasBT/monitoring/internal/infra/logging"
+	"github.com/matthiasBT/monitoring/internal/infra/secure"
 	"github.com/matthiasBT/monitoring/internal/infra/utils"
 )
 
@@ -189,13 +184,11 @@ func (r *HTTPReportAdapter) hashData(payload []byte) (string, error) {
 	if bytes.Equal(r.HMACKey, []byte{}) {
 		return "", nil
 	}
-	mac := hmac.New(sha256.New, r.HMACKey)
-	if _, err := mac.Write(payload); err != nil {
+	result, err := secure.Sign(r.HMACKey, payload)
+	if err != nil {
 		r.Logger.Errorf("Failed to calculate hash: %v", err.Error())
 		return "", err
 	}
-	hash := mac.Sum(nil)
-	result := hex.EncodeToString(hash)
 	r.Logger.Infof("HMAC-SHA256 hash: %s\n", result)
 	return result, nil
 }
@@ -214,38 +207,10 @@ func (r *HTTPReportAdapter) compress(payload []byte) (bytes.Buffer, error) {
 }
 
 func (r *HTTPReportAdapter) encryptData(payload []byte) ([]byte, error) {
-	key, encryptedPayload, err := encryptAES(payload)
+	encrypted, err := secure.Encrypt(payload, r.CryptoKey)
 	if err != nil {
 		r.Logger.Errorf("Error encrypting message: %v", err)
 		return nil, err
 	}
-	encryptedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, r.CryptoKey, key, nil)
-	if err != nil {
-		r.Logger.Errorf("Error encrypting AES key: %v", err)
-		return nil, err
-	}
-	return append(encryptedKey, encryptedPayload...), nil
-}
-
-func encryptAES(plaintext []byte) ([]byte, []byte, error) {
-	key := make([]byte, 32) // AES-256
-	if _, err := rand.Read(key); err != nil {
-		return nil, nil, err
-	}
-
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	ciphertext := make([]byte, aes.BlockSize+len(plaintext))
-	iv := ciphertext[:aes.BlockSize]
-	if _, err := rand.Read(iv); err != nil {
-		return nil, nil, err
-	}
-
-	stream := cipher.NewCFBEncrypter(block, iv)
-	stream.XORKeyStream(ciphertext[aes.BlockSize:], plaintext)
-
-	return key, ciphertext, nil
+	return encrypted, nil
 }
@@ -0,0 +1,345 @@
+// Package adapters provides the collector tailing log files and counting the lines matching
+// the configured patterns.
+package adapters
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/matthiasBT/monitoring/internal/agent/entities"
+	"github.com/matthiasBT/monitoring/internal/infra/logging"
+)
+
+const (
+	// LogTailCollectorName is the name of the LogTailCollector in the configuration.
+	LogTailCollectorName = "logtail"
+
+	// LogOffsetsSavedGauge is 0 if the offsets couldn't be persisted after the last collection.
+	LogOffsetsSavedGauge = "LogOffsetsSaved"
+
+	// logReadChunk is the size of a single read from a log file
+	logReadChunk = 64 * 1024
+
+	// maxLogLine limits the length of a log line, the longer lines are skipped
+	maxLogLine = 1 << 20
+)
+
+var (
+	// ErrInvalidLogFile is returned when a tailed log file is configured incorrectly.
+	ErrInvalidLogFile = errors.New("invalid log file")
+
+	// ErrInvalidLogPattern is returned when a log pattern is configured incorrectly.
+	ErrInvalidLogPattern = errors.New("invalid log pattern")
+)
+
+// LogFile is a log file tailed by the LogTailCollector.
+type LogFile struct {
+	Name string // Name of the log in the metric names and labels
+	Path string // Path of the log file
+}
+
+// LogPattern is a regular expression matched against every line of the log files.
+type LogPattern struct {
+	Name  string         // Name of the pattern in the metric names and labels
+	Regex *regexp.Regexp // The pattern, its first capture group, if any, extracts a number
+}
+
+// ParseLogFiles parses semicolon-separated name=path entries, like "app=/var/log/app.log".
+func ParseLogFiles(spec string) ([]*LogFile, error) {
+	var files []*LogFile
+	for _, entry := range strings.Split(spec, ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		name, path, ok := strings.Cut(entry, "=")
+		file := &LogFile{Name: strings.TrimSpace(name), Path: strings.TrimSpace(path)}
+		if !ok || file.Name == "" || file.Path == "" {
+			return nil, fmt.Errorf("%w: %q, expected name=path", ErrInvalidLogFile, entry)
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// ParseLogPatterns parses semicolon-separated name=regexp entries, like "errors=ERROR;latency=took (\d+)ms".
+func ParseLogPatterns(spec string) ([]*LogPattern, error) {
+	var patterns []*LogPattern
+	for _, entry := range strings.Split(spec, ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		name, expr, ok := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || expr == "" {
+			return nil, fmt.Errorf("%w: %q, expected name=regexp", ErrInvalidLogPattern, entry)
+		}
+		regex, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q: %s", ErrInvalidLogPattern, entry, err.Error())
+		}
+		patterns = append(patterns, &LogPattern{Name: name, Regex: regex})
+	}
+	return patterns, nil
+}
+
+// LogOffset is the position in a log file which has been read up to.
+type LogOffset struct {
+	Offset int64  `json:"offset"` // Offset after the last complete line which has been read
+	FileID uint64 `json:"inode"`  // Identity of the file, to detect the rotation while the agent was down
+}
+
+// logTail is an open log file
+type logTail struct {
+	file    *os.File // Open file, which keeps being read after the rotation
+	offset  int64    // Offset after the last complete line which has been read
+	pending []byte   // Beginning of the line which hasn't been completely written yet
+}
+
+// LogTailCollector tails the log files and matches their new lines against the patterns. For every file
+// and pattern, it reports the counter LogMatches_<file>_<pattern> with the number of the matching lines
+// since the previous collection, and, if the pattern has a capture group, the gauge LogValue_<file>_<pattern>
+// with the number captured from the last matching line. LogUp_<file> is 0 if the file can't be read.
+//
+// A rotated file is read till the end before switching to the new one, and a truncated file is read from
+// the beginning. The offsets are persisted after every collection, so the lines aren't counted again after
+// a restart, and LogOffsetsSaved reports whether that has succeeded. The counted matches are accumulated
+// by the poller until the next report, so the matches collected during the last report interval before
+// a crash are lost. Files which have never been seen before are read from their current end.
+type LogTailCollector struct {
+	Files       []*LogFile           // Tailed log files
+	Patterns    []*LogPattern        // Patterns matched against the lines
+	OffsetsPath string               // Path of the file with the persisted offsets, empty to not persist them
+	Offsets     map[string]LogOffset // Persisted offsets by the paths of the log files
+	Tails       map[string]*logTail  // Open log files by their paths
+	Logger      logging.ILogger      // Logger for logging activities
+}
+
+// NewLogTailCollector creates and returns a new LogTailCollector, reading the persisted offsets.
+func NewLogTailCollector(
+	files []*LogFile, patterns []*LogPattern, offsetsPath string, logger logging.ILogger,
+) (entities.Collector, error) {
+	collector := &LogTailCollector{
+		Files:       files,
+		Patterns:    patterns,
+		OffsetsPath: offsetsPath,
+		Offsets:     make(map[string]LogOffset),
+		Tails:       make(map[string]*logTail),
+		Logger:      logger,
+	}
+	if offsetsPath == "" {
+		return collector, nil
+	}
+	raw, err := os.ReadFile(offsetsPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return collector, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, &collector.Offsets); err != nil {
+		return nil, fmt.Errorf("failed to read log offsets: %w", err)
+	}
+	return collector, nil
+}
+
+// Name returns the name of the collector.
+func (c *LogTailCollector) Name() string {
+	return LogTailCollectorName
+}
+
+// Collect reads the new lines of the log files and persists the offsets. The offsets of the files read
+// have already advanced, so the snapshot is always returned: the files left when the context expires
+// are read by the next collection, and a failure to persist the offsets is only logged and reported.
+func (c *LogTailCollector) Collect(ctx context.Context) (*entities.Snapshot, error) {
+	snapshot := entities.NewSnapshot()
+	for _, logFile := range c.Files {
+		if err := ctx.Err(); err != nil {
+			c.Logger.Errorf("Stopped tailing the logs before %s: %v\n", logFile.Path, err.Error())
+			break
+		}
+		suffix := metricSuffix(logFile.Name)
+		up := 1.0
+		if err := c.collectFile(logFile, snapshot); err != nil {
+			c.Logger.Errorf("Failed to tail %s: %v\n", logFile.Path, err.Error())
+			up = 0
+		}
+		snapshot.Gauges["LogUp_"+suffix] = up
+		snapshot.Labels["LogUp_"+suffix] = map[string]string{"log": logFile.Name}
+	}
+	if c.OffsetsPath == "" || len(c.Files) == 0 {
+		return snapshot, nil
+	}
+	saved := 1.0
+	if err := c.saveOffsets(); err != nil {
+		c.Logger.Errorf("Failed to persist log offsets: %v\n", err.Error())
+		saved = 0
+	}
+	snapshot.Gauges[LogOffsetsSavedGauge] = saved
+	return snapshot, nil
+}
+
+// collectFile reads the new lines of a log file, following its rotation and truncation
+func (c *LogTailCollector) collectFile(logFile *LogFile, snapshot *entities.Snapshot) error {
+	matches := make(map[*LogPattern]int64, len(c.Patterns))
+	values := make(map[*LogPattern]float64, len(c.Patterns))
+	match := func(line []byte) {
+		for _, pattern := range c.Patterns {
+			groups := pattern.Regex.FindSubmatch(line)
+			if groups == nil {
+				continue
+			}
+			matches[pattern]++
+			if len(groups) > 1 {
+				if value, err := strconv.ParseFloat(string(groups[1]), 64); err == nil {
+					values[pattern] = value
+				}
+			}
+		}
+	}
+	defer func() {
+		for _, pattern := range c.Patterns {
+			name := metricSuffix(logFile.Name) + "_" + metricSuffix(pattern.Name)
+			labels := map[string]string{"log": logFile.Name, "pattern": pattern.Name}
+			snapshot.Counters["LogMatches_"+name] = matches[pattern]
+			snapshot.Labels["LogMatches_"+name] = labels
+			if value, ok := values[pattern]; ok {
+				snapshot.Gauges["LogValue_"+name] = value
+				snapshot.Labels["LogValue_"+name] = labels
+			}
+		}
+	}()
+
+	tail := c.Tails[logFile.Path]
+	if tail == nil {
+		var err error
+		if tail, err = c.open(logFile.Path); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				// the file will be read from the beginning once it's created
+				c.Offsets[logFile.Path] = LogOffset{}
+			}
+			return err
+		}
+		c.Tails[logFile.Path] = tail
+	}
+	if err := tail.read(match); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(logFile.Path)
+	if err != nil {
+		// the file has been rotated, but the new one hasn't been created yet
+		return err
+	}
+	current, err := tail.file.Stat()
+	if err != nil {
+		return err
+	}
+	switch {
+	case !os.SameFile(info, current):
+		// the old file has been read till the end, the new one is read from the beginning
+		tail.file.Close()
+		file, err := os.Open(logFile.Path)
+		if err != nil {
+			delete(c.Tails, logFile.Path)
+			return err
+		}
+		tail = &logTail{file: file}
+		c.Tails[logFile.Path] = tail
+		if err := tail.read(match); err != nil {
+			return err
+		}
+		info, _ = file.Stat()
+	case info.Size() < tail.offset:
+		// the file has been truncated
+		tail.offset = 0
+		tail.pending = nil
+		if err := tail.read(match); err != nil {
+			return err
+		}
+	}
+	c.Offsets[logFile.Path] = LogOffset{Offset: tail.offset, FileID: fileID(info)}
+	return nil
+}
+
+// open opens the log file at the persisted offset, or at the end if it has never been read before
+func (c *LogTailCollector) open(path string) (*logTail, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	tail := &logTail{file: file, offset: info.Size()}
+	if persisted, ok := c.Offsets[path]; ok {
+		tail.offset = persisted.Offset
+		if persisted.FileID != fileID(info) || info.Size() < persisted.Offset {
+			// the file has been rotated or truncated while the agent was down
+			tail.offset = 0
+		}
+	}
+	return tail, nil
+}
+
+// read reads the complete lines written after the offset, passing them to the callback
+func (t *logTail) read(callback func(line []byte)) error {
+	buf := make([]byte, logReadChunk)
+	for {
+		n, err := t.file.ReadAt(buf, t.offset+int64(len(t.pending)))
+		data := append(t.pending, buf[:n]...)
+		for {
+			idx := bytes.IndexByte(data, '\n')
+			if idx < 0 {
+				break
+			}
+			callback(data[:idx])
+			t.offset += int64(idx + 1)
+			data = data[idx+1:]
+		}
+		if len(data) > maxLogLine {
+			t.offset += int64(len(data))
+			data = nil
+		}
+		t.pending = append([]byte(nil), data...)
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// saveOffsets atomically writes the offsets to the file
+func (c *LogTailCollector) saveOffsets() error {
+	data, err := json.Marshal(c.Offsets)
+	if err != nil {
+		return err
+	}
+	dir, name := filepath.Split(c.OffsetsPath)
+	if dir == "" {
+		dir = "."
+	}
+	file, err := os.CreateTemp(dir, name+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name()) // fails harmlessly after the successful rename
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), c.OffsetsPath)
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package adapters
+
+import "os"
+
+// fileID returns 0, so the rotation of a log file while the agent is down is only detected by its truncation
+func fileID(info os.FileInfo) uint64 {
+	return 0
+}
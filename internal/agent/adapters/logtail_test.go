@@ -0,0 +1,215 @@
+package adapters
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/matthiasBT/monitoring/internal/agent/entities"
+	"github.com/matthiasBT/monitoring/internal/infra/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+func appendLog(t *testing.T, path, data string) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		t.Fatalf("Failed to open the log: %v", err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(data); err != nil {
+		t.Fatalf("Failed to write the log: %v", err)
+	}
+}
+
+func TestParseLogFiles(t *testing.T) {
+	files, err := ParseLogFiles("app=/var/log/app.log; nginx = /var/log/nginx/error.log")
+	assert.NoError(t, err)
+	assert.Equal(t, []*LogFile{
+		{Name: "app", Path: "/var/log/app.log"},
+		{Name: "nginx", Path: "/var/log/nginx/error.log"},
+	}, files)
+	for _, invalid := range []string{"/var/log/app.log", "app=", "=/var/log/app.log"} {
+		_, err := ParseLogFiles(invalid)
+		assert.ErrorIs(t, err, ErrInvalidLogFile, invalid)
+	}
+}
+
+func TestParseLogPatterns(t *testing.T) {
+	patterns, err := ParseLogPatterns(`errors=ERROR;latency=took (\d+)ms`)
+	assert.NoError(t, err)
+	if assert.Len(t, patterns, 2) {
+		assert.Equal(t, "errors", patterns[0].Name)
+		assert.Equal(t, `took (\d+)ms`, patterns[1].Regex.String())
+	}
+	for _, invalid := range []string{"ERROR", "errors=", "errors=(ERROR"} {
+		_, err := ParseLogPatterns(invalid)
+		assert.ErrorIs(t, err, ErrInvalidLogPattern, invalid)
+	}
+}
+
+func TestLogTailCollector_Collect(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "app.log")
+	offsetsPath := filepath.Join(dir, "offsets.json")
+	appendLog(t, logPath, "ERROR written before the first start\n")
+	files := []*LogFile{{Name: "app", Path: logPath}, {Name: "missing", Path: filepath.Join(dir, "missing.log")}}
+	patterns, err := ParseLogPatterns(`errors=ERROR;latency=took (\d+)ms`)
+	if err != nil {
+		t.Fatalf("Failed to parse patterns: %v", err)
+	}
+	newCollector := func() *LogTailCollector {
+		collector, err := NewLogTailCollector(files, patterns, offsetsPath, logging.SetupLogger())
+		if err != nil {
+			t.Fatalf("Failed to create the collector: %v", err)
+		}
+		return collector.(*LogTailCollector)
+	}
+	collector := newCollector()
+
+	tests := []struct {
+		name      string
+		prepare   func()
+		errors    int64
+		latencies int64
+		latency   float64
+	}{
+		{
+			name:    "new file is read from the end",
+			prepare: func() {},
+		},
+		{
+			name: "appended lines",
+			prepare: func() {
+				appendLog(t, logPath, "INFO took 15ms\nERROR failed\nINFO took 20ms\nERROR incomp")
+			},
+			errors:    1,
+			latencies: 2,
+			latency:   20,
+		},
+		{
+			name: "completed line",
+			prepare: func() {
+				appendLog(t, logPath, "lete line\n")
+			},
+			errors: 1,
+		},
+		{
+			name: "truncation",
+			prepare: func() {
+				if err := os.Truncate(logPath, 0); err != nil {
+					t.Fatalf("Failed to truncate the log: %v", err)
+				}
+				appendLog(t, logPath, "ERROR after truncation\n")
+			},
+			errors: 1,
+		},
+		{
+			name: "rotation",
+			prepare: func() {
+				appendLog(t, logPath, "ERROR before rotation\n")
+				if err := os.Rename(logPath, logPath+".1"); err != nil {
+					t.Fatalf("Failed to rotate the log: %v", err)
+				}
+				appendLog(t, logPath+".1", "INFO took 7ms\n")
+				appendLog(t, logPath, "ERROR after rotation\nINFO took 9ms\n")
+			},
+			errors:    2,
+			latencies: 2,
+			latency:   9,
+		},
+		{
+			name: "restart doesn't recount",
+			prepare: func() {
+				collector = newCollector()
+				appendLog(t, logPath, "ERROR after restart\n")
+			},
+			errors: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.prepare()
+			snapshot, err := collector.Collect(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, tt.errors, snapshot.Counters["LogMatches_app_errors"])
+			assert.Equal(t, tt.latencies, snapshot.Counters["LogMatches_app_latency"])
+			if tt.latencies > 0 {
+				assert.Equal(t, tt.latency, snapshot.Gauges["LogValue_app_latency"])
+			} else {
+				assert.NotContains(t, snapshot.Gauges, "LogValue_app_latency")
+			}
+			assert.Equal(t, map[string]string{"log": "app", "pattern": "errors"}, snapshot.Labels["LogMatches_app_errors"])
+			assert.Equal(t, 1.0, snapshot.Gauges["LogUp_app"])
+			assert.Equal(t, 0.0, snapshot.Gauges["LogUp_missing"])
+			assert.Equal(t, 1.0, snapshot.Gauges[LogOffsetsSavedGauge])
+		})
+	}
+}
+
+func TestLogTailCollector_CollectCreatedFile(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "app.log")
+	patterns, _ := ParseLogPatterns("errors=ERROR")
+	collector, err := NewLogTailCollector([]*LogFile{{Name: "app", Path: logPath}}, patterns, "", logging.SetupLogger())
+	assert.NoError(t, err)
+
+	snapshot, err := collector.Collect(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, snapshot.Gauges["LogUp_app"])
+
+	appendLog(t, logPath, "ERROR in the new file\n")
+	snapshot, err = collector.Collect(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, snapshot.Gauges["LogUp_app"])
+	assert.Equal(t, int64(1), snapshot.Counters["LogMatches_app_errors"], "A created file must be read from the start")
+}
+
+func TestLogTailCollector_CollectBetweenReports(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "app.log")
+	appendLog(t, logPath, "")
+	patterns, _ := ParseLogPatterns("errors=ERROR")
+	collector, err := NewLogTailCollector([]*LogFile{{Name: "app", Path: logPath}}, patterns, "", logging.SetupLogger())
+	assert.NoError(t, err)
+	_, err = collector.Collect(context.Background()) // the new file is read from its end
+	assert.NoError(t, err)
+	data := &entities.SnapshotWrapper{}
+
+	// several collections happen between two reports
+	for i := 1; i <= 4; i++ {
+		appendLog(t, logPath, "ERROR first\nINFO\nERROR second\n")
+		snapshot, err := collector.Collect(context.Background())
+		assert.NoError(t, err)
+		data.Publish(snapshot)
+	}
+	assert.Equal(t, int64(8), data.Drain().Counters["LogMatches_app_errors"], "Every match must be reported")
+	assert.Equal(t, int64(0), data.Drain().Counters["LogMatches_app_errors"], "No match must be reported twice")
+}
+
+func TestLogTailCollector_CollectFailures(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "app.log")
+	appendLog(t, logPath, "")
+	patterns, _ := ParseLogPatterns("errors=ERROR")
+	offsetsPath := filepath.Join(dir, "missing", "offsets.json")
+	files := []*LogFile{{Name: "app", Path: logPath}}
+	collector, err := NewLogTailCollector(files, patterns, offsetsPath, logging.SetupLogger())
+	assert.NoError(t, err)
+	_, err = collector.Collect(context.Background())
+	assert.NoError(t, err)
+
+	appendLog(t, logPath, "ERROR first\n")
+	snapshot, err := collector.Collect(context.Background())
+	assert.NoError(t, err, "A failure to persist the offsets must not drop the read lines")
+	assert.Equal(t, int64(1), snapshot.Counters["LogMatches_app_errors"])
+	assert.Equal(t, 0.0, snapshot.Gauges[LogOffsetsSavedGauge])
+
+	appendLog(t, logPath, "ERROR second\n")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	snapshot, err = collector.Collect(ctx)
+	assert.NoError(t, err)
+	assert.NotContains(t, snapshot.Counters, "LogMatches_app_errors", "The files left must not be read")
+	snapshot, err = collector.Collect(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), snapshot.Counters["LogMatches_app_errors"], "The files left must be read next time")
+}
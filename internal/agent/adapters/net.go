@@ -0,0 +1,96 @@
+// Package adapters provides the collector of the network interface and TCP connection statistics of the host.
+package adapters
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/matthiasBT/monitoring/internal/agent/entities"
+	"github.com/shirou/gopsutil/v3/net"
+)
+
+// NetCollectorName is the name of the NetCollector in the configuration.
+const NetCollectorName = "net"
+
+// tcpStates are the TCP connection states which are always reported, so that their gauges
+// drop to zero when there are no such connections anymore
+var tcpStates = []string{
+	"ESTABLISHED", "SYN_SENT", "SYN_RECV", "FIN_WAIT1", "FIN_WAIT2", "TIME_WAIT",
+	"CLOSE", "CLOSE_WAIT", "LAST_ACK", "LISTEN", "CLOSING",
+}
+
+// NetCollector reports the traffic of every network interface and the number of TCP connections in every state.
+// The traffic counters are named after the interfaces, e.g. NetBytesRecv_eth0, and reported as increments
+// since the previous collection. The connection gauges are named after the states, e.g. TCPConnections_LISTEN.
+type NetCollector struct {
+	Interfaces *Filter       // Selects network interfaces by name
+	Counters   *DeltaTracker // Converts the traffic counters to increments
+
+	// IOCounters and Connections read the network statistics, they are replaced in tests
+	IOCounters  func(ctx context.Context, pernic bool) ([]net.IOCountersStat, error)
+	Connections func(ctx context.Context, kind string) ([]net.ConnectionStat, error)
+}
+
+// NewNetCollector creates and returns a new NetCollector.
+func NewNetCollector(interfaces *Filter) entities.Collector {
+	return &NetCollector{
+		Interfaces:  interfaces,
+		Counters:    NewDeltaTracker(),
+		IOCounters:  net.IOCountersWithContext,
+		Connections: net.ConnectionsWithoutUidsWithContext,
+	}
+}
+
+// Name returns the name of the collector.
+func (c *NetCollector) Name() string {
+	return NetCollectorName
+}
+
+// Collect reads the traffic counters of the interfaces and counts the TCP connections by state.
+func (c *NetCollector) Collect(ctx context.Context) (*entities.Snapshot, error) {
+	counters, err := c.IOCounters(ctx, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get network interface counters: %w", err)
+	}
+	snapshot := entities.NewSnapshot()
+	for _, stat := range counters {
+		if !c.Interfaces.Match(stat.Name) {
+			continue
+		}
+		suffix := metricSuffix(stat.Name)
+		labels := map[string]string{"interface": stat.Name}
+		for name, value := range map[string]uint64{
+			"NetBytesSent":   stat.BytesSent,
+			"NetBytesRecv":   stat.BytesRecv,
+			"NetPacketsSent": stat.PacketsSent,
+			"NetPacketsRecv": stat.PacketsRecv,
+			"NetErrorsIn":    stat.Errin,
+			"NetErrorsOut":   stat.Errout,
+			"NetDropsIn":     stat.Dropin,
+			"NetDropsOut":    stat.Dropout,
+		} {
+			snapshot.Counters[name+"_"+suffix] = c.Counters.Delta(name+"_"+suffix, value)
+			snapshot.Labels[name+"_"+suffix] = labels
+		}
+	}
+
+	connections, err := c.Connections(ctx, "tcp")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get TCP connections: %w", err)
+	}
+	states := make(map[string]int, len(tcpStates))
+	for _, state := range tcpStates {
+		states[state] = 0
+	}
+	for _, connection := range connections {
+		if connection.Status != "" && connection.Status != "NONE" {
+			states[connection.Status]++
+		}
+	}
+	for state, count := range states {
+		name := "TCPConnections_" + metricSuffix(state)
+		snapshot.Gauges[name] = float64(count)
+		snapshot.Labels[name] = map[string]string{"state": state}
+	}
+	return snapshot, nil
+}
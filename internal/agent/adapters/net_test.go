@@ -0,0 +1,40 @@
+package adapters
+
+import (
+	"context"
+	"testing"
+
+	"github.com/shirou/gopsutil/v3/net"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNetCollector_Collect(t *testing.T) {
+	interfaces, _ := NewFilter("", "^lo$")
+	collector := NewNetCollector(interfaces).(*NetCollector)
+	bytesRecv := uint64(1000)
+	collector.IOCounters = func(ctx context.Context, pernic bool) ([]net.IOCountersStat, error) {
+		return []net.IOCountersStat{
+			{Name: "eth0", BytesRecv: bytesRecv, BytesSent: 200, Errin: 1},
+			{Name: "lo", BytesRecv: 5000},
+		}, nil
+	}
+	collector.Connections = func(ctx context.Context, kind string) ([]net.ConnectionStat, error) {
+		return []net.ConnectionStat{{Status: "LISTEN"}, {Status: "ESTABLISHED"}, {Status: "ESTABLISHED"}}, nil
+	}
+
+	snapshot, err := collector.Collect(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, snapshot.Counters, 8, "Only the counters of the included interfaces must be reported")
+	assert.Equal(t, int64(0), snapshot.Counters["NetBytesRecv_eth0"])
+	assert.Equal(t, map[string]string{"interface": "eth0"}, snapshot.Labels["NetBytesRecv_eth0"])
+	assert.Equal(t, 2.0, snapshot.Gauges["TCPConnections_ESTABLISHED"])
+	assert.Equal(t, 1.0, snapshot.Gauges["TCPConnections_LISTEN"])
+	assert.Equal(t, 0.0, snapshot.Gauges["TCPConnections_TIME_WAIT"], "States without connections must be reported")
+	assert.Equal(t, map[string]string{"state": "TIME_WAIT"}, snapshot.Labels["TCPConnections_TIME_WAIT"])
+
+	bytesRecv = 1500
+	snapshot, err = collector.Collect(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(500), snapshot.Counters["NetBytesRecv_eth0"])
+	assert.Equal(t, int64(0), snapshot.Counters["NetErrorsIn_eth0"])
+}
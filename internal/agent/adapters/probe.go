@@ -0,0 +1,225 @@
+// Package adapters provides the collector of synthetic probes checking the availability
+// of HTTP endpoints and TCP ports.
+package adapters
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/matthiasBT/monitoring/internal/agent/entities"
+	"github.com/matthiasBT/monitoring/internal/infra/logging"
+)
+
+const (
+	// ProbeCollectorName is the name of the ProbeCollector in the configuration.
+	ProbeCollectorName = "probe"
+
+	// ProbeLabel is the label of the probe metrics naming the probe
+	ProbeLabel = "probe"
+
+	// maxProbeResponseSize limits the size of a response read by an HTTP probe
+	maxProbeResponseSize = 16 << 20
+)
+
+var (
+	// ErrInvalidProbe is returned when a probe is configured incorrectly.
+	ErrInvalidProbe = errors.New("invalid probe")
+
+	// ErrSlowProbes is returned when the probes can't be checked within the interval of the collector.
+	ErrSlowProbes = errors.New("probes can't be checked within the collector interval")
+)
+
+// Probe is a target checked by the ProbeCollector.
+type Probe struct {
+	Name   string   // Name of the probe in the metric names and labels
+	Target *url.URL // URL with the http, https or tcp scheme, like tcp://localhost:5432
+}
+
+// ParseProbes parses semicolon-separated name=URL entries, like
+// "site=https://example.com/health;db=tcp://localhost:5432".
+func ParseProbes(spec string) ([]*Probe, error) {
+	var probes []*Probe
+	for _, entry := range strings.Split(spec, ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		name, rawURL, ok := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("%w: %q, expected name=URL", ErrInvalidProbe, entry)
+		}
+		target, err := url.Parse(strings.TrimSpace(rawURL))
+		if err != nil || target.Host == "" {
+			return nil, fmt.Errorf("%w: %q, expected an absolute URL", ErrInvalidProbe, entry)
+		}
+		switch target.Scheme {
+		case "http", "https":
+		case "tcp":
+			if target.Port() == "" {
+				return nil, fmt.Errorf("%w: %q, expected a port", ErrInvalidProbe, entry)
+			}
+		default:
+			return nil, fmt.Errorf("%w: %q, unknown scheme %q", ErrInvalidProbe, entry, target.Scheme)
+		}
+		probes = append(probes, &Probe{Name: name, Target: target})
+	}
+	return probes, nil
+}
+
+// CheckProbeInterval makes sure that all probes can time out within the interval of the ProbeCollector,
+// which is also the timeout of a collection, when they're checked in rounds of concurrency probes.
+func CheckProbeInterval(probes []*Probe, timeout time.Duration, concurrency int, interval time.Duration) error {
+	rounds := (len(probes) + concurrency - 1) / concurrency
+	if worst := time.Duration(rounds) * timeout; worst > interval {
+		return fmt.Errorf(
+			"%w: %d probes by %d at a time may take %v, longer than the %s interval %v",
+			ErrSlowProbes, len(probes), concurrency, worst, ProbeCollectorName, interval,
+		)
+	}
+	return nil
+}
+
+// ProbeCollector checks the probes concurrently, running at most Concurrency of them at the same time.
+// The poller runs it on its own interval, so slow probes don't delay the other collectors.
+// For every probe, it reports ProbeUp_<name>, which is 1 if the port accepts connections or the HTTP
+// endpoint responds with a status below 400, and ProbeLatency_<name> in seconds. HTTP probes also report
+// ProbeStatusCode_<name> and ProbeResponseSize_<name> in bytes, and HTTPS probes report
+// ProbeCertExpiryDays_<name>, the number of days before the certificate of the server expires.
+type ProbeCollector struct {
+	Probes      []*Probe        // Probes to check
+	Timeout     time.Duration   // Maximal time of a single probe
+	Concurrency int             // Maximal number of the probes running at the same time
+	Client      *http.Client    // HTTP client of the HTTP probes, it doesn't follow redirects
+	Dialer      *net.Dialer     // Dialer of the TCP probes
+	Logger      logging.ILogger // Logger for logging activities
+}
+
+// NewProbeCollector creates and returns a new ProbeCollector.
+func NewProbeCollector(
+	probes []*Probe, timeout time.Duration, concurrency int, logger logging.ILogger,
+) entities.Collector {
+	return &ProbeCollector{
+		Probes:      probes,
+		Timeout:     timeout,
+		Concurrency: concurrency,
+		Client: &http.Client{
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		Dialer: &net.Dialer{},
+		Logger: logger,
+	}
+}
+
+// Name returns the name of the collector.
+func (c *ProbeCollector) Name() string {
+	return ProbeCollectorName
+}
+
+// Collect checks the probes. The failures of the probes are reported as metrics, not as errors.
+// The probes which haven't started before the context expires are left out of the snapshot,
+// since their state is unknown.
+func (c *ProbeCollector) Collect(ctx context.Context) (*entities.Snapshot, error) {
+	results := make([]*entities.Snapshot, len(c.Probes))
+	slots := make(chan struct{}, c.Concurrency)
+	var wg sync.WaitGroup
+start:
+	for idx, probe := range c.Probes {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		// checked even with a slot taken, since select picks randomly when both are ready
+		if err := ctx.Err(); err != nil {
+			c.Logger.Errorf("Skipped %d probes: %v\n", len(c.Probes)-idx, err.Error())
+			break start
+		}
+		wg.Add(1)
+		go func(idx int, probe *Probe) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			results[idx] = c.check(ctx, probe)
+		}(idx, probe)
+	}
+	wg.Wait()
+	snapshot := entities.NewSnapshot()
+	for _, result := range results {
+		if result != nil {
+			snapshot.Merge(result)
+		}
+	}
+	return snapshot, nil
+}
+
+// check runs a single probe
+func (c *ProbeCollector) check(ctx context.Context, probe *Probe) *entities.Snapshot {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+	gauges := make(map[string]float64)
+	start := time.Now()
+	var err error
+	if probe.Target.Scheme == "tcp" {
+		err = c.checkTCP(ctx, probe)
+	} else {
+		err = c.checkHTTP(ctx, probe, gauges)
+	}
+	gauges["ProbeLatency"] = time.Since(start).Seconds()
+	gauges["ProbeUp"] = 1
+	if err != nil {
+		c.Logger.Errorf("Probe %s failed: %v\n", probe.Name, err.Error())
+		gauges["ProbeUp"] = 0
+	}
+
+	snapshot := entities.NewSnapshot()
+	suffix := metricSuffix(probe.Name)
+	labels := map[string]string{ProbeLabel: probe.Name, "target": probe.Target.Redacted()}
+	for name, value := range gauges {
+		snapshot.Gauges[name+"_"+suffix] = value
+		snapshot.Labels[name+"_"+suffix] = labels
+	}
+	return snapshot
+}
+
+// checkTCP connects to the port
+func (c *ProbeCollector) checkTCP(ctx context.Context, probe *Probe) error {
+	conn, err := c.Dialer.DialContext(ctx, "tcp", probe.Target.Host)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// checkHTTP requests the endpoint, reading the whole response
+func (c *ProbeCollector) checkHTTP(ctx context.Context, probe *Probe, gauges map[string]float64) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, probe.Target.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	size, err := io.Copy(io.Discard, io.LimitReader(resp.Body, maxProbeResponseSize))
+	if err != nil {
+		return err
+	}
+	gauges["ProbeStatusCode"] = float64(resp.StatusCode)
+	gauges["ProbeResponseSize"] = float64(size)
+	if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+		gauges["ProbeCertExpiryDays"] = time.Until(resp.TLS.PeerCertificates[0].NotAfter).Hours() / 24
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
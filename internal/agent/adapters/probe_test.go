@@ -0,0 +1,132 @@
+package adapters
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/matthiasBT/monitoring/internal/infra/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseProbes(t *testing.T) {
+	probes, err := ParseProbes("site=https://example.com/health; db=tcp://localhost:5432")
+	assert.NoError(t, err)
+	if assert.Len(t, probes, 2) {
+		assert.Equal(t, "site", probes[0].Name)
+		assert.Equal(t, "https://example.com/health", probes[0].Target.String())
+		assert.Equal(t, "localhost:5432", probes[1].Target.Host)
+	}
+	for _, invalid := range []string{
+		"https://example.com", "site=", "site=example.com", "db=tcp://localhost", "ftp=ftp://example.com",
+	} {
+		_, err := ParseProbes(invalid)
+		assert.ErrorIs(t, err, ErrInvalidProbe, invalid)
+	}
+}
+
+func TestProbeCollector_Collect(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("OK")) //nolint:errcheck // the test fails anyway if the response isn't sent
+	})
+	plain := httptest.NewServer(handler)
+	defer plain.Close()
+	secure := httptest.NewTLSServer(handler)
+	defer secure.Close()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	closed.Close()
+	defer listener.Close()
+
+	probes, err := ParseProbes("plain=" + plain.URL + "/health;secure=" + secure.URL + "/health;broken=" +
+		plain.URL + "/broken;tcp=tcp://" + listener.Addr().String() + ";closed=tcp://" + closed.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to parse probes: %v", err)
+	}
+	collector := NewProbeCollector(probes, time.Second, 2, logging.SetupLogger()).(*ProbeCollector)
+	collector.Client.Transport = secure.Client().Transport
+
+	snapshot, err := collector.Collect(context.Background())
+	assert.NoError(t, err)
+	for name, up := range map[string]float64{"plain": 1, "secure": 1, "broken": 0, "tcp": 1, "closed": 0} {
+		assert.Equal(t, up, snapshot.Gauges["ProbeUp_"+name], name)
+		assert.Contains(t, snapshot.Gauges, "ProbeLatency_"+name)
+	}
+	assert.Equal(t, 200.0, snapshot.Gauges["ProbeStatusCode_plain"])
+	assert.Equal(t, 2.0, snapshot.Gauges["ProbeResponseSize_plain"])
+	assert.Equal(t, 500.0, snapshot.Gauges["ProbeStatusCode_broken"])
+	assert.NotContains(t, snapshot.Gauges, "ProbeCertExpiryDays_plain")
+	assert.Greater(t, snapshot.Gauges["ProbeCertExpiryDays_secure"], 365.0)
+	assert.NotContains(t, snapshot.Gauges, "ProbeStatusCode_tcp")
+	assert.Equal(t, map[string]string{ProbeLabel: "tcp", "target": "tcp://" + listener.Addr().String()},
+		snapshot.Labels["ProbeUp_tcp"])
+}
+
+func TestProbeCollector_Concurrency(t *testing.T) {
+	var active, maxActive int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := atomic.AddInt32(&active, 1)
+		defer atomic.AddInt32(&active, -1)
+		for {
+			observed := atomic.LoadInt32(&maxActive)
+			if current <= observed || atomic.CompareAndSwapInt32(&maxActive, observed, current) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}))
+	defer srv.Close()
+	target, _ := url.Parse(srv.URL)
+	var probes []*Probe
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		probes = append(probes, &Probe{Name: name, Target: target})
+	}
+	collector := NewProbeCollector(probes, time.Second, 2, logging.SetupLogger())
+
+	snapshot, err := collector.Collect(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, snapshot.Gauges["ProbeUp_e"])
+	assert.LessOrEqual(t, atomic.LoadInt32(&maxActive), int32(2), "No more than 2 probes must run at the same time")
+}
+
+func TestProbeCollector_CollectExpired(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+	target, _ := url.Parse(srv.URL)
+	probes := []*Probe{{Name: "a", Target: target}, {Name: "b", Target: target}, {Name: "c", Target: target}}
+	collector := NewProbeCollector(probes, time.Second, 1, logging.SetupLogger())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	snapshot, err := collector.Collect(ctx)
+	assert.NoError(t, err)
+	assert.Less(t, time.Since(start), time.Second, "Waiting for a slot must stop with the context")
+	assert.Equal(t, 0.0, snapshot.Gauges["ProbeUp_a"])
+	assert.NotContains(t, snapshot.Gauges, "ProbeUp_b", "A probe which hasn't run must not be reported as down")
+	assert.NotContains(t, snapshot.Gauges, "ProbeUp_c")
+}
+
+func TestCheckProbeInterval(t *testing.T) {
+	probes := make([]*Probe, 5)
+	assert.NoError(t, CheckProbeInterval(probes, 5*time.Second, 2, 15*time.Second))
+	assert.ErrorIs(t, CheckProbeInterval(probes, 5*time.Second, 2, 10*time.Second), ErrSlowProbes)
+	assert.NoError(t, CheckProbeInterval(nil, 5*time.Second, 2, time.Second))
+}
@@ -0,0 +1,284 @@
+// Package adapters provides the collector of the resource usage of the watched processes.
+package adapters
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/matthiasBT/monitoring/internal/agent/entities"
+	"github.com/matthiasBT/monitoring/internal/infra/logging"
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+const (
+	// ProcessCollectorName is the name of the ProcessCollector in the configuration.
+	ProcessCollectorName = "process"
+
+	// MatchByName selects the processes with the given executable name
+	MatchByName = "name"
+
+	// MatchByPidfile selects the process whose PID is written in the given file
+	MatchByPidfile = "pidfile"
+
+	// MatchByCmdline selects the processes whose command line matches the given regular expression
+	MatchByCmdline = "cmdline"
+)
+
+// ErrInvalidProcessMatcher is returned when a watched process is configured incorrectly.
+var ErrInvalidProcessMatcher = errors.New("invalid process matcher")
+
+// ProcessMatcher selects the processes reported under the same alias, e.g. all the nginx workers.
+type ProcessMatcher struct {
+	Alias   string         // Name of the watched process in the metric names and labels
+	Kind    string         // How the processes are selected: MatchByName, MatchByPidfile or MatchByCmdline
+	Pattern string         // Executable name, pidfile path or command line regular expression
+	Regex   *regexp.Regexp // Compiled Pattern of MatchByCmdline
+}
+
+// ParseProcessMatchers parses semicolon-separated alias=kind:pattern entries,
+// like "web=name:nginx;db=pidfile:/run/postgresql.pid;api=cmdline:^/usr/bin/api ".
+func ParseProcessMatchers(spec string) ([]*ProcessMatcher, error) {
+	var matchers []*ProcessMatcher
+	for _, entry := range strings.Split(spec, ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		alias, rule, ok := strings.Cut(entry, "=")
+		kind, pattern, ok2 := strings.Cut(rule, ":")
+		matcher := &ProcessMatcher{Alias: strings.TrimSpace(alias), Kind: strings.TrimSpace(kind), Pattern: pattern}
+		if !ok || !ok2 || matcher.Alias == "" || pattern == "" {
+			return nil, fmt.Errorf("%w: %q, expected alias=kind:pattern", ErrInvalidProcessMatcher, entry)
+		}
+		switch matcher.Kind {
+		case MatchByName, MatchByPidfile:
+		case MatchByCmdline:
+			regex, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %q: %s", ErrInvalidProcessMatcher, entry, err.Error())
+			}
+			matcher.Regex = regex
+		default:
+			return nil, fmt.Errorf("%w: %q, unknown kind %q", ErrInvalidProcessMatcher, entry, matcher.Kind)
+		}
+		matchers = append(matchers, matcher)
+	}
+	return matchers, nil
+}
+
+// ProcessInfo holds the statistics of a single process.
+type ProcessInfo struct {
+	PID        int32     // Process ID
+	Name       string    // Executable name
+	Cmdline    string    // Command line with the arguments
+	CPUSeconds float64   // CPU time spent in the user and system modes since the start
+	RSS        uint64    // Resident set size, bytes
+	FDs        int32     // Number of open file descriptors, -1 if unknown, e.g. because of permissions
+	Threads    int32     // Number of threads
+	CreateTime time.Time // Start time of the process
+}
+
+// cpuSample is the CPU time of a process at the moment of a collection
+type cpuSample struct {
+	seconds float64
+	at      time.Time
+}
+
+// ProcessCollector reports the resource usage of the watched processes. The metrics are named after
+// the aliases, e.g. ProcessRSS_web, and summed up over all the matching processes. ProcessUp_<alias>
+// is 1 if any matching process is running, otherwise only it and ProcessCount_<alias> are reported.
+type ProcessCollector struct {
+	Matchers []*ProcessMatcher   // Watched processes
+	Samples  map[int32]cpuSample // CPU time of the watched processes at the previous collection
+	Logger   logging.ILogger     // Logger for logging activities
+
+	// List, Inspect and Now read the process statistics and the time, they are replaced in tests
+	List    func(ctx context.Context) ([]*ProcessInfo, error)
+	Inspect func(ctx context.Context, pid int32) (*ProcessInfo, error)
+	Now     func() time.Time
+}
+
+// NewProcessCollector creates and returns a new ProcessCollector.
+func NewProcessCollector(matchers []*ProcessMatcher, logger logging.ILogger) entities.Collector {
+	return &ProcessCollector{
+		Matchers: matchers,
+		Samples:  make(map[int32]cpuSample),
+		Logger:   logger,
+		List:     listProcesses,
+		Inspect:  inspectProcess,
+		Now:      time.Now,
+	}
+}
+
+// Name returns the name of the collector.
+func (c *ProcessCollector) Name() string {
+	return ProcessCollectorName
+}
+
+// Collect finds the watched processes and reads their statistics.
+func (c *ProcessCollector) Collect(ctx context.Context) (*entities.Snapshot, error) {
+	var all []*ProcessInfo
+	for _, matcher := range c.Matchers {
+		if matcher.Kind != MatchByPidfile {
+			var err error
+			if all, err = c.List(ctx); err != nil {
+				return nil, fmt.Errorf("failed to list processes: %w", err)
+			}
+			break
+		}
+	}
+	now := c.Now()
+	samples := make(map[int32]cpuSample)
+	snapshot := entities.NewSnapshot()
+	for _, matcher := range c.Matchers {
+		var infos []*ProcessInfo
+		for _, pid := range c.match(ctx, matcher, all) {
+			info, err := c.Inspect(ctx, pid)
+			if err != nil {
+				// the process might have exited since it was listed
+				c.Logger.Errorf("Failed to inspect process %d of %s: %v\n", pid, matcher.Alias, err.Error())
+				continue
+			}
+			infos = append(infos, info)
+		}
+		c.report(snapshot, matcher.Alias, infos, samples, now)
+	}
+	c.Samples = samples
+	return snapshot, nil
+}
+
+// match returns the PIDs of the processes selected by the matcher
+func (c *ProcessCollector) match(ctx context.Context, matcher *ProcessMatcher, all []*ProcessInfo) []int32 {
+	var pids []int32
+	switch matcher.Kind {
+	case MatchByPidfile:
+		raw, err := os.ReadFile(matcher.Pattern)
+		if err != nil {
+			c.Logger.Errorf("Failed to read the pidfile of %s: %v\n", matcher.Alias, err.Error())
+			return nil
+		}
+		pid, err := strconv.ParseInt(strings.TrimSpace(string(raw)), 10, 32)
+		if err != nil {
+			c.Logger.Errorf("Invalid pidfile of %s: %v\n", matcher.Alias, err.Error())
+			return nil
+		}
+		pids = append(pids, int32(pid))
+	case MatchByName:
+		for _, info := range all {
+			if info.Name == matcher.Pattern {
+				pids = append(pids, info.PID)
+			}
+		}
+	case MatchByCmdline:
+		for _, info := range all {
+			if matcher.Regex.MatchString(info.Cmdline) {
+				pids = append(pids, info.PID)
+			}
+		}
+	}
+	return pids
+}
+
+// report adds the metrics of the processes matching the alias to the snapshot. The CPU utilization
+// is computed since the previous collection, or since the start of a newly found process,
+// and given in percent of a single CPU.
+func (c *ProcessCollector) report(
+	snapshot *entities.Snapshot, alias string, infos []*ProcessInfo, samples map[int32]cpuSample, now time.Time,
+) {
+	suffix := metricSuffix(alias)
+	labels := map[string]string{"process": alias}
+	set := func(name string, value float64) {
+		snapshot.Gauges[name+"_"+suffix] = value
+		snapshot.Labels[name+"_"+suffix] = labels
+	}
+	set("ProcessCount", float64(len(infos)))
+	if len(infos) == 0 {
+		set("ProcessUp", 0)
+		return
+	}
+	set("ProcessUp", 1)
+
+	var cpuPercent, rss, threads, fds float64
+	knownFDs := false
+	oldest := infos[0].CreateTime
+	for _, info := range infos {
+		previous, ok := c.Samples[info.PID]
+		if !ok || previous.seconds > info.CPUSeconds {
+			previous = cpuSample{at: info.CreateTime}
+		}
+		if elapsed := now.Sub(previous.at).Seconds(); elapsed > 0 {
+			cpuPercent += (info.CPUSeconds - previous.seconds) / elapsed * 100
+		}
+		samples[info.PID] = cpuSample{seconds: info.CPUSeconds, at: now}
+		rss += float64(info.RSS)
+		threads += float64(info.Threads)
+		if info.FDs >= 0 {
+			fds += float64(info.FDs)
+			knownFDs = true
+		}
+		if info.CreateTime.Before(oldest) {
+			oldest = info.CreateTime
+		}
+	}
+	set("ProcessCPUPercent", cpuPercent)
+	set("ProcessRSS", rss)
+	set("ProcessThreads", threads)
+	set("ProcessUptime", now.Sub(oldest).Seconds())
+	if knownFDs {
+		set("ProcessFDs", fds)
+	}
+}
+
+// listProcesses lists the running processes with their names and command lines
+func listProcesses(ctx context.Context) ([]*ProcessInfo, error) {
+	processes, err := process.ProcessesWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]*ProcessInfo, 0, len(processes))
+	for _, proc := range processes {
+		name, err := proc.NameWithContext(ctx)
+		if err != nil {
+			continue
+		}
+		cmdline, _ := proc.CmdlineWithContext(ctx)
+		infos = append(infos, &ProcessInfo{PID: proc.Pid, Name: name, Cmdline: cmdline})
+	}
+	return infos, nil
+}
+
+// inspectProcess reads the resource usage of a process
+func inspectProcess(ctx context.Context, pid int32) (*ProcessInfo, error) {
+	proc, err := process.NewProcessWithContext(ctx, pid)
+	if err != nil {
+		return nil, err
+	}
+	info := &ProcessInfo{PID: pid, FDs: -1}
+	times, err := proc.TimesWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	info.CPUSeconds = times.User + times.System
+	memory, err := proc.MemoryInfoWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	info.RSS = memory.RSS
+	if info.Threads, err = proc.NumThreadsWithContext(ctx); err != nil {
+		return nil, err
+	}
+	created, err := proc.CreateTimeWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	info.CreateTime = time.UnixMilli(created)
+	if fds, err := proc.NumFDsWithContext(ctx); err == nil {
+		info.FDs = fds
+	}
+	return info, nil
+}
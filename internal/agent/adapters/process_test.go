@@ -0,0 +1,82 @@
+package adapters
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/matthiasBT/monitoring/internal/infra/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseProcessMatchers(t *testing.T) {
+	matchers, err := ParseProcessMatchers("web=name:nginx; db=pidfile:/run/db.pid;api=cmdline:^/usr/bin/api -p;")
+	assert.NoError(t, err)
+	if assert.Len(t, matchers, 3) {
+		assert.Equal(t, ProcessMatcher{Alias: "web", Kind: MatchByName, Pattern: "nginx"}, *matchers[0])
+		assert.Equal(t, ProcessMatcher{Alias: "db", Kind: MatchByPidfile, Pattern: "/run/db.pid"}, *matchers[1])
+		assert.True(t, matchers[2].Regex.MatchString("/usr/bin/api -p 8080"))
+	}
+	invalid := []string{"nginx", "web=nginx", "web=name:", "=name:nginx", "web=exe:nginx", "api=cmdline:("}
+	for _, invalid := range invalid {
+		_, err := ParseProcessMatchers(invalid)
+		assert.ErrorIs(t, err, ErrInvalidProcessMatcher, invalid)
+	}
+}
+
+func TestProcessCollector_Collect(t *testing.T) {
+	pidfile := filepath.Join(t.TempDir(), "db.pid")
+	if err := os.WriteFile(pidfile, []byte("30\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write the pidfile: %v", err)
+	}
+	matchers, err := ParseProcessMatchers("web=name:nginx;db=pidfile:" + pidfile + ";api=cmdline:--api")
+	if err != nil {
+		t.Fatalf("Failed to parse matchers: %v", err)
+	}
+	start := time.Now()
+	now := start.Add(100 * time.Second)
+	cpuSeconds := map[int32]float64{10: 10, 11: 40, 30: 1}
+	collector := NewProcessCollector(matchers, logging.SetupLogger()).(*ProcessCollector)
+	collector.Now = func() time.Time { return now }
+	collector.List = func(ctx context.Context) ([]*ProcessInfo, error) {
+		return []*ProcessInfo{
+			{PID: 10, Name: "nginx", Cmdline: "nginx: master process"},
+			{PID: 11, Name: "nginx", Cmdline: "nginx: worker process"},
+			{PID: 20, Name: "bash", Cmdline: "bash"},
+		}, nil
+	}
+	collector.Inspect = func(ctx context.Context, pid int32) (*ProcessInfo, error) {
+		if pid == 30 {
+			return nil, errors.New("process not found")
+		}
+		return &ProcessInfo{
+			PID: pid, CPUSeconds: cpuSeconds[pid], RSS: 1000, FDs: -1, Threads: 2, CreateTime: start,
+		}, nil
+	}
+
+	snapshot, err := collector.Collect(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]float64{
+		"ProcessCount_web":      2,
+		"ProcessUp_web":         1,
+		"ProcessCPUPercent_web": 50, // 50 seconds in 100 seconds since the start
+		"ProcessRSS_web":        2000,
+		"ProcessThreads_web":    4,
+		"ProcessUptime_web":     100,
+		"ProcessCount_db":       0,
+		"ProcessUp_db":          0,
+		"ProcessCount_api":      0,
+		"ProcessUp_api":         0,
+	}, snapshot.Gauges)
+	assert.Equal(t, map[string]string{"process": "web"}, snapshot.Labels["ProcessUp_web"])
+
+	now = now.Add(10 * time.Second)
+	cpuSeconds[10] = 15
+	snapshot, err = collector.Collect(context.Background())
+	assert.NoError(t, err)
+	assert.InDelta(t, 50.0, snapshot.Gauges["ProcessCPUPercent_web"], 1e-9,
+		"CPU must be measured since the last collection")
+}
@@ -0,0 +1,64 @@
+// Package adapters provides the collectors of the Go runtime statistics of the agent process.
+package adapters
+
+import (
+	"context"
+	"math/rand"
+	"runtime"
+
+	"github.com/matthiasBT/monitoring/internal/agent/entities"
+)
+
+// RuntimeCollectorName is the name of the RuntimeCollector in the configuration.
+const RuntimeCollectorName = "runtime"
+
+// RuntimeCollector reports the memory allocator statistics of the Go runtime and a random value.
+type RuntimeCollector struct{}
+
+// NewRuntimeCollector creates and returns a new RuntimeCollector.
+func NewRuntimeCollector() entities.Collector {
+	return &RuntimeCollector{}
+}
+
+// Name returns the name of the collector.
+func (c *RuntimeCollector) Name() string {
+	return RuntimeCollectorName
+}
+
+// Collect reads the memory allocator statistics. It never fails.
+func (c *RuntimeCollector) Collect(ctx context.Context) (*entities.Snapshot, error) {
+	var rtm runtime.MemStats
+	runtime.ReadMemStats(&rtm)
+	snapshot := entities.NewSnapshot()
+	snapshot.Gauges = map[string]float64{
+		"Alloc":         float64(rtm.Alloc),
+		"BuckHashSys":   float64(rtm.BuckHashSys),
+		"Frees":         float64(rtm.Frees),
+		"GCCPUFraction": rtm.GCCPUFraction,
+		"GCSys":         float64(rtm.GCSys),
+		"HeapAlloc":     float64(rtm.HeapAlloc),
+		"HeapIdle":      float64(rtm.HeapIdle),
+		"HeapInuse":     float64(rtm.HeapInuse),
+		"HeapObjects":   float64(rtm.HeapObjects),
+		"HeapReleased":  float64(rtm.HeapReleased),
+		"HeapSys":       float64(rtm.HeapSys),
+		"LastGC":        float64(rtm.LastGC),
+		"Lookups":       float64(rtm.Lookups),
+		"MCacheInuse":   float64(rtm.MCacheInuse),
+		"MCacheSys":     float64(rtm.MCacheSys),
+		"MSpanInuse":    float64(rtm.MSpanInuse),
+		"MSpanSys":      float64(rtm.MSpanSys),
+		"Mallocs":       float64(rtm.Mallocs),
+		"NextGC":        float64(rtm.NextGC),
+		"NumForcedGC":   float64(rtm.NumForcedGC),
+		"NumGC":         float64(rtm.NumGC),
+		"OtherSys":      float64(rtm.OtherSys),
+		"PauseTotalNs":  float64(rtm.PauseTotalNs),
+		"StackInuse":    float64(rtm.StackInuse),
+		"StackSys":      float64(rtm.StackSys),
+		"Sys":           float64(rtm.Sys),
+		"TotalAlloc":    float64(rtm.TotalAlloc),
+		"RandomValue":   rand.Float64(),
+	}
+	return snapshot, nil
+}
@@ -0,0 +1,358 @@
+// Package adapters provides the collector of the metrics exposed by the colocated services
+// in the Prometheus text format.
+package adapters
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/matthiasBT/monitoring/internal/agent/entities"
+	"github.com/matthiasBT/monitoring/internal/infra/logging"
+)
+
+const (
+	// ScrapeCollectorName is the name of the ScrapeCollector in the configuration.
+	ScrapeCollectorName = "scrape"
+
+	// ScrapeTargetLabel is the label of the scraped metrics naming the target which exposed them
+	ScrapeTargetLabel = "scrape_target"
+
+	// PrometheusTypeLabel is the label of the scraped metrics with their Prometheus type, e.g. counter
+	PrometheusTypeLabel = "prometheus_type"
+
+	// scrapeTimeout limits the time of a single scrape
+	scrapeTimeout = 10 * time.Second
+
+	// maxScrapeSize limits the size of a scraped page
+	maxScrapeSize = 16 << 20
+
+	// maxScrapeSamples limits the number of samples forwarded from a single target
+	maxScrapeSamples = 10000
+)
+
+var (
+	// ErrInvalidScrapeTarget is returned when a scrape target is configured incorrectly.
+	ErrInvalidScrapeTarget = errors.New("invalid scrape target")
+
+	// ErrInvalidExposition is returned when a scraped page isn't in the Prometheus text format.
+	ErrInvalidExposition = errors.New("invalid Prometheus exposition")
+
+	// ErrTooManySamples is returned when a target exposes more than maxScrapeSamples samples.
+	ErrTooManySamples = errors.New("too many samples")
+)
+
+// ScrapeTarget is an endpoint exposing metrics in the Prometheus text format.
+type ScrapeTarget struct {
+	Name string // Name of the target in the metric names and labels
+	URL  string // URL of the metrics page, like http://localhost:9100/metrics
+}
+
+// ParseScrapeTargets parses semicolon-separated name=URL entries, like "node=http://localhost:9100/metrics".
+func ParseScrapeTargets(spec string) ([]*ScrapeTarget, error) {
+	var targets []*ScrapeTarget
+	for _, entry := range strings.Split(spec, ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		name, rawURL, ok := strings.Cut(entry, "=")
+		target := &ScrapeTarget{Name: strings.TrimSpace(name), URL: strings.TrimSpace(rawURL)}
+		if !ok || target.Name == "" {
+			return nil, fmt.Errorf("%w: %q, expected name=URL", ErrInvalidScrapeTarget, entry)
+		}
+		if parsed, err := url.Parse(target.URL); err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			return nil, fmt.Errorf("%w: %q, expected an absolute URL", ErrInvalidScrapeTarget, entry)
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+// Sample is a single sample of the Prometheus text format.
+type Sample struct {
+	Name   string            // Metric name, like http_requests_total
+	Labels map[string]string // Labels of the sample
+	Value  float64           // Value of the sample
+	Type   string            // Type from the TYPE comment, like counter, untyped if there is none
+}
+
+// ScrapeCollector scrapes the targets concurrently and forwards their samples as gauges with the raw
+// values. Prometheus counters are forwarded as gauges too, since they are floating-point and cumulative,
+// unlike the counters of the agent. A sample is named after the target, the metric and its labels, like
+// api_http_requests_total_code_200_method_GET, and keeps its labels along with the target name
+// and the Prometheus type. Samples whose names collide after replacing the unsupported characters, like
+// the ones with the label values a-b and a.b, get a short hash of their labels appended to the names.
+// Samples with NaN or infinite values are skipped. For every target, the collector reports ScrapeUp_<name>,
+// ScrapeDuration_<name> in seconds, ScrapeSamples_<name> and ScrapeCollisions_<name>, the number
+// of the samples whose names have collided.
+type ScrapeCollector struct {
+	Targets []*ScrapeTarget // Scraped endpoints
+	Client  *http.Client    // HTTP client scraping the targets
+	Logger  logging.ILogger // Logger for logging activities
+}
+
+// NewScrapeCollector creates and returns a new ScrapeCollector.
+func NewScrapeCollector(targets []*ScrapeTarget, logger logging.ILogger) entities.Collector {
+	return &ScrapeCollector{Targets: targets, Client: &http.Client{Timeout: scrapeTimeout}, Logger: logger}
+}
+
+// Name returns the name of the collector.
+func (c *ScrapeCollector) Name() string {
+	return ScrapeCollectorName
+}
+
+// Collect scrapes the targets. The failures of the targets are reported as self-metrics, not as errors.
+func (c *ScrapeCollector) Collect(ctx context.Context) (*entities.Snapshot, error) {
+	results := make([]*entities.Snapshot, len(c.Targets))
+	var wg sync.WaitGroup
+	for idx, target := range c.Targets {
+		wg.Add(1)
+		go func(idx int, target *ScrapeTarget) {
+			defer wg.Done()
+			results[idx] = c.collectTarget(ctx, target)
+		}(idx, target)
+	}
+	wg.Wait()
+	snapshot := entities.NewSnapshot()
+	for _, result := range results {
+		snapshot.Merge(result)
+	}
+	return snapshot, nil
+}
+
+// collectTarget scrapes a single target and converts its samples
+func (c *ScrapeCollector) collectTarget(ctx context.Context, target *ScrapeTarget) *entities.Snapshot {
+	start := time.Now()
+	samples, err := c.scrape(ctx, target)
+	duration := time.Since(start)
+	snapshot := entities.NewSnapshot()
+	prefix := metricSuffix(target.Name)
+	up := 1.0
+	if err != nil {
+		c.Logger.Errorf("Failed to scrape %s: %v\n", target.Name, err.Error())
+		up = 0
+		samples = nil
+	}
+	valid := make([]*Sample, 0, len(samples))
+	for _, sample := range samples {
+		if math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) {
+			continue // they can't be sent in JSON
+		}
+		valid = append(valid, sample)
+	}
+	ids, collisions := sampleIDs(valid)
+	for i, sample := range valid {
+		labels := make(map[string]string, len(sample.Labels)+2)
+		for name, value := range sample.Labels {
+			labels[name] = value
+		}
+		labels[ScrapeTargetLabel] = target.Name
+		labels[PrometheusTypeLabel] = sample.Type
+		id := prefix + "_" + ids[i]
+		snapshot.Gauges[id] = sample.Value
+		snapshot.Labels[id] = labels
+	}
+	labels := map[string]string{ScrapeTargetLabel: target.Name}
+	for name, value := range map[string]float64{
+		"ScrapeUp_":         up,
+		"ScrapeDuration_":   duration.Seconds(),
+		"ScrapeSamples_":    float64(len(valid)),
+		"ScrapeCollisions_": float64(collisions),
+	} {
+		snapshot.Gauges[name+prefix] = value
+		snapshot.Labels[name+prefix] = labels
+	}
+	return snapshot
+}
+
+// scrape fetches the metrics page of the target and parses it
+func (c *ScrapeCollector) scrape(ctx context.Context, target *ScrapeTarget) ([]*Sample, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/plain;version=0.0.4")
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return ParseExposition(io.LimitReader(resp.Body, maxScrapeSize))
+}
+
+// ParseExposition parses the Prometheus text format. HELP comments and timestamps are ignored.
+func ParseExposition(r io.Reader) ([]*Sample, error) {
+	types := make(map[string]string)
+	var samples []*Sample
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			fields := strings.Fields(line)
+			if len(fields) >= 4 && fields[1] == "TYPE" {
+				types[fields[2]] = fields[3]
+			}
+			continue
+		}
+		sample, err := parseSample(line)
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %s", ErrInvalidExposition, lineNum, err.Error())
+		}
+		sample.Type = sampleType(sample.Name, types)
+		if len(samples) == maxScrapeSamples {
+			return nil, ErrTooManySamples
+		}
+		samples = append(samples, sample)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidExposition, err.Error())
+	}
+	return samples, nil
+}
+
+// parseSample parses a line like `http_requests_total{method="GET",code="200"} 1027 1395066363000`
+func parseSample(line string) (*Sample, error) {
+	sample := &Sample{Labels: make(map[string]string)}
+	nameEnd := strings.IndexAny(line, "{ \t")
+	if nameEnd <= 0 {
+		return nil, errors.New("missing value")
+	}
+	sample.Name = line[:nameEnd]
+	rest := line[nameEnd:]
+	if strings.HasPrefix(rest, "{") {
+		var err error
+		if rest, err = parseLabels(rest[1:], sample.Labels); err != nil {
+			return nil, err
+		}
+	}
+	fields := strings.Fields(rest)
+	if len(fields) == 0 || len(fields) > 2 {
+		return nil, errors.New("expected a value and an optional timestamp")
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return nil, err
+	}
+	sample.Value = value
+	return sample, nil
+}
+
+// parseLabels parses the labels after the opening brace, like `method="GET",code="200"}`,
+// and returns the rest of the line after the closing brace
+func parseLabels(s string, labels map[string]string) (string, error) {
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if strings.HasPrefix(s, "}") {
+			return s[1:], nil
+		}
+		eq := strings.Index(s, "=")
+		if eq <= 0 || len(s) < eq+2 || s[eq+1] != '"' {
+			return "", errors.New("invalid label")
+		}
+		name := strings.TrimSpace(s[:eq])
+		var value strings.Builder
+		i := eq + 2
+		for ; i < len(s) && s[i] != '"'; i++ {
+			if s[i] == '\\' && i+1 < len(s) {
+				i++
+				switch s[i] {
+				case 'n':
+					value.WriteByte('\n')
+				default: // \\ and \"
+					value.WriteByte(s[i])
+				}
+				continue
+			}
+			value.WriteByte(s[i])
+		}
+		if i == len(s) {
+			return "", errors.New("unterminated label value")
+		}
+		labels[name] = value.String()
+		s = strings.TrimLeft(s[i+1:], " \t")
+		s = strings.TrimPrefix(s, ",")
+	}
+}
+
+// sampleType returns the type of the metric the sample belongs to. The samples of histograms
+// and summaries have suffixes, like http_request_duration_seconds_bucket.
+func sampleType(name string, types map[string]string) string {
+	if metricType, ok := types[name]; ok {
+		return metricType
+	}
+	for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+		if metricType, ok := types[strings.TrimSuffix(name, suffix)]; ok && strings.HasSuffix(name, suffix) {
+			return metricType
+		}
+	}
+	return "untyped"
+}
+
+// sampleIDs names the samples with sampleID, appending the labelsHash to the names shared by several samples.
+// Returns the names in the order of the samples and the number of the samples whose names have collided.
+func sampleIDs(samples []*Sample) ([]string, int) {
+	ids := make([]string, len(samples))
+	counts := make(map[string]int, len(samples))
+	for i, sample := range samples {
+		ids[i] = sampleID(sample)
+		counts[ids[i]]++
+	}
+	collisions := 0
+	for i, sample := range samples {
+		if counts[ids[i]] > 1 {
+			ids[i] += "_" + labelsHash(sample)
+			collisions++
+		}
+	}
+	return ids, collisions
+}
+
+// labelsHash returns a short hash of the metric name and the labels, which tells apart the samples
+// with the same sampleID
+func labelsHash(sample *Sample) string {
+	names := make([]string, 0, len(sample.Labels))
+	for name := range sample.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	hash := fnv.New32a()
+	hash.Write([]byte(sample.Name)) // never returns an error
+	for _, name := range names {
+		// quoting makes the encoding unambiguous
+		hash.Write([]byte(strconv.Quote(name) + "=" + strconv.Quote(sample.Labels[name])))
+	}
+	return fmt.Sprintf("%08x", hash.Sum32())
+}
+
+// sampleID names the sample after its metric and its labels sorted by name,
+// like http_requests_total_code_200_method_GET
+func sampleID(sample *Sample) string {
+	names := make([]string, 0, len(sample.Labels))
+	for name := range sample.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := []string{sample.Name}
+	for _, name := range names {
+		parts = append(parts, name, sample.Labels[name])
+	}
+	return metricSuffix(strings.Join(parts, "_"))
+}
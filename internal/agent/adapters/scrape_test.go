@@ -0,0 +1,127 @@
+package adapters
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/matthiasBT/monitoring/internal/infra/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+const exposition = `# HELP http_requests_total The total number of HTTP requests.
+# TYPE http_requests_total counter
+http_requests_total{method="post",code="200"} 1027 1395066363000
+http_requests_total{method="post",code="400"}    3 1395066363000
+
+# A histogram
+# TYPE http_request_duration_seconds histogram
+http_request_duration_seconds_bucket{le="0.1"} 24054
+http_request_duration_seconds_bucket{le="+Inf"} 144320
+http_request_duration_seconds_sum 53423
+http_request_duration_seconds_count 144320
+
+# Escaping in label values
+msdos_file_access_time_seconds{path="C:\\DIR\\FILE.TXT",error="Cannot find file:\n\"FILE.TXT\""} 1.458255915e9
+metric_without_timestamp_and_labels 12.47
+something_weird{problem="division by zero"} +Inf
+`
+
+func TestParseExposition(t *testing.T) {
+	samples, err := ParseExposition(strings.NewReader(exposition))
+	assert.NoError(t, err)
+	if !assert.Len(t, samples, 9) {
+		return
+	}
+	assert.Equal(t, &Sample{
+		Name:   "http_requests_total",
+		Labels: map[string]string{"method": "post", "code": "200"},
+		Value:  1027,
+		Type:   "counter",
+	}, samples[0])
+	assert.Equal(t, "histogram", samples[2].Type)
+	assert.Equal(t, "histogram", samples[5].Type)
+	assert.Equal(t, map[string]string{"path": `C:\DIR\FILE.TXT`, "error": "Cannot find file:\n\"FILE.TXT\""},
+		samples[6].Labels)
+	assert.Equal(t, &Sample{Name: "metric_without_timestamp_and_labels", Labels: map[string]string{},
+		Value: 12.47, Type: "untyped"}, samples[7])
+	assert.True(t, math.IsInf(samples[8].Value, 1))
+
+	for _, invalid := range []string{"foo", "foo bar", `foo{bar="baz} 1`, `foo{bar} 1`, "foo 1 2 3"} {
+		_, err := ParseExposition(strings.NewReader(invalid))
+		assert.ErrorIs(t, err, ErrInvalidExposition, invalid)
+	}
+}
+
+func TestParseScrapeTargets(t *testing.T) {
+	targets, err := ParseScrapeTargets("node=http://localhost:9100/metrics; api=http://localhost:8081/metrics")
+	assert.NoError(t, err)
+	assert.Equal(t, []*ScrapeTarget{
+		{Name: "node", URL: "http://localhost:9100/metrics"},
+		{Name: "api", URL: "http://localhost:8081/metrics"},
+	}, targets)
+	for _, invalid := range []string{"http://localhost:9100/metrics", "node=", "node=localhost:9100"} {
+		_, err := ParseScrapeTargets(invalid)
+		assert.ErrorIs(t, err, ErrInvalidScrapeTarget, invalid)
+	}
+}
+
+func TestScrapeCollector_Collect(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/metrics" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(exposition)) //nolint:errcheck // the test fails anyway if the page isn't sent
+	}))
+	defer srv.Close()
+	targets := []*ScrapeTarget{{Name: "api", URL: srv.URL + "/metrics"}, {Name: "db", URL: srv.URL + "/missing"}}
+	collector := NewScrapeCollector(targets, logging.SetupLogger())
+
+	snapshot, err := collector.Collect(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, snapshot.Counters)
+	assert.Equal(t, 1027.0, snapshot.Gauges["api_http_requests_total_code_200_method_post"])
+	assert.Equal(t, map[string]string{
+		"method": "post", "code": "200", ScrapeTargetLabel: "api", PrometheusTypeLabel: "counter",
+	}, snapshot.Labels["api_http_requests_total_code_200_method_post"])
+	assert.Equal(t, 144320.0, snapshot.Gauges["api_http_request_duration_seconds_bucket_le__Inf"])
+	assert.NotContains(t, snapshot.Gauges, "api_something_weird_problem_division_by_zero")
+	assert.Equal(t, 1.0, snapshot.Gauges["ScrapeUp_api"])
+	assert.Equal(t, 8.0, snapshot.Gauges["ScrapeSamples_api"], "Infinite values must be skipped")
+	assert.Equal(t, 0.0, snapshot.Gauges["ScrapeUp_db"])
+	assert.Equal(t, map[string]string{ScrapeTargetLabel: "db"}, snapshot.Labels["ScrapeUp_db"])
+}
+
+func TestScrapeCollector_CollectCollisions(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		//nolint:errcheck // the test fails anyway if the page isn't sent
+		w.Write([]byte("requests{path=\"a-b\"} 1\nrequests{path=\"a.b\"} 2\nrequests{path=\"a_b\"} 3\nuptime 4\n"))
+	}))
+	defer srv.Close()
+	collector := NewScrapeCollector([]*ScrapeTarget{{Name: "api", URL: srv.URL}}, logging.SetupLogger())
+
+	snapshot, err := collector.Collect(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 4.0, snapshot.Gauges["api_uptime"], "Names without collisions must not change")
+	assert.NotContains(t, snapshot.Gauges, "api_requests_path_a_b")
+	values := make(map[string]float64)
+	for id, value := range snapshot.Gauges {
+		if labels := snapshot.Labels[id]; labels["path"] != "" {
+			assert.Regexp(t, `^api_requests_path_a_b_[0-9a-f]{8}$`, id)
+			values[labels["path"]] = value
+		}
+	}
+	assert.Equal(t, map[string]float64{"a-b": 1, "a.b": 2, "a_b": 3}, values, "No sample must be overwritten")
+	assert.Equal(t, 3.0, snapshot.Gauges["ScrapeCollisions_api"])
+	assert.Equal(t, 4.0, snapshot.Gauges["ScrapeSamples_api"])
+
+	again, err := collector.Collect(context.Background())
+	assert.NoError(t, err)
+	for id, labels := range snapshot.Labels {
+		assert.Equal(t, labels, again.Labels[id], "Names must be the same in every scrape")
+	}
+}
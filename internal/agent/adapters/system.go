@@ -0,0 +1,70 @@
+// Package adapters provides the collectors of the memory and CPU utilization of the host.
+package adapters
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/matthiasBT/monitoring/internal/agent/entities"
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/mem"
+)
+
+const (
+	// MemoryCollectorName is the name of the MemoryCollector in the configuration.
+	MemoryCollectorName = "memory"
+
+	// CPUCollectorName is the name of the CPUCollector in the configuration.
+	CPUCollectorName = "cpu"
+)
+
+// MemoryCollector reports the total and free memory of the host.
+type MemoryCollector struct{}
+
+// NewMemoryCollector creates and returns a new MemoryCollector.
+func NewMemoryCollector() entities.Collector {
+	return &MemoryCollector{}
+}
+
+// Name returns the name of the collector.
+func (c *MemoryCollector) Name() string {
+	return MemoryCollectorName
+}
+
+// Collect reads the memory statistics of the host.
+func (c *MemoryCollector) Collect(ctx context.Context) (*entities.Snapshot, error) {
+	memstat, err := mem.VirtualMemoryWithContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get memory statistics: %w", err)
+	}
+	snapshot := entities.NewSnapshot()
+	snapshot.Gauges["TotalMemory"] = float64(memstat.Total)
+	snapshot.Gauges["FreeMemory"] = float64(memstat.Free)
+	return snapshot, nil
+}
+
+// CPUCollector reports the utilization of every CPU of the host since the previous collection.
+type CPUCollector struct{}
+
+// NewCPUCollector creates and returns a new CPUCollector.
+func NewCPUCollector() entities.Collector {
+	return &CPUCollector{}
+}
+
+// Name returns the name of the collector.
+func (c *CPUCollector) Name() string {
+	return CPUCollectorName
+}
+
+// Collect reads the utilization of the CPUs, named CPUutilization1, CPUutilization2 and so on.
+func (c *CPUCollector) Collect(ctx context.Context) (*entities.Snapshot, error) {
+	utilization, err := cpu.PercentWithContext(ctx, 0, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get CPU statistics: %w", err)
+	}
+	snapshot := entities.NewSnapshot()
+	for idx, utilStat := range utilization {
+		snapshot.Gauges[fmt.Sprintf("CPUutilization%d", idx+1)] = utilStat
+	}
+	return snapshot, nil
+}
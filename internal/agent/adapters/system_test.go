@@ -0,0 +1,71 @@
+package adapters
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/matthiasBT/monitoring/internal/agent/entities"
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollectors(t *testing.T) {
+	snapshot := entities.NewSnapshot()
+	for _, collector := range []entities.Collector{NewRuntimeCollector(), NewMemoryCollector(), NewCPUCollector()} {
+		result, err := collector.Collect(context.Background())
+		if err != nil {
+			t.Fatalf("Collector %s failed: %v", collector.Name(), err)
+		}
+		snapshot.Merge(result)
+	}
+	assert.Empty(t, snapshot.Counters)
+	gauges := make([]string, 0, len(snapshot.Gauges))
+	for key := range snapshot.Gauges {
+		gauges = append(gauges, key)
+	}
+	sort.Strings(gauges)
+	expectedGauges := []string{
+		"Alloc",
+		"BuckHashSys",
+		"FreeMemory",
+		"Frees",
+		"GCCPUFraction",
+		"GCSys",
+		"HeapAlloc",
+		"HeapIdle",
+		"HeapInuse",
+		"HeapObjects",
+		"HeapReleased",
+		"HeapSys",
+		"LastGC",
+		"Lookups",
+		"MCacheInuse",
+		"MCacheSys",
+		"MSpanInuse",
+		"MSpanSys",
+		"Mallocs",
+		"NextGC",
+		"NumForcedGC",
+		"NumGC",
+		"OtherSys",
+		"PauseTotalNs",
+		"RandomValue",
+		"StackInuse",
+		"StackSys",
+		"Sys",
+		"TotalAlloc",
+		"TotalMemory",
+	}
+	if cpuCount, err := cpu.Counts(true); err != nil {
+		t.Fatalf("Failed to get the number of CPUs: %v", err)
+	} else {
+		for i := 1; i <= cpuCount; i++ {
+			name := fmt.Sprintf("CPUutilization%d", i)
+			expectedGauges = append(expectedGauges, name)
+		}
+		sort.Strings(expectedGauges)
+	}
+	assert.EqualValues(t, expectedGauges, gauges)
+}
@@ -0,0 +1,88 @@
+// Package adapters provides the helpers shared by the collectors: name filters,
+// conversion of cumulative counters to deltas and naming of per-instance metrics.
+package adapters
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Filter selects names, e.g. of devices or network interfaces, by include and exclude regular expressions.
+type Filter struct {
+	Include *regexp.Regexp // Names must match it, nil to include everything
+	Exclude *regexp.Regexp // Names mustn't match it, nil to exclude nothing
+}
+
+// NewFilter compiles the include and exclude regular expressions. Empty expressions are ignored.
+func NewFilter(include, exclude string) (*Filter, error) {
+	filter := &Filter{}
+	var err error
+	if include != "" {
+		if filter.Include, err = regexp.Compile(include); err != nil {
+			return nil, fmt.Errorf("invalid include filter: %w", err)
+		}
+	}
+	if exclude != "" {
+		if filter.Exclude, err = regexp.Compile(exclude); err != nil {
+			return nil, fmt.Errorf("invalid exclude filter: %w", err)
+		}
+	}
+	return filter, nil
+}
+
+// Match checks whether any of the names is included and none is excluded.
+func (f *Filter) Match(names ...string) bool {
+	included := f.Include == nil
+	for _, name := range names {
+		if f.Exclude != nil && f.Exclude.MatchString(name) {
+			return false
+		}
+		if f.Include != nil && f.Include.MatchString(name) {
+			included = true
+		}
+	}
+	return included
+}
+
+// DeltaTracker converts cumulative counters, like the bytes read from a disk since boot,
+// to increments since the previous collection.
+type DeltaTracker struct {
+	Previous map[string]uint64 // Values of the counters at the previous collection
+}
+
+// NewDeltaTracker creates and returns a new DeltaTracker.
+func NewDeltaTracker() *DeltaTracker {
+	return &DeltaTracker{Previous: make(map[string]uint64)}
+}
+
+// Delta remembers the current value of the counter and returns its increment since the previous call.
+// The first call returns 0. If the counter has decreased, e.g. after a reset, its current value is returned.
+func (t *DeltaTracker) Delta(name string, current uint64) int64 {
+	previous, ok := t.Previous[name]
+	t.Previous[name] = current
+	switch {
+	case !ok:
+		return 0
+	case current < previous:
+		return int64(current)
+	default:
+		return int64(current - previous)
+	}
+}
+
+// metricSuffix converts an instance name, like a mountpoint or a device, to a suffix of metric names.
+// Characters other than letters and digits are replaced with underscores, e.g. "/var/lib" is
+// converted to "var_lib". The root mountpoint "/" is converted to "root".
+func metricSuffix(instance string) string {
+	suffix := strings.Trim(strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, instance), "_")
+	if suffix == "" {
+		return "root"
+	}
+	return suffix
+}
@@ -0,0 +1,48 @@
+package adapters
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilter_Match(t *testing.T) {
+	tests := []struct {
+		name    string
+		include string
+		exclude string
+		names   []string
+		want    bool
+	}{
+		{name: "no filters", names: []string{"sda"}, want: true},
+		{name: "included", include: "^sd", names: []string{"sda"}, want: true},
+		{name: "not included", include: "^sd", names: []string{"nvme0n1"}, want: false},
+		{name: "excluded", exclude: "^loop", names: []string{"loop0"}, want: false},
+		{name: "any name included", include: "^ext4$", names: []string{"/", "ext4"}, want: true},
+		{name: "any name excluded", include: "^/", exclude: "^tmpfs$", names: []string{"/tmp", "tmpfs"}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := NewFilter(tt.include, tt.exclude)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, filter.Match(tt.names...))
+		})
+	}
+	_, err := NewFilter("(", "")
+	assert.Error(t, err)
+}
+
+func TestDeltaTracker_Delta(t *testing.T) {
+	tracker := NewDeltaTracker()
+	assert.Equal(t, int64(0), tracker.Delta("foo", 100))
+	assert.Equal(t, int64(50), tracker.Delta("foo", 150))
+	assert.Equal(t, int64(20), tracker.Delta("foo", 20), "A reset counter must be reported from scratch")
+	assert.Equal(t, int64(0), tracker.Delta("bar", 20))
+}
+
+func TestMetricSuffix(t *testing.T) {
+	assert.Equal(t, "root", metricSuffix("/"))
+	assert.Equal(t, "var_lib", metricSuffix("/var/lib"))
+	assert.Equal(t, "nvme0n1", metricSuffix("nvme0n1"))
+	assert.Equal(t, "C", metricSuffix("C:"))
+}
@@ -0,0 +1,63 @@
+// Package entities defines the Collector interface implemented by the sources of the agent metrics
+// and the helpers for building the snapshots they return.
+package entities
+
+import "context"
+
+// Collector gathers a group of related metrics, e.g. the Go runtime statistics or the CPU utilization.
+// Collectors are registered in the poller, which runs each of them on its own interval and merges
+// their results into the snapshot being reported.
+type Collector interface {
+	// Name identifies the collector in the configuration and in the self-metrics of the agent.
+	Name() string
+
+	// Collect gathers the current values of the metrics. A failed collection doesn't affect
+	// the results of the other collectors.
+	Collect(ctx context.Context) (*Snapshot, error)
+}
+
+// NewSnapshot creates and returns an empty Snapshot.
+func NewSnapshot() *Snapshot {
+	return &Snapshot{
+		Gauges:   make(map[string]float64),
+		Counters: make(map[string]int64),
+		Labels:   make(map[string]map[string]string),
+	}
+}
+
+// Merge copies the metrics of another snapshot into this one, overwriting the metrics with the same names.
+func (s *Snapshot) Merge(other *Snapshot) {
+	for name, value := range other.Gauges {
+		s.Gauges[name] = value
+	}
+	for name, value := range other.Counters {
+		s.Counters[name] = value
+	}
+	for name, labels := range other.Labels {
+		s.Labels[name] = labels
+	}
+}
+
+// MergeGauges copies the gauges of another snapshot and their labels into this one,
+// overwriting the gauges with the same names.
+func (s *Snapshot) MergeGauges(other *Snapshot) {
+	for name, value := range other.Gauges {
+		s.Gauges[name] = value
+		if labels, ok := other.Labels[name]; ok {
+			s.Labels[name] = labels
+		}
+	}
+}
+
+// AddCounters adds the counters of another snapshot to the counters of this one,
+// copying the labels of the counters which don't have them yet.
+func (s *Snapshot) AddCounters(other *Snapshot) {
+	for name, value := range other.Counters {
+		s.Counters[name] += value
+		if labels, ok := other.Labels[name]; ok {
+			if _, ok := s.Labels[name]; !ok {
+				s.Labels[name] = labels
+			}
+		}
+	}
+}
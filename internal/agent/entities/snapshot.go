@@ -2,7 +2,11 @@
 // and reporting monitoring data in the monitoring system.
 package entities
 
-import "github.com/matthiasBT/monitoring/internal/infra/entities"
+import (
+	"sync"
+
+	"github.com/matthiasBT/monitoring/internal/infra/entities"
+)
 
 // Snapshot represents a snapshot of monitoring data at a specific point in time.
 // It includes gauges and counters, where gauges represent measurements at a particular
@@ -13,13 +17,59 @@ type Snapshot struct {
 
 	// Counters is a map where keys are counter names and values are the accumulated counter values.
 	Counters map[string]int64
+
+	// Labels is a map where keys are metric names and values are the labels attached to the metrics.
+	// Metrics without labels may be missing from it.
+	Labels map[string]map[string]string
 }
 
-// SnapshotWrapper encapsulates a Snapshot. It is used for passing snapshots
-// around in the system, potentially adding more metadata or context in the future.
+// SnapshotWrapper encapsulates a Snapshot. It is used for passing snapshots from the poller
+// to the reporter. The gauges of the snapshot are the latest polled values, while its counters
+// are the sums of the deltas polled since the last successful report, so that no delta is lost or sent twice.
+// The deltas of a failed report are requeued and sent again with the next one.
 type SnapshotWrapper struct {
 	// CurrSnapshot is a pointer to the current Snapshot being encapsulated.
 	CurrSnapshot *Snapshot
+
+	// lock guards CurrSnapshot
+	lock sync.Mutex
+}
+
+// Publish makes the snapshot current, replacing the gauges and adding its counters
+// to the ones accumulated since the last Drain.
+func (w *SnapshotWrapper) Publish(snapshot *Snapshot) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.CurrSnapshot != nil {
+		snapshot.AddCounters(w.CurrSnapshot)
+	}
+	w.CurrSnapshot = snapshot
+}
+
+// Drain returns the current snapshot for reporting and resets the accumulated counters.
+// Returns nil if nothing has been published yet.
+func (w *SnapshotWrapper) Drain() *Snapshot {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	snapshot := w.CurrSnapshot
+	if snapshot == nil {
+		return nil
+	}
+	w.CurrSnapshot = &Snapshot{Gauges: snapshot.Gauges, Counters: make(map[string]int64), Labels: snapshot.Labels}
+	return snapshot
+}
+
+// Requeue adds the counters of a drained snapshot, which couldn't be reported, back to the accumulated ones,
+// so that they're sent with the next report.
+func (w *SnapshotWrapper) Requeue(snapshot *Snapshot) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.CurrSnapshot == nil {
+		w.CurrSnapshot = &Snapshot{
+			Gauges: snapshot.Gauges, Counters: make(map[string]int64), Labels: make(map[string]map[string]string),
+		}
+	}
+	w.CurrSnapshot.AddCounters(snapshot)
 }
 
 // IReporter is an interface defining methods for reporting monitoring metrics.
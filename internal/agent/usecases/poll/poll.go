@@ -1,23 +1,61 @@
 // Package poll contains the functionality for polling system metrics at regular intervals.
-// It gathers various system metrics like memory and CPU utilization and encapsulates
-// them in a Snapshot structure.
+// The metrics are gathered by the registered collectors, each running on its own interval,
+// and encapsulated in a Snapshot structure.
 package poll
 
 import (
-	"fmt"
-	"math/rand"
-	"runtime"
+	"context"
+	"errors"
+	"sync"
 	"time"
 
 	"github.com/matthiasBT/monitoring/internal/agent/entities"
 	"github.com/matthiasBT/monitoring/internal/infra/logging"
-	"github.com/shirou/gopsutil/v3/cpu"
-	"github.com/shirou/gopsutil/v3/mem"
 )
 
+const (
+	// CollectorUpPrefix prefixes the gauges telling whether the last collection succeeded: 1 or 0
+	CollectorUpPrefix = "CollectorUp_"
+
+	// CollectorDurationPrefix prefixes the gauges with the duration of the last collection, seconds
+	CollectorDurationPrefix = "CollectorDuration_"
+
+	// CollectorLabel is the label of the self-metrics naming the collector
+	CollectorLabel = "collector"
+
+	// defaultCollectorInterval is used when neither the collector nor the poller has an interval
+	defaultCollectorInterval = time.Second
+)
+
+// ErrDuplicateCollector is returned when a collector with the same name is already registered.
+var ErrDuplicateCollector = errors.New("collector is already registered")
+
+// Registration is a collector registered in the poller along with the results of its last run.
+type Registration struct {
+	// Collector gathers the metrics.
+	Collector entities.Collector
+
+	// Interval is the time between the collections. It also limits the duration of a single collection.
+	// Zero means collecting on the PollInterval of the poller.
+	Interval time.Duration
+
+	// LastRun is the time of the last collection.
+	LastRun time.Time
+
+	// Result is the snapshot of the last collection, nil if it failed.
+	Result *entities.Snapshot
+
+	// Duration is the time the last collection took.
+	Duration time.Duration
+
+	// Deadline is the time when the running collection times out, zero if no collection is running.
+	Deadline time.Time
+}
+
 // Poller is responsible for periodically polling system metrics. It keeps track of the
-// number of polls and stores the latest metrics snapshot. Polling is done at intervals
-// defined by a Ticker and can be stopped via a Done channel.
+// number of polls and stores the latest metrics snapshot. Every collector runs in its own
+// goroutine on its own interval, and on every tick of the Ticker the poller publishes
+// the results which are ready. Polling can be stopped via a Done channel.
 type Poller struct {
 	// Logger is used to log informational and error messages during polling operations.
 	Logger logging.ILogger
@@ -25,87 +63,145 @@ type Poller struct {
 	// Data holds the current snapshot of the polled system metrics.
 	Data *entities.SnapshotWrapper
 
-	// Ticker controls the intervals at which the system metrics are polled.
+	// Ticker controls the intervals at which the snapshot of the system metrics is published.
 	Ticker *time.Ticker
 
+	// PollInterval is the interval of the collectors registered without their own one.
+	PollInterval time.Duration
+
 	// Done is a channel used to signal when polling should be stopped.
 	Done <-chan bool
 
 	// PollCount keeps track of the number of times the system has been polled.
 	PollCount int64
+
+	// Collectors are the registered collectors in the order of registration.
+	Collectors []*Registration
+
+	// counters are the counter deltas collected since the last published snapshot
+	counters *entities.Snapshot
+
+	// lock guards the results of the collectors and the counters
+	lock sync.Mutex
 }
 
-// Poll continuously polls system metrics at intervals defined by the Poller's Ticker.
-// It logs each polling event and updates the current metrics snapshot. Polling can
-// be stopped by sending a signal on the Poller's Done channel.
+// Register adds a collector to the poller. Returns ErrDuplicateCollector if a collector
+// with the same name is already registered. Collectors must be registered before polling starts.
+func (p *Poller) Register(collector entities.Collector, interval time.Duration) error {
+	for _, registration := range p.Collectors {
+		if registration.Collector.Name() == collector.Name() {
+			return ErrDuplicateCollector
+		}
+	}
+	p.Collectors = append(p.Collectors, &Registration{Collector: collector, Interval: interval})
+	return nil
+}
+
+// Poll starts the collectors and continuously publishes their results at intervals defined
+// by the Poller's Ticker. It logs each polling event. Polling can be stopped by sending
+// a signal on the Poller's Done channel.
 func (p *Poller) Poll() {
+	stop := make(chan struct{})
+	for _, registration := range p.Collectors {
+		go p.schedule(registration, stop)
+	}
 	for {
 		select {
 		case <-p.Done:
 			p.Logger.Infoln("Stopping the Poll job")
+			close(stop)
 			return
 		case tick := <-p.Ticker.C:
 			p.PollCount += 1
 			p.Logger.Infof("Poll job #%v is ticking at %v\n", p.PollCount, tick)
-			p.currentSnapshot()
+			p.currentSnapshot(tick)
+		}
+	}
+}
+
+// schedule runs the collector on its interval until the poller stops. A slow collector
+// only delays its own next run.
+func (p *Poller) schedule(registration *Registration, stop <-chan struct{}) {
+	interval := p.interval(registration)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		p.run(registration, interval)
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
 		}
 	}
 }
 
-func (p *Poller) currentSnapshot() {
-	var rtm runtime.MemStats
-	runtime.ReadMemStats(&rtm)
-	snapshot := &entities.Snapshot{
-		Gauges: map[string]float64{
-			"Alloc":         float64(rtm.Alloc),
-			"BuckHashSys":   float64(rtm.BuckHashSys),
-			"Frees":         float64(rtm.Frees),
-			"GCCPUFraction": rtm.GCCPUFraction,
-			"GCSys":         float64(rtm.GCSys),
-			"HeapAlloc":     float64(rtm.HeapAlloc),
-			"HeapIdle":      float64(rtm.HeapIdle),
-			"HeapInuse":     float64(rtm.HeapInuse),
-			"HeapObjects":   float64(rtm.HeapObjects),
-			"HeapReleased":  float64(rtm.HeapReleased),
-			"HeapSys":       float64(rtm.HeapSys),
-			"LastGC":        float64(rtm.LastGC),
-			"Lookups":       float64(rtm.Lookups),
-			"MCacheInuse":   float64(rtm.MCacheInuse),
-			"MCacheSys":     float64(rtm.MCacheSys),
-			"MSpanInuse":    float64(rtm.MSpanInuse),
-			"MSpanSys":      float64(rtm.MSpanSys),
-			"Mallocs":       float64(rtm.Mallocs),
-			"NextGC":        float64(rtm.NextGC),
-			"NumForcedGC":   float64(rtm.NumForcedGC),
-			"NumGC":         float64(rtm.NumGC),
-			"OtherSys":      float64(rtm.OtherSys),
-			"PauseTotalNs":  float64(rtm.PauseTotalNs),
-			"StackInuse":    float64(rtm.StackInuse),
-			"StackSys":      float64(rtm.StackSys),
-			"Sys":           float64(rtm.Sys),
-			"TotalAlloc":    float64(rtm.TotalAlloc),
-			"RandomValue":   rand.Float64(),
-		},
-		Counters: map[string]int64{
-			"PollCount": p.PollCount,
-		},
+// interval returns the time between the collections of the collector
+func (p *Poller) interval(registration *Registration) time.Duration {
+	if registration.Interval > 0 {
+		return registration.Interval
 	}
-	if memstat, err := mem.VirtualMemory(); err != nil {
-		p.Logger.Errorf("Failed to get memory statistics: %v\n", err.Error())
-		return
-	} else {
-		snapshot.Gauges["TotalMemory"] = float64(memstat.Total)
-		snapshot.Gauges["FreeMemory"] = float64(memstat.Free)
+	if p.PollInterval > 0 {
+		return p.PollInterval
 	}
-	if cpuUtilStat, err := cpu.Percent(0, true); err != nil {
-		p.Logger.Errorf("Failed to get CPU statistics: %v\n", err.Error())
+	return defaultCollectorInterval
+}
+
+// run runs a single collector with the timeout, recording its result. Errors are logged
+// and don't affect other collectors.
+func (p *Poller) run(registration *Registration, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	name := registration.Collector.Name()
+	start := time.Now()
+	p.lock.Lock()
+	registration.Deadline = start.Add(timeout)
+	p.lock.Unlock()
+
+	result, err := registration.Collector.Collect(ctx)
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	registration.Duration = time.Since(start)
+	registration.LastRun = start
+	registration.Deadline = time.Time{}
+	if err != nil {
+		p.Logger.Errorf("Collector %s failed: %v\n", name, err.Error())
+		registration.Result = nil
 		return
-	} else {
-		for idx, utilStat := range cpuUtilStat {
-			name := fmt.Sprintf("CPUutilization%d", idx+1)
-			snapshot.Gauges[name] = utilStat
+	}
+	registration.Result = result
+	if p.counters == nil {
+		p.counters = entities.NewSnapshot()
+	}
+	p.counters.AddCounters(result)
+}
+
+// currentSnapshot merges the last gauges of the collectors with their self-metrics, adds the counter
+// deltas collected since the previous call and a single poll to PollCount, and publishes the snapshot
+// for reporting. A collector which hasn't finished before its timeout is reported as failed.
+func (p *Poller) currentSnapshot(now time.Time) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	snapshot := entities.NewSnapshot()
+	for _, registration := range p.Collectors {
+		name := registration.Collector.Name()
+		up := 0.0
+		overdue := !registration.Deadline.IsZero() && now.After(registration.Deadline)
+		if registration.Result != nil && !overdue {
+			snapshot.MergeGauges(registration.Result)
+			up = 1
 		}
+		labels := map[string]string{CollectorLabel: name}
+		snapshot.Gauges[CollectorUpPrefix+name] = up
+		snapshot.Labels[CollectorUpPrefix+name] = labels
+		snapshot.Gauges[CollectorDurationPrefix+name] = registration.Duration.Seconds()
+		snapshot.Labels[CollectorDurationPrefix+name] = labels
+	}
+	if p.counters != nil {
+		snapshot.AddCounters(p.counters)
+		p.counters = nil
 	}
-	p.Data.CurrSnapshot = snapshot
+	snapshot.Counters["PollCount"]++
+	p.Data.Publish(snapshot)
 	p.Logger.Infoln("Created another metrics snapshot")
 }
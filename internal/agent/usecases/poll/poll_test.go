@@ -1,72 +1,132 @@
 package poll
 
 import (
-	"fmt"
-	"sort"
+	"context"
+	"errors"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/matthiasBT/monitoring/internal/agent/entities"
 	"github.com/matthiasBT/monitoring/internal/infra/logging"
-	"github.com/shirou/gopsutil/v3/cpu"
 	"github.com/stretchr/testify/assert"
 )
 
-func TestCollect(t *testing.T) {
+type FakeCollector struct {
+	name  string
+	value float64
+	delta int64
+	err   error
+	hang  bool
+	runs  int32
+}
+
+func (c *FakeCollector) Name() string {
+	return c.name
+}
+
+func (c *FakeCollector) Collect(ctx context.Context) (*entities.Snapshot, error) {
+	atomic.AddInt32(&c.runs, 1)
+	if c.hang {
+		time.Sleep(time.Hour) // ignores the context on purpose
+	}
+	if c.err != nil {
+		return nil, c.err
+	}
+	snapshot := entities.NewSnapshot()
+	snapshot.Gauges[c.name] = c.value
+	if c.delta != 0 {
+		snapshot.Counters[c.name+"Events"] = c.delta
+		snapshot.Labels[c.name+"Events"] = map[string]string{"source": c.name}
+	}
+	return snapshot, nil
+}
+
+func TestPoller_Register(t *testing.T) {
+	poller := Poller{Logger: logging.SetupLogger()}
+	assert.NoError(t, poller.Register(&FakeCollector{name: "foo"}, time.Second))
+	assert.ErrorIs(t, poller.Register(&FakeCollector{name: "foo"}, time.Minute), ErrDuplicateCollector)
+	assert.Len(t, poller.Collectors, 1)
+}
+
+func TestPoller_currentSnapshot(t *testing.T) {
+	healthy := &FakeCollector{name: "healthy", value: 1.5}
+	broken := &FakeCollector{name: "broken", err: errors.New("fake error")}
+	slow := &FakeCollector{name: "slow", value: 3}
 	poller := Poller{
 		Logger:    logging.SetupLogger(),
 		PollCount: 12,
 		Data:      &entities.SnapshotWrapper{CurrSnapshot: nil},
-		Ticker:    nil,
-		Done:      nil,
 	}
-	poller.currentSnapshot()
-	assert.NotContains(t, poller.Data.CurrSnapshot.Gauges, "PollCount")
-	assert.Equalf(t, map[string]int64{"PollCount": 12}, poller.Data.CurrSnapshot.Counters, "Counters don't match")
-	gauges := make([]string, 0, len(poller.Data.CurrSnapshot.Gauges))
-	for key := range poller.Data.CurrSnapshot.Gauges {
-		gauges = append(gauges, key)
+	assert.NoError(t, poller.Register(healthy, 2*time.Second))
+	assert.NoError(t, poller.Register(broken, 2*time.Second))
+	assert.NoError(t, poller.Register(slow, 4*time.Second))
+	for _, registration := range poller.Collectors {
+		poller.run(registration, registration.Interval)
 	}
-	sort.Strings(gauges)
-	expectedGauges := []string{
-		"Alloc",
-		"BuckHashSys",
-		"FreeMemory",
-		"Frees",
-		"GCCPUFraction",
-		"GCSys",
-		"HeapAlloc",
-		"HeapIdle",
-		"HeapInuse",
-		"HeapObjects",
-		"HeapReleased",
-		"HeapSys",
-		"LastGC",
-		"Lookups",
-		"MCacheInuse",
-		"MCacheSys",
-		"MSpanInuse",
-		"MSpanSys",
-		"Mallocs",
-		"NextGC",
-		"NumForcedGC",
-		"NumGC",
-		"OtherSys",
-		"PauseTotalNs",
-		"RandomValue",
-		"StackInuse",
-		"StackSys",
-		"Sys",
-		"TotalAlloc",
-		"TotalMemory",
-	}
-	if cpuCount, err := cpu.Counts(true); err != nil {
-		t.Fatalf("Failed to get the number of CPUs: %v", err)
-	} else {
-		for i := 1; i <= cpuCount; i++ {
-			name := fmt.Sprintf("CPUutilization%d", i)
-			expectedGauges = append(expectedGauges, name)
+	// the next run of the slow collector has been hanging for too long
+	poller.Collectors[2].Deadline = time.Now().Add(-time.Second)
+
+	poller.currentSnapshot(time.Now())
+	snapshot := poller.Data.CurrSnapshot
+	assert.Equal(t, map[string]int64{"PollCount": 1}, snapshot.Counters)
+	assert.Equal(t, 1.5, snapshot.Gauges["healthy"])
+	assert.NotContains(t, snapshot.Gauges, "broken", "A failed collector must not report anything")
+	assert.NotContains(t, snapshot.Gauges, "slow", "An overdue collector must not report anything")
+	assert.Equal(t, 1.0, snapshot.Gauges[CollectorUpPrefix+"healthy"])
+	assert.Equal(t, 0.0, snapshot.Gauges[CollectorUpPrefix+"broken"])
+	assert.Equal(t, 0.0, snapshot.Gauges[CollectorUpPrefix+"slow"])
+	assert.Contains(t, snapshot.Gauges, CollectorDurationPrefix+"slow")
+	assert.Equal(t, map[string]string{CollectorLabel: "broken"}, snapshot.Labels[CollectorUpPrefix+"broken"])
+}
+
+func TestPoller_counters(t *testing.T) {
+	counting := &FakeCollector{name: "counting", delta: 3}
+	poller := Poller{Logger: logging.SetupLogger(), Data: &entities.SnapshotWrapper{CurrSnapshot: nil}}
+	assert.NoError(t, poller.Register(counting, time.Second))
+
+	// the collector runs twice per poll, and the snapshot is reported after every 3 polls
+	var sent []int64
+	for poll := 1; poll <= 6; poll++ {
+		poller.run(poller.Collectors[0], time.Second)
+		poller.run(poller.Collectors[0], time.Second)
+		poller.currentSnapshot(time.Now())
+		if poll%3 == 0 {
+			snapshot := poller.Data.Drain()
+			sent = append(sent, snapshot.Counters["countingEvents"], snapshot.Counters["PollCount"])
+			assert.Equal(t, map[string]string{"source": "counting"}, snapshot.Labels["countingEvents"])
 		}
-		sort.Strings(expectedGauges)
 	}
-	assert.EqualValues(t, expectedGauges, gauges)
+	assert.Equal(t, []int64{18, 3, 18, 3}, sent, "Every delta must be reported exactly once")
+	assert.Empty(t, poller.Data.Drain().Counters)
+}
+
+func TestPoller_Poll(t *testing.T) {
+	fast := &FakeCollector{name: "fast", value: 1}
+	hung := &FakeCollector{name: "hung", hang: true}
+	done := make(chan bool)
+	poller := Poller{
+		Logger:       logging.SetupLogger(),
+		Data:         &entities.SnapshotWrapper{CurrSnapshot: nil},
+		Ticker:       time.NewTicker(10 * time.Millisecond),
+		PollInterval: 10 * time.Millisecond,
+		Done:         done,
+	}
+	assert.NoError(t, poller.Register(fast, 0))
+	assert.NoError(t, poller.Register(hung, 0))
+	stopped := make(chan struct{})
+	go func() {
+		poller.Poll()
+		close(stopped)
+	}()
+	time.Sleep(150 * time.Millisecond)
+	done <- true
+	<-stopped
+
+	assert.Greater(t, atomic.LoadInt32(&fast.runs), int32(5), "A hung collector must not block the others")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hung.runs))
+	assert.Greater(t, poller.PollCount, int64(5), "A hung collector must not block the polls")
+	snapshot := poller.Data.CurrSnapshot
+	assert.Equal(t, 1.0, snapshot.Gauges["fast"])
+	assert.Equal(t, 0.0, snapshot.Gauges[CollectorUpPrefix+"hung"])
 }
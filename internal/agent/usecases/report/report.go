@@ -49,31 +49,33 @@ func (r *Reporter) Report() {
 }
 
 func (r *Reporter) report() {
-	if r.Data.CurrSnapshot == nil {
+	// the counters are drained, so that the next report only sends the deltas polled after this one
+	snapshot := r.Data.Drain()
+	if snapshot == nil {
 		r.Logger.Infoln("Data for report is not ready yet")
 		return
 	}
-	// saving the address of the current snapshot, so it doesn't get overwritten
-	snapshot := r.Data.CurrSnapshot
 	r.Logger.Infof("Reporting snapshot, memory address: %v\n", &snapshot)
 	var batch = make([]*common.Metrics, 0, len(snapshot.Gauges)+len(snapshot.Gauges))
 	for name, val := range snapshot.Gauges {
 		val := val
 		metric := common.Metrics{
-			ID:    name,
-			MType: common.TypeGauge,
-			Delta: nil,
-			Value: &val,
+			ID:     name,
+			MType:  common.TypeGauge,
+			Delta:  nil,
+			Value:  &val,
+			Labels: snapshot.Labels[name],
 		}
 		batch = append(batch, &metric)
 	}
 	for name, val := range snapshot.Counters {
 		val := val
 		metric := common.Metrics{
-			ID:    name,
-			MType: common.TypeCounter,
-			Delta: &val,
-			Value: nil,
+			ID:     name,
+			MType:  common.TypeCounter,
+			Delta:  &val,
+			Value:  nil,
+			Labels: snapshot.Labels[name],
 		}
 		batch = append(batch, &metric)
 	}
@@ -84,5 +86,7 @@ func (r *Reporter) report() {
 	r.Logger.Infoln("All metrics have been prepared for report")
 	if err := r.SendAdapter.ReportBatch(batch); err != nil {
 		r.Logger.Errorf("Failed to report a batch. Error: %v\n", err.Error())
+		// the counters are sent again with the next report instead of being lost
+		r.Data.Requeue(snapshot)
 	}
 }
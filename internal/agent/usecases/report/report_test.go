@@ -3,6 +3,7 @@ package report
 import (
 	"crypto/rand"
 	"encoding/json"
+	"errors"
 	"testing"
 
 	"github.com/matthiasBT/monitoring/internal/agent/adapters"
@@ -71,4 +72,77 @@ func TestReporter_report(t *testing.T) {
 	assert.Equal(t, result[3].MType, common.TypeCounter)
 	assert.Equal(t, result[3].Value == nil, true)
 	assert.Equal(t, *result[3].Delta, int64(0))
+	assert.Empty(t, data.CurrSnapshot.Counters, "Reported counters must not be sent again")
+}
+
+// FakeServer sums the reported counters the same way the monitoring server does
+type FakeServer struct {
+	gauges   map[string]float64
+	counters map[string]int64
+	err      error // Error returned instead of accepting the batch
+}
+
+func (s *FakeServer) Report(metrics *common.Metrics) error {
+	return s.ReportBatch([]*common.Metrics{metrics})
+}
+
+func (s *FakeServer) ReportBatch(batch []*common.Metrics) error {
+	if s.err != nil {
+		return s.err
+	}
+	for _, metric := range batch {
+		if metric.MType == common.TypeCounter {
+			s.counters[metric.ID] += *metric.Delta
+		} else {
+			s.gauges[metric.ID] = *metric.Value
+		}
+	}
+	return nil
+}
+
+func TestReporter_reportAccumulated(t *testing.T) {
+	server := &FakeServer{gauges: make(map[string]float64), counters: make(map[string]int64)}
+	data := &entities.SnapshotWrapper{}
+	r := &Reporter{Logger: logging.SetupLogger(), Data: data, SendAdapter: server}
+
+	// 5 polls per report, like with the default intervals, and a report without new polls
+	for poll := 1; poll <= 10; poll++ {
+		snapshot := entities.NewSnapshot()
+		snapshot.Gauges["Load1"] = float64(poll)
+		snapshot.Counters["PollCount"] = 1
+		snapshot.Counters["DiskReadOps"] = int64(poll)
+		data.Publish(snapshot)
+		if poll%5 == 0 {
+			r.report()
+		}
+	}
+	r.report()
+	assert.Equal(t, map[string]int64{"PollCount": 10, "DiskReadOps": 55}, server.counters)
+	assert.Equal(t, 10.0, server.gauges["Load1"])
+}
+
+func TestReporter_reportFailed(t *testing.T) {
+	server := &FakeServer{gauges: make(map[string]float64), counters: make(map[string]int64)}
+	data := &entities.SnapshotWrapper{}
+	r := &Reporter{Logger: logging.SetupLogger(), Data: data, SendAdapter: server}
+
+	for poll := 1; poll <= 6; poll++ {
+		snapshot := entities.NewSnapshot()
+		snapshot.Counters["PollCount"] = 1
+		snapshot.Labels["PollCount"] = map[string]string{"host": "agent"}
+		data.Publish(snapshot)
+		if poll%2 == 0 {
+			// the server is down during the first two reports
+			if poll < 6 {
+				server.err = errors.New("connection refused")
+			} else {
+				server.err = nil
+			}
+			r.report()
+		}
+	}
+	assert.Equal(t, map[string]int64{"PollCount": 6}, server.counters, "The deltas of failed reports must be sent later")
+	assert.Equal(t, map[string]string{"host": "agent"}, data.Drain().Labels["PollCount"])
+	r.report()
+	assert.Equal(t, map[string]int64{"PollCount": 6}, server.counters, "The requeued deltas must be sent once")
 }
@@ -18,7 +18,7 @@ type gzipWriter struct {
 	http.ResponseWriter
 
 	// Writer is the gzip writer used to compress the response data.
-	Writer io.Writer
+	Writer *gzip.Writer
 }
 
 // Write compresses the given bytes using gzip and writes them to the response.
@@ -27,6 +27,20 @@ func (w gzipWriter) Write(b []byte) (int, error) {
 	return w.Writer.Write(b)
 }
 
+// Flush sends the data compressed so far to the client. It allows
+// streaming responses to be delivered through the compressing writer.
+func (w gzipWriter) Flush() {
+	if err := w.Writer.Flush(); err != nil {
+		return
+	}
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap returns the original http.ResponseWriter.
+func (w gzipWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
 // MiddlewareWriter is a middleware function that handles gzip compression
 // for HTTP responses. If the client accepts gzip encoding, it compresses
 // the response, otherwise it passes the response through unchanged.
@@ -84,3 +98,16 @@ func Decompress(reqBody io.ReadCloser) ([]byte, error) {
 	}
 	return body, nil
 }
+
+// Compress compresses the payload with gzip. It's used by the clients sending compressed requests.
+func Compress(payload []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(payload); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
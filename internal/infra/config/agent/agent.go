@@ -5,15 +5,16 @@ package agent
 
 import (
 	"crypto/rsa"
-	"crypto/x509"
 	"encoding/json"
-	"encoding/pem"
 	"flag"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/caarlos0/env/v9"
+	"github.com/matthiasBT/monitoring/internal/infra/secure"
 )
 
 const (
@@ -25,6 +26,13 @@ const (
 	DefRetryIntervalInitial = 1 * time.Second
 	DefRetryIntervalBackoff = 2 * time.Second
 	DefRateLimit            = 1
+	DefDiskExcludeDevices   = `^(loop|ram|sr)\d+$`
+	DefNetExcludeInterfaces = `^lo$`
+	DefCgroupRoot           = "/sys/fs/cgroup"
+	DefScriptTimeout        = 10
+	DefProbeTimeout         = 5
+	DefProbeConcurrency     = 4
+	DefLogOffsetsPath       = "/tmp/monitoring-agent-log-offsets.json"
 )
 
 // Config defines the configuration parameters for the agent. It includes
@@ -55,6 +63,78 @@ type Config struct {
 	// RateLimit defines the maximum number of active workers for processing.
 	RateLimit uint `env:"RATE_LIMIT"`
 
+	// DisabledCollectors is a comma-separated list of the collectors which must not run, like "cpu,memory".
+	DisabledCollectors string `env:"DISABLED_COLLECTORS" json:"disabled_collectors"`
+
+	// CollectorIntervals lists how often (in seconds) the collectors run as name:interval pairs,
+	// like "cpu:10,memory:30". Collectors which aren't listed run every PollInterval.
+	CollectorIntervals string `env:"COLLECTOR_INTERVALS" json:"collector_intervals"`
+
+	// DiskIncludeFS is a regular expression selecting the filesystems reported by the disk collector.
+	// It's matched against the mountpoint, the filesystem type and the device. Empty to include all.
+	DiskIncludeFS string `env:"DISK_INCLUDE_FS" json:"disk_include_fs"`
+
+	// DiskExcludeFS is a regular expression of the filesystems skipped by the disk collector,
+	// matched the same way as DiskIncludeFS. Empty to skip none.
+	DiskExcludeFS string `env:"DISK_EXCLUDE_FS" json:"disk_exclude_fs"`
+
+	// DiskIncludeDevices is a regular expression selecting the block devices whose I/O is reported,
+	// like "^(sd|nvme)". Empty to include all.
+	DiskIncludeDevices string `env:"DISK_INCLUDE_DEVICES" json:"disk_include_devices"`
+
+	// DiskExcludeDevices is a regular expression of the block devices whose I/O isn't reported.
+	DiskExcludeDevices string `env:"DISK_EXCLUDE_DEVICES" json:"disk_exclude_devices"`
+
+	// NetIncludeInterfaces is a regular expression selecting the network interfaces whose traffic
+	// is reported, like "^(eth|en)". Empty to include all.
+	NetIncludeInterfaces string `env:"NET_INCLUDE_INTERFACES" json:"net_include_interfaces"`
+
+	// NetExcludeInterfaces is a regular expression of the network interfaces whose traffic isn't reported.
+	NetExcludeInterfaces string `env:"NET_EXCLUDE_INTERFACES" json:"net_exclude_interfaces"`
+
+	// Processes lists the processes watched by the process collector as semicolon-separated
+	// alias=kind:pattern entries, where kind is name, pidfile or cmdline (a regular expression),
+	// like "web=name:nginx;db=pidfile:/run/postgresql.pid".
+	Processes string `env:"PROCESSES" json:"processes"`
+
+	// CgroupRoot is the mountpoint of the cgroup filesystem read by the cgroup collector.
+	CgroupRoot string `env:"CGROUP_ROOT" json:"cgroup_root"`
+
+	// Scripts lists the commands printing custom metrics for the exec collector as semicolon-separated
+	// name=command entries, like "queue=/opt/bin/queue-size --all".
+	Scripts string `env:"SCRIPTS" json:"scripts"`
+
+	// ScriptTimeout specifies how long (in seconds) a script may run before it's killed.
+	ScriptTimeout uint `env:"SCRIPT_TIMEOUT" json:"script_timeout"`
+
+	// ScrapeTargets lists the Prometheus endpoints of the colocated services scraped by the scrape collector
+	// as semicolon-separated name=URL entries, like "node=http://localhost:9100/metrics".
+	ScrapeTargets string `env:"SCRAPE_TARGETS" json:"scrape_targets"`
+
+	// Probes lists the HTTP endpoints and TCP ports checked by the probe collector as semicolon-separated
+	// name=URL entries, like "site=https://example.com/health;db=tcp://localhost:5432".
+	Probes string `env:"PROBES" json:"probes"`
+
+	// ProbeTimeout specifies how long (in seconds) a probe may take before it's considered failed.
+	// All probes must be able to time out within the interval of the probe collector, so with
+	// the default poll interval it has to be set in CollectorIntervals, like "probe:30".
+	ProbeTimeout uint `env:"PROBE_TIMEOUT" json:"probe_timeout"`
+
+	// ProbeConcurrency is the maximal number of probes running at the same time.
+	ProbeConcurrency uint `env:"PROBE_CONCURRENCY" json:"probe_concurrency"`
+
+	// LogFiles lists the log files tailed by the logtail collector as semicolon-separated name=path entries,
+	// like "app=/var/log/app.log;nginx=/var/log/nginx/error.log".
+	LogFiles string `env:"LOG_FILES" json:"log_files"`
+
+	// LogPatterns lists the regular expressions matched against every new line of the log files
+	// as semicolon-separated name=regexp entries, like "errors=ERROR;latency=took (\d+)ms".
+	// The number captured by the first group of a pattern, if any, is reported as a gauge.
+	LogPatterns string `env:"LOG_PATTERNS" json:"log_patterns"`
+
+	// LogOffsetsPath is the file where the logtail collector persists the read offsets of the log files.
+	LogOffsetsPath string `env:"LOG_OFFSETS" json:"log_offsets"`
+
 	// RetryAttempts is the number of retry attempts for failed requests.
 	RetryAttempts int
 
@@ -65,33 +145,48 @@ type Config struct {
 	RetryIntervalBackoff time.Duration
 }
 
-// ReadServerPublicKey reads a file and return an RSA private key
+// ReadServerPublicKey reads a file and returns an RSA public key of the server
 func (c *Config) ReadServerPublicKey() (*rsa.PublicKey, error) {
-	if c.CryptoKey == "" {
-		return nil, nil
-	}
-
-	data, err := os.ReadFile(c.CryptoKey)
-	if err != nil {
-		return nil, err
-	}
+	return secure.ReadPublicKey(c.CryptoKey)
+}
 
-	block, _ := pem.Decode(data)
-	if block == nil {
-		return nil, fmt.Errorf("failed to decode PEM block containing public key")
+// CollectorEnabled checks whether the collector is not listed in DisabledCollectors.
+func (c *Config) CollectorEnabled(name string) bool {
+	for _, disabled := range strings.Split(c.DisabledCollectors, ",") {
+		if strings.TrimSpace(disabled) == name {
+			return false
+		}
 	}
+	return true
+}
 
-	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
-	if err != nil {
-		return nil, err
+// CollectorSchedule parses CollectorIntervals and returns the intervals by the collector names.
+func (c *Config) CollectorSchedule() (map[string]time.Duration, error) {
+	schedule := make(map[string]time.Duration)
+	for _, pair := range strings.Split(c.CollectorIntervals, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		name, raw, ok := strings.Cut(pair, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid collector interval %q, expected name:seconds", pair)
+		}
+		seconds, err := strconv.ParseUint(strings.TrimSpace(raw), 10, 32)
+		if err != nil || seconds == 0 {
+			return nil, fmt.Errorf("invalid collector interval %q, expected a positive number of seconds", pair)
+		}
+		schedule[strings.TrimSpace(name)] = time.Duration(seconds) * time.Second
 	}
+	return schedule, nil
+}
 
-	switch pub := pub.(type) {
-	case *rsa.PublicKey:
-		return pub, nil
-	default:
-		return nil, fmt.Errorf("unknown type of public key")
+// CollectorInterval returns how often the collector runs: its interval from CollectorIntervals
+// or PollInterval if there is none.
+func (c *Config) CollectorInterval(schedule map[string]time.Duration, name string) time.Duration {
+	if interval, ok := schedule[name]; ok {
+		return interval
 	}
+	return time.Duration(c.PollInterval) * time.Second
 }
 
 // InitConfig initializes the Config structure by parsing environment variables
@@ -108,6 +203,35 @@ func InitConfig() (*Config, error) {
 	flag.StringVar(&conf.HMACKey, "k", "", "HMAC key for integrity checks")
 	flag.StringVar(&conf.CryptoKey, "crypto-key", "", "Path to a file with the server public key")
 	flag.UintVar(&conf.RateLimit, "l", DefRateLimit, "Max number of active workers")
+	flag.StringVar(&conf.DisabledCollectors, "disable-collectors", "", "Comma-separated collectors not to run")
+	flag.StringVar(&conf.CollectorIntervals, "collector-intervals", "", "Collector intervals. Usage: cpu:10,memory:30")
+	flag.StringVar(&conf.DiskIncludeFS, "disk-include-fs", "", "Regexp of the reported filesystems")
+	flag.StringVar(&conf.DiskExcludeFS, "disk-exclude-fs", "", "Regexp of the filesystems not reported")
+	flag.StringVar(&conf.DiskIncludeDevices, "disk-include-devices", "", "Regexp of the devices with reported I/O")
+	flag.StringVar(
+		&conf.DiskExcludeDevices,
+		"disk-exclude-devices",
+		DefDiskExcludeDevices,
+		"Regexp of the devices with unreported I/O",
+	)
+	flag.StringVar(&conf.NetIncludeInterfaces, "net-include", "", "Regexp of the interfaces with reported traffic")
+	flag.StringVar(
+		&conf.NetExcludeInterfaces,
+		"net-exclude",
+		DefNetExcludeInterfaces,
+		"Regexp of the interfaces with unreported traffic",
+	)
+	flag.StringVar(&conf.Scripts, "scripts", "", "Scripts printing metrics. Usage: queue=/opt/bin/queue-size --all")
+	flag.UintVar(&conf.ScriptTimeout, "script-timeout", DefScriptTimeout, "Maximal run time of a script, seconds")
+	flag.StringVar(&conf.ScrapeTargets, "scrape", "", "Prometheus endpoints. Usage: node=http://localhost:9100/metrics")
+	flag.StringVar(&conf.Probes, "probes", "", "Probes. Usage: site=https://example.com/health;db=tcp://localhost:5432")
+	flag.UintVar(&conf.ProbeTimeout, "probe-timeout", DefProbeTimeout, "Maximal time of a probe, seconds")
+	flag.UintVar(&conf.ProbeConcurrency, "probe-concurrency", DefProbeConcurrency, "Max number of concurrent probes")
+	flag.StringVar(&conf.CgroupRoot, "cgroup-root", DefCgroupRoot, "Mountpoint of the cgroup filesystem")
+	flag.StringVar(&conf.LogFiles, "log-files", "", "Tailed log files. Usage: app=/var/log/app.log")
+	flag.StringVar(&conf.LogPatterns, "log-patterns", "", "Log line patterns. Usage: errors=ERROR;latency=took (\\d+)ms")
+	flag.StringVar(&conf.LogOffsetsPath, "log-offsets", DefLogOffsetsPath, "File with the read offsets of the logs")
+	flag.StringVar(&conf.Processes, "processes", "", "Watched processes. Usage: web=name:nginx;db=pidfile:/run/db.pid")
 	flag.Parse()
 	if jsonConfigPath, ok := os.LookupEnv("CONFIG"); ok {
 		conf.ConfigPath = jsonConfigPath
@@ -126,6 +250,15 @@ func InitConfig() (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	if _, err := conf.CollectorSchedule(); err != nil {
+		return nil, err
+	}
+	if conf.ScriptTimeout == 0 {
+		return nil, fmt.Errorf("script timeout must be positive")
+	}
+	if conf.ProbeTimeout == 0 || conf.ProbeConcurrency == 0 {
+		return nil, fmt.Errorf("probe timeout and concurrency must be positive")
+	}
 	conf.UpdateURL = updateURL
 	conf.RetryAttempts = DefRetryAttempts
 	conf.RetryIntervalInitial = DefRetryIntervalInitial
@@ -4,6 +4,7 @@ import (
 	"flag"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -28,6 +29,13 @@ func TestInitConfig(t *testing.T) {
 				RetryIntervalBackoff: DefRetryIntervalBackoff,
 				RetryIntervalInitial: DefRetryIntervalInitial,
 				RateLimit:            DefRateLimit,
+				DiskExcludeDevices:   DefDiskExcludeDevices,
+				NetExcludeInterfaces: DefNetExcludeInterfaces,
+				CgroupRoot:           DefCgroupRoot,
+				ScriptTimeout:        DefScriptTimeout,
+				ProbeTimeout:         DefProbeTimeout,
+				ProbeConcurrency:     DefProbeConcurrency,
+				LogOffsetsPath:       DefLogOffsetsPath,
 			},
 		},
 		{
@@ -43,6 +51,13 @@ func TestInitConfig(t *testing.T) {
 				RetryIntervalBackoff: DefRetryIntervalBackoff,
 				RetryIntervalInitial: DefRetryIntervalInitial,
 				RateLimit:            DefRateLimit,
+				DiskExcludeDevices:   DefDiskExcludeDevices,
+				NetExcludeInterfaces: DefNetExcludeInterfaces,
+				CgroupRoot:           DefCgroupRoot,
+				ScriptTimeout:        DefScriptTimeout,
+				ProbeTimeout:         DefProbeTimeout,
+				ProbeConcurrency:     DefProbeConcurrency,
+				LogOffsetsPath:       DefLogOffsetsPath,
 			},
 		},
 		{
@@ -58,6 +73,13 @@ func TestInitConfig(t *testing.T) {
 				RetryIntervalBackoff: DefRetryIntervalBackoff,
 				RetryIntervalInitial: DefRetryIntervalInitial,
 				RateLimit:            DefRateLimit,
+				DiskExcludeDevices:   DefDiskExcludeDevices,
+				NetExcludeInterfaces: DefNetExcludeInterfaces,
+				CgroupRoot:           DefCgroupRoot,
+				ScriptTimeout:        DefScriptTimeout,
+				ProbeTimeout:         DefProbeTimeout,
+				ProbeConcurrency:     DefProbeConcurrency,
+				LogOffsetsPath:       DefLogOffsetsPath,
 			},
 		},
 		{
@@ -73,6 +95,13 @@ func TestInitConfig(t *testing.T) {
 				RetryIntervalBackoff: DefRetryIntervalBackoff,
 				RetryIntervalInitial: DefRetryIntervalInitial,
 				RateLimit:            DefRateLimit,
+				DiskExcludeDevices:   DefDiskExcludeDevices,
+				NetExcludeInterfaces: DefNetExcludeInterfaces,
+				CgroupRoot:           DefCgroupRoot,
+				ScriptTimeout:        DefScriptTimeout,
+				ProbeTimeout:         DefProbeTimeout,
+				ProbeConcurrency:     DefProbeConcurrency,
+				LogOffsetsPath:       DefLogOffsetsPath,
 			},
 		},
 	}
@@ -116,6 +145,13 @@ func TestInitConfigWithJSON(t *testing.T) {
 				ReportInterval:       DefReportInterval,                                     // defaults since no values
 				PollInterval:         DefPollInterval,
 				RateLimit:            DefRateLimit,
+				DiskExcludeDevices:   DefDiskExcludeDevices,
+				NetExcludeInterfaces: DefNetExcludeInterfaces,
+				CgroupRoot:           DefCgroupRoot,
+				ScriptTimeout:        DefScriptTimeout,
+				ProbeTimeout:         DefProbeTimeout,
+				ProbeConcurrency:     DefProbeConcurrency,
+				LogOffsetsPath:       DefLogOffsetsPath,
 				UpdateURL:            updateURL,
 				RetryAttempts:        DefRetryAttempts,
 				RetryIntervalBackoff: DefRetryIntervalBackoff,
@@ -147,3 +183,20 @@ func TestInitConfigWithJSON(t *testing.T) {
 		})
 	}
 }
+
+func TestConfig_CollectorSchedule(t *testing.T) {
+	conf := Config{PollInterval: 2, DisabledCollectors: "cpu, memory", CollectorIntervals: "runtime:10, disk:30"}
+	assert.False(t, conf.CollectorEnabled("memory"))
+	assert.True(t, conf.CollectorEnabled("runtime"))
+	schedule, err := conf.CollectorSchedule()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]time.Duration{"runtime": 10 * time.Second, "disk": 30 * time.Second}, schedule)
+	assert.Equal(t, 10*time.Second, conf.CollectorInterval(schedule, "runtime"))
+	assert.Equal(t, 2*time.Second, conf.CollectorInterval(schedule, "cpu"))
+
+	for _, invalid := range []string{"runtime", "runtime:0", "runtime:-1", "runtime:soon"} {
+		conf.CollectorIntervals = invalid
+		_, err := conf.CollectorSchedule()
+		assert.Error(t, err, invalid)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"flag"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -29,7 +30,16 @@ func TestInitConfig(t *testing.T) {
 				StoreInterval:        4,
 				FileStoragePath:      "/foo/bar.json",
 				Restore:              false,
-				TemplatePath:         templatePath,
+				StoreGenerations:     DefStoreGenerations,
+				StoreFormat:          DefStoreFormat,
+				StaleAfter:           DefStaleAfter,
+				HistorySize:          DefHistorySize,
+				HistoryRetention:     DefHistoryRetention,
+				StreamBufferSize:     DefStreamBufferSize,
+				UpstreamInterval:     DefUpstreamInterval,
+				UpstreamBatchSize:    DefUpstreamBatchSize,
+				UpstreamStatePath:    DefUpstreamStatePath,
+				LeaderLockID:         DefLeaderLockID,
 				RetryAttempts:        DefRetryAttempts,
 				RetryIntervalBackoff: DefRetryIntervalBackoff,
 				RetryIntervalInitial: DefRetryIntervalInitial,
@@ -44,7 +54,16 @@ func TestInitConfig(t *testing.T) {
 				StoreInterval:        27,
 				FileStoragePath:      "/lol/kek.txt",
 				Restore:              true,
-				TemplatePath:         templatePath,
+				StoreGenerations:     DefStoreGenerations,
+				StoreFormat:          DefStoreFormat,
+				StaleAfter:           DefStaleAfter,
+				HistorySize:          DefHistorySize,
+				HistoryRetention:     DefHistoryRetention,
+				StreamBufferSize:     DefStreamBufferSize,
+				UpstreamInterval:     DefUpstreamInterval,
+				UpstreamBatchSize:    DefUpstreamBatchSize,
+				UpstreamStatePath:    DefUpstreamStatePath,
+				LeaderLockID:         DefLeaderLockID,
 				RetryAttempts:        DefRetryAttempts,
 				RetryIntervalBackoff: DefRetryIntervalBackoff,
 				RetryIntervalInitial: DefRetryIntervalInitial,
@@ -64,7 +83,16 @@ func TestInitConfig(t *testing.T) {
 				StoreInterval:        4,
 				FileStoragePath:      "/foo/bar.json",
 				Restore:              false,
-				TemplatePath:         templatePath,
+				StoreGenerations:     DefStoreGenerations,
+				StoreFormat:          DefStoreFormat,
+				StaleAfter:           DefStaleAfter,
+				HistorySize:          DefHistorySize,
+				HistoryRetention:     DefHistoryRetention,
+				StreamBufferSize:     DefStreamBufferSize,
+				UpstreamInterval:     DefUpstreamInterval,
+				UpstreamBatchSize:    DefUpstreamBatchSize,
+				UpstreamStatePath:    DefUpstreamStatePath,
+				LeaderLockID:         DefLeaderLockID,
 				RetryAttempts:        DefRetryAttempts,
 				RetryIntervalBackoff: DefRetryIntervalBackoff,
 				RetryIntervalInitial: DefRetryIntervalInitial,
@@ -79,7 +107,41 @@ func TestInitConfig(t *testing.T) {
 				StoreInterval:        DefStoreInterval,
 				FileStoragePath:      DefFileStoragePath,
 				Restore:              DefRestore,
-				TemplatePath:         templatePath,
+				StoreGenerations:     DefStoreGenerations,
+				StoreFormat:          DefStoreFormat,
+				StaleAfter:           DefStaleAfter,
+				HistorySize:          DefHistorySize,
+				HistoryRetention:     DefHistoryRetention,
+				StreamBufferSize:     DefStreamBufferSize,
+				UpstreamInterval:     DefUpstreamInterval,
+				UpstreamBatchSize:    DefUpstreamBatchSize,
+				UpstreamStatePath:    DefUpstreamStatePath,
+				LeaderLockID:         DefLeaderLockID,
+				RetryAttempts:        DefRetryAttempts,
+				RetryIntervalBackoff: DefRetryIntervalBackoff,
+				RetryIntervalInitial: DefRetryIntervalInitial,
+			},
+		},
+		{
+			name:    "staleness settings",
+			cmdArgs: []string{"test", "-stale-after", "30"},
+			envs:    map[string]string{"METRIC_TTL": "600"},
+			want: Config{
+				Addr:                 DefAddr,
+				StoreInterval:        DefStoreInterval,
+				FileStoragePath:      DefFileStoragePath,
+				Restore:              DefRestore,
+				StoreGenerations:     DefStoreGenerations,
+				StoreFormat:          DefStoreFormat,
+				StaleAfter:           30,
+				MetricTTL:            600,
+				HistorySize:          DefHistorySize,
+				HistoryRetention:     DefHistoryRetention,
+				StreamBufferSize:     DefStreamBufferSize,
+				UpstreamInterval:     DefUpstreamInterval,
+				UpstreamBatchSize:    DefUpstreamBatchSize,
+				UpstreamStatePath:    DefUpstreamStatePath,
+				LeaderLockID:         DefLeaderLockID,
 				RetryAttempts:        DefRetryAttempts,
 				RetryIntervalBackoff: DefRetryIntervalBackoff,
 				RetryIntervalInitial: DefRetryIntervalInitial,
@@ -94,7 +156,16 @@ func TestInitConfig(t *testing.T) {
 				StoreInterval:        DefStoreInterval,
 				FileStoragePath:      "",
 				Restore:              DefRestore,
-				TemplatePath:         templatePath,
+				StoreGenerations:     DefStoreGenerations,
+				StoreFormat:          DefStoreFormat,
+				StaleAfter:           DefStaleAfter,
+				HistorySize:          DefHistorySize,
+				HistoryRetention:     DefHistoryRetention,
+				StreamBufferSize:     DefStreamBufferSize,
+				UpstreamInterval:     DefUpstreamInterval,
+				UpstreamBatchSize:    DefUpstreamBatchSize,
+				UpstreamStatePath:    DefUpstreamStatePath,
+				LeaderLockID:         DefLeaderLockID,
 				RetryAttempts:        DefRetryAttempts,
 				RetryIntervalBackoff: DefRetryIntervalBackoff,
 				RetryIntervalInitial: DefRetryIntervalInitial,
@@ -128,7 +199,6 @@ func TestFlushesSync(t *testing.T) {
 				StoreInterval:   0,
 				FileStoragePath: "/foo/bar.json",
 				Restore:         false,
-				TemplatePath:    templatePath,
 			},
 			want: true,
 		},
@@ -139,7 +209,16 @@ func TestFlushesSync(t *testing.T) {
 				StoreInterval:   1,
 				FileStoragePath: "/foo/bar.json",
 				Restore:         false,
-				TemplatePath:    templatePath,
+			},
+			want: false,
+		},
+		{
+			name: "logs to WAL",
+			config: Config{
+				Addr:            "0.0.0.0:8765",
+				StoreInterval:   0,
+				FileStoragePath: "/foo/bar.json",
+				WALPath:         "/foo/bar.wal",
 			},
 			want: false,
 		},
@@ -165,7 +244,6 @@ func TestFlushes(t *testing.T) {
 				StoreInterval:   DefStoreInterval,
 				FileStoragePath: "/foo/bar.json",
 				Restore:         DefRestore,
-				TemplatePath:    templatePath,
 			},
 			want: true,
 		},
@@ -176,7 +254,6 @@ func TestFlushes(t *testing.T) {
 				StoreInterval:   DefStoreInterval,
 				FileStoragePath: "",
 				Restore:         DefRestore,
-				TemplatePath:    templatePath,
 			},
 			want: false,
 		},
@@ -189,6 +266,31 @@ func TestFlushes(t *testing.T) {
 	}
 }
 
+func TestEvicts(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		want   bool
+	}{
+		{
+			name:   "evicts",
+			config: Config{MetricTTL: 600},
+			want:   true,
+		},
+		{
+			name:   "doesn't evict",
+			config: Config{MetricTTL: 0},
+			want:   false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.config.Evicts()
+			assert.Equal(t, got, tt.want)
+		})
+	}
+}
+
 func TestInitConfigWithJSON(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -215,7 +317,16 @@ func TestInitConfigWithJSON(t *testing.T) {
 				StoreInterval:        DefStoreInterval,
 				FileStoragePath:      DefFileStoragePath,
 				Restore:              DefRestore,
-				TemplatePath:         templatePath,
+				StoreGenerations:     DefStoreGenerations,
+				StoreFormat:          DefStoreFormat,
+				StaleAfter:           DefStaleAfter,
+				HistorySize:          DefHistorySize,
+				HistoryRetention:     DefHistoryRetention,
+				StreamBufferSize:     DefStreamBufferSize,
+				UpstreamInterval:     DefUpstreamInterval,
+				UpstreamBatchSize:    DefUpstreamBatchSize,
+				UpstreamStatePath:    DefUpstreamStatePath,
+				LeaderLockID:         DefLeaderLockID,
 				RetryAttempts:        DefRetryAttempts,
 				RetryIntervalBackoff: DefRetryIntervalBackoff,
 				RetryIntervalInitial: DefRetryIntervalInitial,
@@ -246,3 +357,101 @@ func TestInitConfigWithJSON(t *testing.T) {
 		})
 	}
 }
+
+func TestUsesWAL(t *testing.T) {
+	assert.True(t, (&Config{WALPath: "/foo/bar.wal", FileStoragePath: "/foo/bar.json"}).UsesWAL())
+	assert.False(t, (&Config{WALPath: "/foo/bar.wal"}).UsesWAL(), "WAL requires a keeper for checkpoints")
+	assert.False(t, (&Config{FileStoragePath: "/foo/bar.json"}).UsesWAL())
+	native := Config{WALPath: "/foo/bar.wal", DatabaseDSN: "postgres://localhost/db", DatabaseNative: true}
+	assert.False(t, native.UsesWAL(), "WAL isn't used in the database native mode")
+	assert.Equal(t, DefStoreInterval*time.Second, (&Config{WALPath: "/foo/bar.wal"}).FlushInterval())
+}
+
+func TestStorage(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       Config
+		wantKind     string
+		wantLocation string
+		wantErr      bool
+	}{
+		{
+			name:   "no storage",
+			config: Config{},
+		},
+		{
+			name:         "file path",
+			config:       Config{FileStoragePath: "/foo/bar.json"},
+			wantKind:     StorageFile,
+			wantLocation: "/foo/bar.json",
+		},
+		{
+			name:         "database DSN",
+			config:       Config{FileStoragePath: "/foo/bar.json", DatabaseDSN: "postgres://localhost/db"},
+			wantKind:     StoragePostgres,
+			wantLocation: "postgres://localhost/db",
+		},
+		{
+			name:         "bolt URL overrides the rest",
+			config:       Config{FileStoragePath: "/foo/bar.json", StorageURL: "bolt:///var/lib/metrics.db"},
+			wantKind:     StorageBolt,
+			wantLocation: "/var/lib/metrics.db",
+		},
+		{
+			name:         "relative file URL",
+			config:       Config{StorageURL: "file://data/metrics.json"},
+			wantKind:     StorageFile,
+			wantLocation: "data/metrics.json",
+		},
+		{
+			name:    "unknown scheme",
+			config:  Config{StorageURL: "redis://localhost"},
+			wantErr: true,
+		},
+		{
+			name:    "no path",
+			config:  Config{StorageURL: "bolt://"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kind, location, err := tt.config.Storage()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Storage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Equal(t, tt.wantKind, kind)
+			assert.Equal(t, tt.wantLocation, location)
+		})
+	}
+}
+
+func TestInitConfigDatabaseNative(t *testing.T) {
+	tests := []struct {
+		name    string
+		envs    map[string]string
+		wantErr bool
+	}{
+		{
+			name:    "postgres storage",
+			envs:    map[string]string{"DATABASE_NATIVE": "true", "DATABASE_DSN": "postgres://localhost/db"},
+			wantErr: false,
+		},
+		{
+			name:    "file storage",
+			envs:    map[string]string{"DATABASE_NATIVE": "true"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Args = []string{"test"}
+			flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+			for name, val := range tt.envs {
+				t.Setenv(name, val)
+			}
+			_, err := InitConfig()
+			assert.Equal(t, tt.wantErr, err != nil, "InitConfig() error = %v", err)
+		})
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const (
@@ -36,6 +37,15 @@ type Metrics struct {
 
 	// MType is the type of the metric, such as gauge or counter.
 	MType string `json:"type"`
+
+	// Labels is an optional set of key-value pairs describing the metric, e.g. its origin host.
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// UpdatedAt is the time of the last update of the metric. It is set by the server.
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+
+	// Stale is set by the server when the metric hasn't been updated for too long.
+	Stale bool `json:"stale,omitempty"`
 }
 
 // Validate checks the validity of the metric based on its type and the presence
@@ -78,3 +88,12 @@ func (m Metrics) ValueAsString() string {
 	}
 	return val
 }
+
+// IsStale reports whether the metric hasn't been updated for longer than staleAfter.
+// Metrics without an update timestamp and a zero staleAfter are never considered stale.
+func (m Metrics) IsStale(staleAfter time.Duration, now time.Time) bool {
+	if staleAfter == 0 || m.UpdatedAt == nil {
+		return false
+	}
+	return now.Sub(*m.UpdatedAt) > staleAfter
+}
@@ -3,6 +3,7 @@ package entities
 import (
 	"errors"
 	"testing"
+	"time"
 )
 
 func TestMetrics_ValueAsString(t *testing.T) {
@@ -127,6 +128,53 @@ func TestMetrics_Validate(t *testing.T) {
 	}
 }
 
+func TestMetrics_IsStale(t *testing.T) {
+	now := time.Date(2023, 11, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		updatedAt  *time.Time
+		staleAfter time.Duration
+		want       bool
+	}{
+		{
+			name:       "fresh",
+			updatedAt:  ptrtime(now.Add(-10 * time.Second)),
+			staleAfter: time.Minute,
+			want:       false,
+		},
+		{
+			name:       "stale",
+			updatedAt:  ptrtime(now.Add(-2 * time.Minute)),
+			staleAfter: time.Minute,
+			want:       true,
+		},
+		{
+			name:       "staleness_disabled",
+			updatedAt:  ptrtime(now.Add(-2 * time.Hour)),
+			staleAfter: 0,
+			want:       false,
+		},
+		{
+			name:       "no_timestamp",
+			updatedAt:  nil,
+			staleAfter: time.Minute,
+			want:       false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := Metrics{ID: "foobar", MType: TypeGauge, Value: ptrfloat64(1), UpdatedAt: tt.updatedAt}
+			if got := m.IsStale(tt.staleAfter, now); got != tt.want {
+				t.Errorf("IsStale() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func ptrtime(val time.Time) *time.Time {
+	return &val
+}
+
 func ptrfloat64(val float64) *float64 {
 	return &val
 }
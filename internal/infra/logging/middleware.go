@@ -39,6 +39,12 @@ func (w *extendedWriter) WriteHeader(status int) {
 	w.ResponseWriter.WriteHeader(status)
 }
 
+// Unwrap returns the original http.ResponseWriter, so that http.ResponseController
+// can reach its optional methods, such as Flush.
+func (w *extendedWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
 // Middleware returns a middleware function for logging HTTP requests
 // and responses. It wraps the provided http.Handler with logging
 // functionalities using the provided logger.
@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE metrics ADD COLUMN IF NOT EXISTS labels jsonb;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE metrics DROP COLUMN labels;
+-- +goose StatementEnd
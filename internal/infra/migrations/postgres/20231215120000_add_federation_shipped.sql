@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS federation_shipped (
+    id text PRIMARY KEY,
+    mtype text NOT NULL CHECK (mtype IN ('gauge', 'counter')),
+    delta bigint,
+    val double precision,
+    updated_at timestamptz
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE federation_shipped;
+-- +goose StatementEnd
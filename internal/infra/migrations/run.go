@@ -1,4 +1,5 @@
-// Package migrations contains code for launching postgresql migrations stored in the project
+// Package migrations contains code for launching the database migrations stored in the project.
+// Every supported SQL dialect has its own directory of migrations.
 package migrations
 
 import (
@@ -8,15 +9,27 @@ import (
 	"github.com/pressly/goose/v3"
 )
 
-//go:embed postgres/*.sql
+const (
+	Postgres = "postgres" // PostgreSQL migrations
+	SQLite   = "sqlite3"  // SQLite migrations
+)
+
+// directories maps the goose dialects to the directories of their migrations
+var directories = map[string]string{
+	Postgres: "postgres",
+	SQLite:   "sqlite",
+}
+
+//go:embed postgres/*.sql sqlite/*.sql
 var embedMigrations embed.FS
 
-func Migrate(db *sql.DB) {
+// Migrate applies all pending migrations of the dialect to the database.
+func Migrate(db *sql.DB, dialect string) {
 	goose.SetBaseFS(embedMigrations)
-	if err := goose.SetDialect("postgres"); err != nil {
+	if err := goose.SetDialect(dialect); err != nil {
 		panic(err)
 	}
-	if err := goose.Up(db, "postgres"); err != nil {
+	if err := goose.Up(db, directories[dialect]); err != nil {
 		panic(err)
 	}
 }
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS metrics (
+    id text PRIMARY KEY,
+    mtype text NOT NULL CHECK (mtype IN ('gauge', 'counter')),
+    delta bigint,
+    val double precision,
+    labels text
+);
+CREATE INDEX IF NOT EXISTS search_idx ON metrics(id, mtype);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX search_idx;
+DROP TABLE metrics;
+-- +goose StatementEnd
@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+-- SQLite can't add a column defaulting to the current time, the keeper stamps the metrics itself
+ALTER TABLE metrics ADD COLUMN updated_at timestamp;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE metrics DROP COLUMN updated_at;
+-- +goose StatementEnd
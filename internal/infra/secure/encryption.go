@@ -8,9 +8,12 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
 	"fmt"
 	"io"
 	"net/http"
+	"os"
 )
 
 // MiddlewareCryptoReader returns a middleware function that decrypts request body using an RSA private key
@@ -34,6 +37,36 @@ func MiddlewareCryptoReader(key *rsa.PrivateKey) func(next http.Handler) http.Ha
 	}
 }
 
+// Encrypt encrypts the payload for the holder of the RSA private key, as expected by MiddlewareCryptoReader.
+// The payload is encrypted with a random AES-256 key, which is encrypted with the RSA public key
+// and prepended to the result.
+func Encrypt(payload []byte, key *rsa.PublicKey) ([]byte, error) {
+	aesKey := make([]byte, 32) // AES-256
+	if _, err := rand.Read(aesKey); err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(aesKey)
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertext := make([]byte, aes.BlockSize+len(payload))
+	iv := ciphertext[:aes.BlockSize]
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+	stream := cipher.NewCFBEncrypter(block, iv)
+	stream.XORKeyStream(ciphertext[aes.BlockSize:], payload)
+
+	encryptedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, key, aesKey, nil)
+	if err != nil {
+		return nil, err
+	}
+	return append(encryptedKey, ciphertext...), nil
+}
+
+// Decrypt decrypts the payload encrypted by Encrypt with the RSA private key.
 func Decrypt(payload []byte, key *rsa.PrivateKey) ([]byte, error) {
 	encryptedKey, encryptedData := payload[:256], payload[256:] // RSA-2048
 	aesKey, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, key, encryptedKey, nil)
@@ -58,3 +91,32 @@ func Decrypt(payload []byte, key *rsa.PrivateKey) ([]byte, error) {
 
 	return plaintext, nil
 }
+
+// ReadPublicKey reads an RSA public key from a PEM file. Returns nil if the path is empty.
+func ReadPublicKey(path string) (*rsa.PublicKey, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode PEM block containing public key")
+	}
+
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return pub, nil
+	default:
+		return nil, fmt.Errorf("unknown type of public key")
+	}
+}
@@ -8,16 +8,12 @@ import (
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
+	"hash"
 	"io"
 	"net/http"
+	"strings"
 )
 
-// responseMetadata holds the data of an HTTP response to be hashed.
-type responseMetadata struct {
-	// data is the byte slice that stores the response data.
-	data []byte
-}
-
 // extendedWriter is a wrapper around http.ResponseWriter that adds HMAC SHA256
 // hash to the response header after writing the response body.
 type extendedWriter struct {
@@ -25,26 +21,42 @@ type extendedWriter struct {
 	// the http.ResponseWriter interface.
 	http.ResponseWriter
 
-	// response holds the metadata of the response being written.
-	response *responseMetadata
+	// mac is the HMAC SHA256 of the response data written so far.
+	mac hash.Hash
+
+	// streaming is set when the response is an event stream, which is passed through unchanged.
+	streaming bool
+}
 
-	// hmacKey is the secret key used for generating the HMAC hash.
-	hmacKey string
+// WriteHeader sends the status code, detecting event streams by their Content-Type.
+func (w *extendedWriter) WriteHeader(statusCode int) {
+	w.detectStream()
+	w.ResponseWriter.WriteHeader(statusCode)
 }
 
 // Write hashes the response data using HMAC SHA256 and writes it to the client.
-// It also sets the HashSHA256 header in the response.
+// It also sets the HashSHA256 header in the response. Event streams aren't hashed:
+// their headers are sent before the body is known, and the body never ends.
 func (w *extendedWriter) Write(b []byte) (int, error) {
-	w.response.data = append(w.response.data, b...)
-	serverHash, err := hashData([]byte(w.hmacKey), &w.response.data) // "{"id":"SD11","type":"counter","delta":1}"
-	if err != nil {
-		w.Write([]byte(err.Error()))
-		w.WriteHeader(http.StatusInternalServerError)
-		return len(err.Error()), err
+	w.detectStream()
+	if w.streaming {
+		return w.ResponseWriter.Write(b)
 	}
-	w.Header().Set("HashSHA256", serverHash)
-	size, err := w.ResponseWriter.Write(b)
-	return size, err
+	w.mac.Write(b) // never returns an error
+	w.Header().Set("HashSHA256", hex.EncodeToString(w.mac.Sum(nil)))
+	return w.ResponseWriter.Write(b)
+}
+
+// detectStream checks whether the response is an event stream
+func (w *extendedWriter) detectStream() {
+	if strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream") {
+		w.streaming = true
+	}
+}
+
+// Unwrap returns the wrapped http.ResponseWriter.
+func (w *extendedWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
 }
 
 // MiddlewareHashReader returns a middleware function that verifies the HMAC SHA256
@@ -86,15 +98,13 @@ func MiddlewareHashReader(key string) func(next http.Handler) http.Handler {
 // MiddlewareHashWriter returns a middleware function that adds an HMAC SHA256
 // hash to the response header. It uses extendedWriter to automatically hash
 // the response data and append the hash to the response headers.
+// Event streams, recognized by their Content-Type, are passed through unchanged.
 func MiddlewareHashWriter(key string) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		addHashFn := func(w http.ResponseWriter, r *http.Request) {
 			extWriter := &extendedWriter{
 				ResponseWriter: w,
-				response: &responseMetadata{
-					data: []byte{},
-				},
-				hmacKey: key,
+				mac:            hmac.New(sha256.New, []byte(key)),
 			}
 			next.ServeHTTP(extWriter, r)
 		}
@@ -111,3 +121,9 @@ func hashData(key []byte, payload *[]byte) (string, error) {
 	result := hex.EncodeToString(hash)
 	return result, nil
 }
+
+// Sign returns the HMAC SHA256 hash of the payload, as expected by MiddlewareHashReader
+// in the HashSHA256 header. It's used by the clients sending signed requests.
+func Sign(key []byte, payload []byte) (string, error) {
+	return hashData(key, &payload)
+}
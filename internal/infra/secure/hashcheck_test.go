@@ -0,0 +1,40 @@
+package secure
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddlewareHashWriter(t *testing.T) {
+	const key = "secret"
+	var streamWriter *extendedWriter
+	handler := MiddlewareHashWriter(key)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/stream" {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.WriteHeader(http.StatusOK)
+			for i := 0; i < 3; i++ {
+				w.Write([]byte("data: event\n\n")) //nolint:errcheck // the recorder doesn't fail
+			}
+			streamWriter = w.(*extendedWriter)
+			return
+		}
+		w.Write([]byte(`{"id":"SD11",`))               //nolint:errcheck // the recorder doesn't fail
+		w.Write([]byte(`"type":"counter","delta":1}`)) //nolint:errcheck // the recorder doesn't fail
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/value/", nil))
+	want, err := Sign([]byte(key), []byte(`{"id":"SD11","type":"counter","delta":1}`))
+	assert.NoError(t, err)
+	assert.Equal(t, want, w.Header().Get("HashSHA256"), "The hash must cover all the written data")
+
+	// a stream client doesn't have to send Accept: text/event-stream
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stream", nil))
+	assert.Empty(t, w.Header().Get("HashSHA256"), "Event streams must not be hashed")
+	assert.True(t, streamWriter.streaming)
+	assert.Equal(t, 3*len("data: event\n\n"), w.Body.Len())
+}
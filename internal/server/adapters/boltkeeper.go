@@ -0,0 +1,129 @@
+// Package adapters provides functionality for keeping metrics in an embedded
+// key-value database (bbolt). Every metric is stored under its own key, so single
+// updates are written without rewriting the whole state.
+package adapters
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	common "github.com/matthiasBT/monitoring/internal/infra/entities"
+	"github.com/matthiasBT/monitoring/internal/infra/logging"
+	"github.com/matthiasBT/monitoring/internal/server/entities"
+	"go.etcd.io/bbolt"
+)
+
+// metricsBucket is the name of the bucket holding the metrics
+var metricsBucket = []byte("metrics")
+
+// BoltKeeper is a struct that manages an embedded key-value database and holds a logger.
+// The metrics are stored as JSON values keyed by their IDs.
+type BoltKeeper struct {
+	DB     *bbolt.DB       // Embedded database
+	Logger logging.ILogger // Logger for logging activities
+}
+
+// OpenBolt opens the embedded database file, creating it if needed.
+func OpenBolt(path string) *bbolt.DB {
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: time.Second})
+	if err != nil {
+		panic(err)
+	}
+	return db
+}
+
+// NewBoltKeeper creates and returns a new BoltKeeper instance with the provided database
+// and logger. It creates the metrics bucket if it doesn't exist.
+func NewBoltKeeper(db *bbolt.DB, logger logging.ILogger) entities.IncrementalKeeper {
+	err := db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(metricsBucket)
+		return err
+	})
+	if err != nil {
+		panic(err)
+	}
+	return &BoltKeeper{DB: db, Logger: logger}
+}
+
+// Flush saves a snapshot of storage data (metrics) to the database in a single transaction.
+func (bk *BoltKeeper) Flush(ctx context.Context, storageSnapshot []*common.Metrics) error {
+	bk.Logger.Infoln("Starting saving the storage data")
+	if err := bk.Save(ctx, storageSnapshot); err != nil {
+		return err
+	}
+	bk.Logger.Infoln("Saving complete")
+	return nil
+}
+
+// Save writes the given metrics to the database in a single transaction,
+// leaving the other stored metrics intact.
+func (bk *BoltKeeper) Save(ctx context.Context, batch []*common.Metrics) error {
+	return bk.DB.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(metricsBucket)
+		for _, metrics := range batch {
+			value, err := json.Marshal(metrics)
+			if err != nil {
+				bk.Logger.Errorf("Failed to marshal a metric: %s, %s\n", metrics.ID, err.Error())
+				return err
+			}
+			if err := bucket.Put([]byte(metrics.ID), value); err != nil {
+				bk.Logger.Errorf("Failed to save a metric %s: %s\n", metrics.ID, err.Error())
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Delete removes the metrics with the given IDs from the database in a single transaction.
+func (bk *BoltKeeper) Delete(ctx context.Context, ids []string) error {
+	bk.Logger.Infof("Deleting %d metrics from the database\n", len(ids))
+	return bk.DB.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(metricsBucket)
+		for _, id := range ids {
+			if err := bucket.Delete([]byte(id)); err != nil {
+				bk.Logger.Errorf("Failed to delete a metric %s: %s\n", id, err.Error())
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Restore reads and returns all metrics from the database.
+func (bk *BoltKeeper) Restore() []*common.Metrics {
+	bk.Logger.Infoln("Restoring the storage data")
+	var result []*common.Metrics
+	err := bk.DB.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(metricsBucket).ForEach(func(key, value []byte) error {
+			var metrics common.Metrics
+			if err := json.Unmarshal(value, &metrics); err != nil {
+				return err
+			}
+			result = append(result, &metrics)
+			return nil
+		})
+	})
+	if err != nil {
+		bk.Logger.Errorf("Failed to restore the data: %s\n", err.Error())
+		panic(err)
+	}
+	bk.Logger.Infoln("Success")
+	return result
+}
+
+// Ping checks that the database is open and readable.
+func (bk *BoltKeeper) Ping(context.Context) error {
+	return bk.DB.View(func(tx *bbolt.Tx) error {
+		return nil
+	})
+}
+
+// Shutdown closes the database.
+func (bk *BoltKeeper) Shutdown() {
+	bk.Logger.Infoln("Closing the database")
+	if err := bk.DB.Close(); err != nil {
+		bk.Logger.Errorf("Failed to close the database: %s\n", err.Error())
+	}
+}
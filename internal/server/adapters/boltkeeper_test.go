@@ -0,0 +1,65 @@
+package adapters
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+
+	common "github.com/matthiasBT/monitoring/internal/infra/entities"
+	"github.com/matthiasBT/monitoring/internal/infra/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBoltKeeper(t *testing.T) {
+	db := OpenBolt(filepath.Join(t.TempDir(), "metrics.db"))
+	keeper := NewBoltKeeper(db, logging.SetupLogger())
+	defer keeper.Shutdown()
+	ctx := context.Background()
+
+	if err := keeper.Ping(ctx); err != nil {
+		t.Fatalf("Ping() error = %v", err)
+	}
+	snapshot := []*common.Metrics{
+		{ID: "BarFoo", MType: common.TypeGauge, Value: ptrfloat64(44.1), Labels: map[string]string{"host": "a"}},
+		{ID: "FooBar", MType: common.TypeCounter, Delta: ptrint64(3)},
+	}
+	if err := keeper.Flush(ctx, snapshot); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	update := &common.Metrics{ID: "FooBar", MType: common.TypeCounter, Delta: ptrint64(5)}
+	if err := keeper.Save(ctx, []*common.Metrics{update}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	assert.Equal(t, []*common.Metrics{snapshot[0], update}, keeper.Restore())
+
+	if err := keeper.Delete(ctx, []string{"BarFoo", "Unknown"}); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	assert.Equal(t, []*common.Metrics{update}, keeper.Restore())
+}
+
+func TestMemStorage_persistIncremental(t *testing.T) {
+	db := OpenBolt(filepath.Join(t.TempDir(), "metrics.db"))
+	keeper := NewBoltKeeper(db, logging.SetupLogger())
+	defer keeper.Shutdown()
+	stor := &MemStorage{
+		State: State{
+			Metrics: map[string]*common.Metrics{},
+			Lock:    &sync.Mutex{},
+		},
+		Logger: logging.SetupLogger(),
+		Keeper: keeper,
+	}
+	ctx := context.Background()
+	stor.Add(ctx, &common.Metrics{ID: "Foo", MType: common.TypeCounter, Delta: ptrint64(2)})
+	stor.Add(ctx, &common.Metrics{ID: "Bar", MType: common.TypeGauge, Value: ptrfloat64(1.5)})
+	stor.Add(ctx, &common.Metrics{ID: "Foo", MType: common.TypeCounter, Delta: ptrint64(3)})
+
+	restored := keeper.Restore()
+	sort.Slice(restored, func(i, j int) bool { return restored[i].ID < restored[j].ID })
+	assert.Len(t, restored, 2)
+	assert.Equal(t, 1.5, *restored[0].Value)
+	assert.Equal(t, int64(5), *restored[1].Delta)
+}
@@ -6,8 +6,11 @@ package adapters
 import (
 	"context"
 	"database/sql"
-	"errors"
+	"encoding/json"
+	"fmt"
+	"strings"
 	"sync"
+	"time"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
 	common "github.com/matthiasBT/monitoring/internal/infra/entities"
@@ -17,11 +20,20 @@ import (
 	"github.com/matthiasBT/monitoring/internal/server/entities"
 )
 
+const (
+	// metricColumns lists the columns of the metrics table in the order expected by scanMetric
+	metricColumns = "id, mtype, delta, val, labels, updated_at"
+
+	// upsertBatchSize is the maximal number of metrics in a single INSERT statement
+	upsertBatchSize = 100
+)
+
 // DBKeeper is a struct that manages database operations and holds a SQL database connection,
 // a logger for logging operations, a retrier for handling retry logic, and a mutex for
 // synchronizing operations.
 type DBKeeper struct {
 	DB      *sql.DB         // Database connection
+	Dialect *Dialect        // SQL dialect of the database, PostgreSQL if nil
 	Lock    *sync.Mutex     // Mutex for synchronization
 	Logger  logging.ILogger // Logger for logging activities
 	Retrier utils.Retrier   // Retrier for retry logic
@@ -29,7 +41,7 @@ type DBKeeper struct {
 
 // OpenDB opens a database connection
 func OpenDB(dsn string) *sql.DB {
-	db, err := sql.Open("pgx", dsn)
+	db, err := sql.Open(PostgresDialect.Driver, dsn)
 	if err != nil {
 		panic(err)
 	}
@@ -38,12 +50,12 @@ func OpenDB(dsn string) *sql.DB {
 
 // NewDBKeeper creates and returns a new DBKeeper instance with the provided database,
 // logger, and retrier. It tests the database connection and runs migrations.
-func NewDBKeeper(db *sql.DB, logger logging.ILogger, retrier utils.Retrier) entities.Keeper {
-	keeper := DBKeeper{DB: db, Logger: logger, Retrier: retrier, Lock: &sync.Mutex{}}
+func NewDBKeeper(db *sql.DB, logger logging.ILogger, retrier utils.Retrier) entities.IncrementalKeeper {
+	keeper := DBKeeper{DB: db, Dialect: PostgresDialect, Logger: logger, Retrier: retrier, Lock: &sync.Mutex{}}
 	if err := keeper.Ping(context.Background()); err != nil {
 		panic(err)
 	}
-	migrations.Migrate(db)
+	migrations.Migrate(db, migrations.Postgres)
 	return &keeper
 }
 
@@ -51,12 +63,25 @@ func NewDBKeeper(db *sql.DB, logger logging.ILogger, retrier utils.Retrier) enti
 // with retry logic for transient errors.
 func (dbk *DBKeeper) Flush(ctx context.Context, storageSnapshot []*common.Metrics) error {
 	dbk.Logger.Infoln("Starting saving the storage data")
+	if err := dbk.Save(ctx, storageSnapshot); err != nil {
+		return err
+	}
+	dbk.Logger.Infoln("Saving complete")
+	return nil
+}
 
+// Save writes the given metrics to the database within a single transaction, leaving the other
+// stored metrics intact. The metrics are upserted in batches of multi-row INSERT statements.
+// IDs of the metrics must be unique.
+func (dbk *DBKeeper) Save(ctx context.Context, batch []*common.Metrics) error {
+	if len(batch) == 0 {
+		return nil
+	}
 	dbk.Lock.Lock()
 	defer dbk.Lock.Unlock()
 
 	txOpt := sql.TxOptions{
-		Isolation: sql.LevelReadCommitted,
+		Isolation: dbk.Dialect.isolation(),
 		ReadOnly:  false,
 	}
 
@@ -66,19 +91,65 @@ func (dbk *DBKeeper) Flush(ctx context.Context, storageSnapshot []*common.Metric
 	txAny, err := dbk.Retrier.RetryChecked(ctx, f, utils.CheckConnectionError)
 	if err != nil {
 		dbk.Logger.Errorf("Failed to open a transaction: %s\n", err.Error())
+		return err
 	}
 	var tx = txAny.(*sql.Tx)
-	//nolint:errcheck
-	defer tx.Commit()
 
-	for _, metrics := range storageSnapshot {
-		if _, err := dbk.addSingle(ctx, tx, metrics); err != nil {
-			dbk.Logger.Errorf("Failed to update a metric from snapshot: %s\n", err.Error())
+	// the values are absolute, so they must overwrite the stored ones instead of adding to counters
+	for start := 0; start < len(batch); start += upsertBatchSize {
+		end := start + upsertBatchSize
+		if end > len(batch) {
+			end = len(batch)
+		}
+		if err := dbk.upsert(ctx, tx, batch[start:end]); err != nil {
+			dbk.Logger.Errorf("Failed to save metrics: %s\n", err.Error())
 			tx.Rollback()
 			return err
 		}
 	}
-	dbk.Logger.Infoln("Saving complete")
+	if err := tx.Commit(); err != nil {
+		dbk.Logger.Errorf("Failed to commit the metrics: %s\n", err.Error())
+		return err
+	}
+	dbk.Logger.Infof("Saved %d metrics\n", len(batch))
+	return nil
+}
+
+// Delete removes the metrics with the given IDs from the database within a single transaction,
+// with retry logic for transient errors.
+func (dbk *DBKeeper) Delete(ctx context.Context, ids []string) error {
+	dbk.Logger.Infof("Deleting %d metrics from the database\n", len(ids))
+
+	dbk.Lock.Lock()
+	defer dbk.Lock.Unlock()
+
+	txOpt := sql.TxOptions{
+		Isolation: dbk.Dialect.isolation(),
+		ReadOnly:  false,
+	}
+
+	f := func() (any, error) {
+		return dbk.DB.BeginTx(ctx, &txOpt)
+	}
+	txAny, err := dbk.Retrier.RetryChecked(ctx, f, utils.CheckConnectionError)
+	if err != nil {
+		dbk.Logger.Errorf("Failed to open a transaction: %s\n", err.Error())
+		return err
+	}
+	var tx = txAny.(*sql.Tx)
+
+	for _, id := range ids {
+		if _, err := tx.ExecContext(ctx, dbk.Dialect.Rebind("DELETE FROM metrics WHERE id = $1"), id); err != nil {
+			dbk.Logger.Errorf("Failed to delete a metric %s: %s\n", id, err.Error())
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		dbk.Logger.Errorf("Failed to commit the deletion: %s\n", err.Error())
+		return err
+	}
+	dbk.Logger.Infoln("Deletion complete")
 	return nil
 }
 
@@ -89,7 +160,7 @@ func (dbk *DBKeeper) Restore() []*common.Metrics {
 	ctx := context.Background()
 
 	f := func() (any, error) {
-		rows, err := dbk.DB.QueryContext(ctx, "SELECT * FROM metrics")
+		rows, err := dbk.DB.QueryContext(ctx, "SELECT "+metricColumns+" FROM metrics")
 		if err != nil {
 			return nil, err
 		}
@@ -109,7 +180,7 @@ func (dbk *DBKeeper) Restore() []*common.Metrics {
 	defer rows.Close()
 	for rows.Next() {
 		var metrics common.Metrics
-		if err = scanSingleMetric(rows, &metrics); err != nil {
+		if err = scanMetric(rows, &metrics); err != nil {
 			dbk.Logger.Errorf("Failed to scan metric: %s\n", err.Error())
 			panic(err)
 		}
@@ -122,136 +193,60 @@ func (dbk *DBKeeper) Restore() []*common.Metrics {
 	return result
 }
 
-func (dbk *DBKeeper) addSingle(ctx context.Context, tx *sql.Tx, update *common.Metrics) (*common.Metrics, error) {
-	dbk.Logger.Infof("Updating a metric %s %s\n", update.ID, update.MType)
-
-	metrics, err := dbk.get(ctx, tx, update)
-	if err != nil {
-		return nil, err
-	}
-
-	if metrics == nil {
-		dbk.Logger.Infoln("Creating a new metric")
-		if err := dbk.create(ctx, tx, update); err != nil {
-			return nil, err
-		}
-		return update, nil
-	}
-
-	if result, err := dbk.update(ctx, tx, update); err != nil {
-		return nil, err
-	} else {
-		return result, nil
-	}
-}
-
-func (dbk *DBKeeper) get(ctx context.Context, tx *sql.Tx, search *common.Metrics) (*common.Metrics, error) {
-	query := "SELECT * FROM metrics WHERE id = $1 AND mtype = $2"
-	var row *sql.Row
-	if tx != nil {
-		row = tx.QueryRowContext(ctx, query, search.ID, search.MType)
-	} else {
-		stmt, err := dbk.prepareStatement(ctx, query)
+// upsert inserts or overwrites the metrics with a single multi-row statement.
+// The metrics which have never been updated are stamped with the current time.
+func (dbk *DBKeeper) upsert(ctx context.Context, tx *sql.Tx, batch []*common.Metrics) error {
+	now := time.Now()
+	var query strings.Builder
+	query.WriteString("INSERT INTO metrics(" + metricColumns + ") VALUES ")
+	args := make([]any, 0, len(batch)*6)
+	for i, metrics := range batch {
+		labels, err := marshalLabels(metrics.Labels)
 		if err != nil {
-			return nil, err
+			dbk.Logger.Errorf("Failed to marshal labels of %s: %s\n", metrics.ID, err.Error())
+			return err
 		}
-		defer stmt.Close()
-		row = stmt.QueryRowContext(ctx, search.ID, search.MType)
-	}
-	var result common.Metrics
-	if err := scanMetric(row, &result); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			dbk.Logger.Infof("No row found with ID %s and type %s\n", search.ID, search.MType)
-			return nil, nil
-		} else {
-			dbk.Logger.Errorf("Failed to find metric %s %s\n", search.ID, search.MType, err.Error())
-			return nil, err
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		updatedAt := now
+		if metrics.UpdatedAt != nil {
+			updatedAt = *metrics.UpdatedAt
 		}
+		n := len(args)
+		fmt.Fprintf(&query, "($%d, $%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5, n+6)
+		args = append(args, metrics.ID, metrics.MType, metrics.Delta, metrics.Value, labels, updatedAt)
 	}
-	return &result, nil
+	query.WriteString(`
+		ON CONFLICT (id) DO UPDATE
+		SET mtype = excluded.mtype, delta = excluded.delta, val = excluded.val, labels = excluded.labels,
+			updated_at = excluded.updated_at`)
+	_, err := tx.ExecContext(ctx, dbk.Dialect.Rebind(query.String()), args...)
+	return err
 }
 
-func (dbk *DBKeeper) create(ctx context.Context, tx *sql.Tx, create *common.Metrics) error {
-	query := `
-		INSERT INTO metrics(id, mtype, delta, val)
-		VALUES ($1, $2, $3, $4)
-		ON CONFLICT (id) DO UPDATE
-		SET mtype = excluded.mtype, delta = excluded.delta, val = excluded.val
-		WHERE metrics.id = excluded.id
-		RETURNING *
-	`
-	var err error
-	if tx == nil {
-		f := func() (any, error) {
-			return dbk.DB.ExecContext(ctx, query, create.ID, create.MType, create.Delta, create.Value)
-		}
-		_, err = dbk.Retrier.RetryChecked(ctx, f, utils.CheckConnectionError)
-	} else {
-		_, err = tx.ExecContext(ctx, query, create.ID, create.MType, create.Delta, create.Value)
-	}
+func scanMetric(rows *sql.Rows, result *common.Metrics) error {
+	var labels []byte
+	err := rows.Scan(&result.ID, &result.MType, &result.Delta, &result.Value, &labels, &result.UpdatedAt)
 	if err != nil {
-		dbk.Logger.Errorf("Failed to create a new metric %s\n", err.Error())
 		return err
 	}
-	dbk.Logger.Infof("Created: %s %s\n", create.ID, create.MType)
-	return nil
+	return unmarshalLabels(labels, result)
 }
 
-func (dbk *DBKeeper) update(ctx context.Context, tx *sql.Tx, update *common.Metrics) (*common.Metrics, error) {
-	var row *sql.Row
-	if update.MType == common.TypeCounter {
-		query := "UPDATE metrics SET delta = delta + $1 WHERE id = $2 RETURNING *"
-		if tx == nil {
-			stmt, err := dbk.prepareStatement(ctx, query)
-			if err != nil {
-				return nil, err
-			}
-			defer stmt.Close()
-			row = stmt.QueryRowContext(ctx, update.Delta, update.ID)
-		} else {
-			row = tx.QueryRowContext(ctx, query, update.Delta, update.ID)
-		}
-	} else {
-		query := "UPDATE metrics SET val = $1 WHERE id = $2 RETURNING *"
-		if tx == nil {
-			stmt, err := dbk.prepareStatement(ctx, query)
-			if err != nil {
-				return nil, err
-			}
-			defer stmt.Close()
-			row = stmt.QueryRowContext(ctx, update.Value, update.ID)
-		} else {
-			row = tx.QueryRowContext(ctx, query, update.Value, update.ID)
-		}
-	}
-
-	var result common.Metrics
-	if err := scanMetric(row, &result); err != nil {
-		dbk.Logger.Errorf("Failed to update metric %s %s\n", update.ID, err.Error())
-		return nil, err
+// marshalLabels converts metric labels to a value of the jsonb column, storing NULL for no labels
+func marshalLabels(labels map[string]string) (any, error) {
+	if len(labels) == 0 {
+		return nil, nil
 	}
-	dbk.Logger.Infof("Updated: %s %s\n", update.ID, update.MType)
-	return &result, nil
+	return json.Marshal(labels)
 }
 
-func (dbk *DBKeeper) prepareStatement(ctx context.Context, query string) (*sql.Stmt, error) {
-	f := func() (any, error) {
-		return dbk.DB.PrepareContext(ctx, query)
-	}
-	stmtAny, err := dbk.Retrier.RetryChecked(ctx, f, utils.CheckConnectionError)
-	if err != nil {
-		dbk.Logger.Errorf("Failed to open a statement: %s\n", err.Error())
-		return nil, err
+func unmarshalLabels(labels []byte, result *common.Metrics) error {
+	if labels == nil {
+		return nil
 	}
-	return stmtAny.(*sql.Stmt), nil
-}
-
-func scanMetric(row *sql.Row, result *common.Metrics) error {
-	return row.Scan(&result.ID, &result.MType, &result.Delta, &result.Value)
-}
-
-func scanSingleMetric(rows *sql.Rows, result *common.Metrics) error {
-	return rows.Scan(&result.ID, &result.MType, &result.Delta, &result.Value)
+	return json.Unmarshal(labels, &result.Labels)
 }
 
 // Shutdown closes the database connection and logs any errors encountered during the operation.
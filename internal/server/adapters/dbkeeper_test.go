@@ -2,7 +2,7 @@ package adapters
 
 import (
 	"context"
-	"database/sql"
+	"database/sql/driver"
 	"errors"
 	"fmt"
 	"reflect"
@@ -17,37 +17,95 @@ import (
 	"github.com/matthiasBT/monitoring/internal/infra/utils"
 )
 
-// todo
 func TestDBKeeper_Flush(t *testing.T) {
-	type fields struct {
-		DB      *sql.DB
-		Logger  logging.ILogger
-		Retrier utils.Retrier
-		Lock    *sync.Mutex
-	}
-	type args struct {
-		ctx             context.Context
-		storageSnapshot []*common.Metrics
+	updatedAt := time.Date(2023, 12, 1, 12, 0, 0, 0, time.UTC)
+	batch := make([]*common.Metrics, upsertBatchSize+1)
+	for i := range batch {
+		batch[i] = &common.Metrics{ID: fmt.Sprintf("Foo%d", i), MType: common.TypeCounter, Delta: ptrint64(int64(i))}
 	}
 	tests := []struct {
-		name    string
-		fields  fields
-		args    args
-		wantErr bool
+		name        string
+		snapshot    []*common.Metrics
+		wantUpserts []int
+		wantErr     error
 	}{
-		// TODO: Add test cases.
+		{
+			name:        "empty_snapshot_is_noop",
+			snapshot:    nil,
+			wantUpserts: nil,
+		},
+		{
+			name: "single_statement",
+			snapshot: []*common.Metrics{
+				{ID: "Foo", MType: common.TypeCounter, Delta: ptrint64(3)},
+				{
+					ID: "Bar", MType: common.TypeGauge, Value: ptrfloat64(1.5), Labels: map[string]string{"host": "a"},
+					UpdatedAt: &updatedAt,
+				},
+			},
+			wantUpserts: []int{2},
+		},
+		{
+			name:        "split_into_batches",
+			snapshot:    batch,
+			wantUpserts: []int{upsertBatchSize, 1},
+		},
+		{
+			name: "upsert_failure_rolls_back",
+			snapshot: []*common.Metrics{
+				{ID: "Foo", MType: common.TypeCounter, Delta: ptrint64(3)},
+			},
+			wantUpserts: []int{1},
+			wantErr:     fmt.Errorf("fake error"),
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("Error creating mock DB: %v", err)
+			}
+			defer db.Close()
+
+			if tt.wantUpserts != nil {
+				mock.ExpectBegin()
+			}
+			offset := 0
+			for _, size := range tt.wantUpserts {
+				args := make([]driver.Value, 0, size*6)
+				for _, metrics := range tt.snapshot[offset : offset+size] {
+					labels, _ := marshalLabels(metrics.Labels)
+					var stamp driver.Value = sqlmock.AnyArg() // the metrics which have never been updated get the current time
+					if metrics.UpdatedAt != nil {
+						stamp = *metrics.UpdatedAt
+					}
+					args = append(args, metrics.ID, metrics.MType, metrics.Delta, metrics.Value, labels, stamp)
+				}
+				offset += size
+				query := `INSERT INTO metrics\(` + metricColumns + `\) VALUES .+ updated_at = excluded.updated_at`
+				exec := mock.ExpectExec(query).WithArgs(args...)
+				if tt.wantErr != nil {
+					exec.WillReturnError(tt.wantErr)
+					mock.ExpectRollback()
+				} else {
+					exec.WillReturnResult(sqlmock.NewResult(0, int64(size)))
+				}
+			}
+			if tt.wantUpserts != nil && tt.wantErr == nil {
+				mock.ExpectCommit()
+			}
 			dbk := &DBKeeper{
-				DB:      tt.fields.DB,
-				Logger:  tt.fields.Logger,
-				Retrier: tt.fields.Retrier,
-				Lock:    tt.fields.Lock,
+				DB:      db,
+				Logger:  logging.SetupLogger(),
+				Retrier: utils.Retrier{Logger: logging.SetupLogger()},
+				Lock:    &sync.Mutex{},
 			}
-			if err := dbk.Flush(tt.args.ctx, tt.args.storageSnapshot); (err != nil) != tt.wantErr {
+			if err := dbk.Flush(context.Background(), tt.snapshot); !errors.Is(err, tt.wantErr) {
 				t.Errorf("Flush() error = %v, wantErr %v", err, tt.wantErr)
 			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unfulfilled expectations: %s", err)
+			}
 		})
 	}
 }
@@ -161,13 +219,15 @@ func TestDBKeeper_Restore(t *testing.T) {
 				t.Fatalf("Error creating mock database: %v", err)
 			}
 			defer db.Close()
-			rows := sqlmock.NewRows([]string{"ID", "MType", "Delta", "Value"}).
-				AddRow("foo", "counter", "4", nil).
-				AddRow("bar", "gauge", nil, "3.2")
+			// the rows added to SQLite before the updated_at column have no update time
+			rows := sqlmock.NewRows([]string{"ID", "MType", "Delta", "Value", "Labels", "UpdatedAt"}).
+				AddRow("foo", "counter", "4", nil, nil, metricsUpdatedAt).
+				AddRow("bar", "gauge", nil, "3.2", []byte(`{"host":"a"}`), nil)
+			query := regexp.QuoteMeta("SELECT id, mtype, delta, val, labels, updated_at FROM metrics")
 			if tt.wantErr == nil {
-				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM metrics")).WillReturnRows(rows)
+				mock.ExpectQuery(query).WillReturnRows(rows)
 			} else {
-				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM metrics")).WillReturnError(tt.wantErr)
+				mock.ExpectQuery(query).WillReturnError(tt.wantErr)
 			}
 			dbk := &DBKeeper{
 				DB:      db,
@@ -269,162 +329,43 @@ func TestDBKeeper_Shutdown(t *testing.T) {
 	}
 }
 
-// todo
-func TestDBKeeper_addSingle(t *testing.T) {
-	type fields struct {
-		DB      *sql.DB
-		Logger  logging.ILogger
-		Retrier utils.Retrier
-		Lock    *sync.Mutex
-	}
-	type args struct {
-		ctx    context.Context
-		tx     *sql.Tx
-		update *common.Metrics
-	}
-	tests := []struct {
-		name    string
-		fields  fields
-		args    args
-		want    *common.Metrics
-		wantErr bool
-	}{
-		// TODO: Add test cases.
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			dbk := &DBKeeper{
-				DB:      tt.fields.DB,
-				Logger:  tt.fields.Logger,
-				Retrier: tt.fields.Retrier,
-				Lock:    tt.fields.Lock,
-			}
-			got, err := dbk.addSingle(tt.args.ctx, tt.args.tx, tt.args.update)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("addSingle() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
-			if !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("addSingle() got = %v, want %v", got, tt.want)
-			}
-		})
-	}
-}
+// metricsUpdatedAt is the update time of the counter returned by getMetricsRows
+var metricsUpdatedAt = time.Date(2023, 12, 1, 12, 0, 0, 0, time.UTC)
 
-func TestDBKeeper_create(t *testing.T) {
-	tests := []struct {
-		name   string
-		ctx    context.Context
-		tx     bool
-		create *common.Metrics
-	}{
-		{
-			name: "create_with_tx",
-			create: &common.Metrics{
-				Delta: ptrint64(10),
-				Value: nil,
-				ID:    "ctr",
-				MType: common.TypeCounter,
-			},
-			tx: true,
-		},
-		{
-			name: "create_without_tx",
-			create: &common.Metrics{
-				Delta: nil,
-				Value: ptrfloat64(4.5),
-				ID:    "gg",
-				MType: common.TypeGauge,
-			},
-			tx: false,
-		},
+func getMetricsRows() []*common.Metrics {
+	updatedAt := metricsUpdatedAt
+	counter := common.Metrics{
+		ID:        "foo",
+		MType:     "counter",
+		Delta:     ptrint64(4),
+		Value:     nil,
+		UpdatedAt: &updatedAt,
 	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			db, mock, err := sqlmock.New()
-			if err != nil {
-				t.Fatalf("Error creating mock database: %v", err)
-			}
-			var tx *sql.Tx
-			if tt.tx {
-				mock.ExpectBegin()
-				tx, err = db.BeginTx(context.Background(), &sql.TxOptions{
-					Isolation: sql.LevelReadCommitted,
-					ReadOnly:  false,
-				})
-				if err != nil {
-					t.Errorf("Failed to start a transaction: %v", err)
-				}
-			}
-			defer db.Close()
-			dbk := &DBKeeper{
-				DB:     db,
-				Logger: logging.SetupLogger(),
-				Retrier: utils.Retrier{
-					Attempts:         2,
-					IntervalFirst:    100 * time.Millisecond,
-					IntervalIncrease: 100 * time.Millisecond,
-					Logger:           logging.SetupLogger(),
-				},
-				Lock: &sync.Mutex{},
-			}
-			query := regexp.QuoteMeta(`
-    	INSERT INTO metrics(id, mtype, delta, val)
-    	VALUES ($1, $2, $3, $4)
-    	ON CONFLICT (id) DO UPDATE
-    	SET mtype = excluded.mtype, delta = excluded.delta, val = excluded.val
-    	WHERE metrics.id = excluded.id
-    	RETURNING *
-    `)
-			mock.
-				ExpectExec(query).
-				WithArgs(tt.create.ID, tt.create.MType, tt.create.Delta, tt.create.Value).
-				WillReturnResult(sqlmock.NewResult(1, 1))
-			if err := dbk.create(context.Background(), tx, tt.create); err != nil {
-				t.Errorf("create() error = %v", err)
-			}
-		})
+	gauge := common.Metrics{
+		ID:     "bar",
+		MType:  "gauge",
+		Delta:  nil,
+		Value:  ptrfloat64(3.2),
+		Labels: map[string]string{"host": "a"},
 	}
+	return []*common.Metrics{&counter, &gauge}
 }
 
-func TestDBKeeper_get(t *testing.T) {
-	type fields struct {
-		Retrier utils.Retrier
-		Lock    *sync.Mutex
-	}
+func TestDBKeeper_Delete(t *testing.T) {
 	tests := []struct {
 		name    string
-		fields  fields
-		want    *common.Metrics
+		ids     []string
 		wantErr error
 	}{
 		{
-			name: "one_row",
-			fields: fields{
-				Retrier: utils.Retrier{
-					Attempts:         2,
-					IntervalFirst:    100 * time.Millisecond,
-					IntervalIncrease: 100 * time.Millisecond,
-					Logger:           logging.SetupLogger(),
-				},
-				Lock: &sync.Mutex{},
-			},
-			want:    getMetricsRows()[0],
+			name:    "delete_success",
+			ids:     []string{"foo", "bar"},
 			wantErr: nil,
 		},
 		{
-			name: "no_rows",
-			fields: fields{
-				Retrier: utils.Retrier{
-					Attempts:         2,
-					IntervalFirst:    100 * time.Millisecond,
-					IntervalIncrease: 100 * time.Millisecond,
-					Logger:           logging.SetupLogger(),
-				},
-				Lock: &sync.Mutex{},
-			},
-			want:    nil,
-			wantErr: nil,
+			name:    "delete_failure",
+			ids:     []string{"foo", "bar"},
+			wantErr: fmt.Errorf("fake error"),
 		},
 	}
 	for _, tt := range tests {
@@ -434,33 +375,24 @@ func TestDBKeeper_get(t *testing.T) {
 				t.Fatalf("Error creating mock database: %v", err)
 			}
 			defer db.Close()
-			rows := sqlmock.NewRows([]string{"ID", "MType", "Delta", "Value"}).
-				AddRow("foo", "counter", "4", nil)
-			query := regexp.QuoteMeta("SELECT * FROM metrics WHERE id = $1 AND mtype = $2")
-			mock.ExpectPrepare(query)
-			if tt.want != nil {
-				mock.ExpectQuery(query).WillReturnRows(rows)
-			} else {
-				mock.ExpectQuery(query).WillReturnRows(sqlmock.NewRows([]string{}))
-			}
 			dbk := &DBKeeper{
 				DB:      db,
 				Logger:  logging.SetupLogger(),
-				Retrier: tt.fields.Retrier,
-				Lock:    tt.fields.Lock,
-			}
-			search := &common.Metrics{
-				ID:    "foo",
-				MType: "counter",
-				Delta: ptrint64(4),
-				Value: nil,
+				Retrier: utils.Retrier{Logger: logging.SetupLogger()},
+				Lock:    &sync.Mutex{},
 			}
-			got, err := dbk.get(context.Background(), nil, search)
-			if !errors.Is(err, tt.wantErr) {
-				t.Errorf("Got error: %v, want error: %v", err, tt.wantErr)
+			query := regexp.QuoteMeta("DELETE FROM metrics WHERE id = $1")
+			mock.ExpectBegin()
+			mock.ExpectExec(query).WithArgs(tt.ids[0]).WillReturnResult(sqlmock.NewResult(0, 1))
+			if tt.wantErr == nil {
+				mock.ExpectExec(query).WithArgs(tt.ids[1]).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			} else {
+				mock.ExpectExec(query).WithArgs(tt.ids[1]).WillReturnError(tt.wantErr)
+				mock.ExpectRollback()
 			}
-			if !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("Restore() = %v, want %v", got, tt.want)
+			if err := dbk.Delete(context.Background(), tt.ids); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Delete() error = %v, wantErr %v", err, tt.wantErr)
 			}
 			if err := mock.ExpectationsWereMet(); err != nil {
 				t.Errorf("Unfulfilled expectations: %s", err)
@@ -468,61 +400,3 @@ func TestDBKeeper_get(t *testing.T) {
 		})
 	}
 }
-
-// todo
-func TestDBKeeper_update(t *testing.T) {
-	type fields struct {
-		DB      *sql.DB
-		Logger  logging.ILogger
-		Retrier utils.Retrier
-		Lock    *sync.Mutex
-	}
-	type args struct {
-		ctx    context.Context
-		tx     *sql.Tx
-		update *common.Metrics
-	}
-	tests := []struct {
-		name    string
-		fields  fields
-		args    args
-		want    *common.Metrics
-		wantErr bool
-	}{
-		// TODO: Add test cases.
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			dbk := &DBKeeper{
-				DB:      tt.fields.DB,
-				Logger:  tt.fields.Logger,
-				Retrier: tt.fields.Retrier,
-				Lock:    tt.fields.Lock,
-			}
-			got, err := dbk.update(tt.args.ctx, tt.args.tx, tt.args.update)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("update() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
-			if !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("update() got = %v, want %v", got, tt.want)
-			}
-		})
-	}
-}
-
-func getMetricsRows() []*common.Metrics {
-	counter := common.Metrics{
-		ID:    "foo",
-		MType: "counter",
-		Delta: ptrint64(4),
-		Value: nil,
-	}
-	gauge := common.Metrics{
-		ID:    "bar",
-		MType: "gauge",
-		Delta: nil,
-		Value: ptrfloat64(3.2),
-	}
-	return []*common.Metrics{&counter, &gauge}
-}
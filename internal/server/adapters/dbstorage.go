@@ -0,0 +1,460 @@
+// Package adapters provides the Storage implementation which uses PostgreSQL as the source of truth.
+// Unlike MemStorage, it keeps no state in memory, so that multiple server replicas
+// can share one database consistently.
+package adapters
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	common "github.com/matthiasBT/monitoring/internal/infra/entities"
+	"github.com/matthiasBT/monitoring/internal/infra/logging"
+	"github.com/matthiasBT/monitoring/internal/infra/migrations"
+	"github.com/matthiasBT/monitoring/internal/infra/utils"
+	"github.com/matthiasBT/monitoring/internal/server/entities"
+)
+
+// addQuery inserts a metric or updates the stored one in a single atomic statement.
+// Counters of the same type are incremented in place, so concurrent updates from several
+// replicas are never lost. A metric of another type is replaced. Labels are kept if the update has none.
+const addQuery = `
+	INSERT INTO metrics(` + metricColumns + `)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	ON CONFLICT (id) DO UPDATE SET
+		delta = CASE
+			WHEN metrics.mtype = excluded.mtype AND excluded.mtype = 'counter' THEN metrics.delta + excluded.delta
+			ELSE excluded.delta
+		END,
+		val = excluded.val,
+		labels = CASE
+			WHEN metrics.mtype = excluded.mtype THEN COALESCE(excluded.labels, metrics.labels)
+			ELSE excluded.labels
+		END,
+		mtype = excluded.mtype,
+		updated_at = excluded.updated_at
+	RETURNING ` + metricColumns
+
+// queryer is implemented by both database connections and transactions.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// DBStorage is a Storage which reads and writes the metrics directly in a PostgreSQL database.
+// The history and the event streams are kept in memory, so they only cover the updates
+// received by this replica.
+type DBStorage struct {
+	DB         *sql.DB         // Database connection
+	Logger     logging.ILogger // Logger for logging activities
+	Retrier    utils.Retrier   // Retrier for retry logic
+	StaleAfter time.Duration   // Time without updates after which a metric is considered stale
+	History    *History        // Recent values of the metrics updated by this replica
+	Hub        *Hub            // Hub notifying the subscribers about metric changes made by this replica
+}
+
+// NewDBStorage creates and returns a new DBStorage instance.
+// It tests the database connection and runs migrations.
+func NewDBStorage(
+	db *sql.DB,
+	logger logging.ILogger,
+	retrier utils.Retrier,
+	staleAfter time.Duration,
+	history *History,
+	hub *Hub,
+) entities.Storage {
+	storage := DBStorage{
+		DB:         db,
+		Logger:     logger,
+		Retrier:    retrier,
+		StaleAfter: staleAfter,
+		History:    history,
+		Hub:        hub,
+	}
+	if err := storage.Ping(context.Background()); err != nil {
+		panic(err)
+	}
+	migrations.Migrate(db, migrations.Postgres)
+	return &storage
+}
+
+// Add adds or updates a single metric in the database.
+func (storage *DBStorage) Add(ctx context.Context, update *common.Metrics) (*common.Metrics, error) {
+	return storage.addSingle(ctx, storage.DB, update)
+}
+
+// AddBatch adds a batch of metrics to the database within a single transaction.
+// The metrics are upserted in the order of their IDs, so that concurrent batches lock the rows
+// in the same order and can't deadlock. The updates of the same metric keep their order.
+func (storage *DBStorage) AddBatch(ctx context.Context, batch []*common.Metrics) error {
+	sorted := make([]*common.Metrics, len(batch))
+	copy(sorted, batch)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+
+	f := func() (any, error) {
+		return storage.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	}
+	txAny, err := storage.Retrier.RetryChecked(ctx, f, utils.CheckConnectionError)
+	if err != nil {
+		storage.Logger.Errorf("Failed to open a transaction: %s\n", err.Error())
+		return err
+	}
+	var tx = txAny.(*sql.Tx)
+
+	var added []*common.Metrics
+	for _, metrics := range sorted {
+		result, err := storage.addSingle(ctx, tx, metrics)
+		if err != nil {
+			storage.Logger.Errorf("Failed to add metric from batch: %s\n", err.Error())
+			tx.Rollback()
+			return err
+		}
+		added = append(added, result)
+	}
+	if err := tx.Commit(); err != nil {
+		storage.Logger.Errorf("Failed to commit the batch: %s\n", err.Error())
+		return err
+	}
+	for _, metrics := range added {
+		storage.recordUpdate(metrics)
+	}
+	return nil
+}
+
+// Get retrieves a single metric from the database based on query criteria.
+func (storage *DBStorage) Get(ctx context.Context, query *common.Metrics) (*common.Metrics, error) {
+	storage.Logger.Infof("Getting the metric %s %s\n", query.ID, query.MType)
+	result, err := storage.query(
+		ctx, "SELECT "+metricColumns+" FROM metrics WHERE id = $1 AND mtype = $2", query.ID, query.MType,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(result) == 0 {
+		storage.Logger.Errorf("No such metric\n")
+		return nil, common.ErrUnknownMetric
+	}
+	return result[0], nil
+}
+
+// GetAll returns all metrics stored in the database with their staleness flags set.
+func (storage *DBStorage) GetAll(ctx context.Context) (map[string]*common.Metrics, error) {
+	rows, err := storage.query(ctx, "SELECT "+metricColumns+" FROM metrics")
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]*common.Metrics, len(rows))
+	for _, metrics := range rows {
+		result[metrics.ID] = metrics
+	}
+	return result, nil
+}
+
+// GetHistory returns the recent values of a metric recorded by this replica within [from, to].
+func (storage *DBStorage) GetHistory(
+	ctx context.Context, query *common.Metrics, from, to time.Time,
+) ([]entities.Sample, error) {
+	storage.Logger.Infof("Getting the history of the metric %s %s\n", query.ID, query.MType)
+	return storage.History.Query(query, from, to)
+}
+
+// Subscribe returns a channel of the changes of the metrics selected by the filter.
+// The channel is closed after the context is cancelled.
+func (storage *DBStorage) Subscribe(ctx context.Context, filter *entities.Filter) <-chan entities.Event {
+	return storage.Hub.Subscribe(ctx, filter)
+}
+
+// Delete removes a single metric from the database.
+func (storage *DBStorage) Delete(ctx context.Context, query *common.Metrics) error {
+	storage.Logger.Infof("Deleting the metric %s %s\n", query.ID, query.MType)
+	// not retried: if the response is lost, the repeated statement finds nothing to delete
+	deleted, err := storage.selectMetrics(
+		ctx,
+		storage.DB,
+		"DELETE FROM metrics WHERE id = $1 AND mtype = $2 RETURNING "+metricColumns,
+		query.ID,
+		query.MType,
+	)
+	if err != nil {
+		storage.Logger.Errorf("Failed to delete the metric: %s\n", err.Error())
+		return err
+	}
+	if len(deleted) == 0 {
+		storage.Logger.Errorf("No such metric\n")
+		return common.ErrUnknownMetric
+	}
+	storage.recordDelete(deleted)
+	return nil
+}
+
+// DeleteMatching removes all metrics selected by the filter from the database. The conditions on the IDs,
+// the type and the prefix are checked by the database, so a filter made of them only deletes with a single
+// statement. The regular expression and the label matchers are checked here on the candidates selected
+// by the database, which are then deleted with a single statement as well. No rows are locked meanwhile:
+// a candidate replaced by another replica in between is deleted only if it still satisfies the SQL conditions.
+func (storage *DBStorage) DeleteMatching(ctx context.Context, filter *entities.Filter) (int, error) {
+	if filter.IsEmpty() {
+		return storage.Truncate(ctx)
+	}
+	conditions, args := filterConditions(filter)
+	if filter.Regex != nil || len(filter.Labels) > 0 {
+		candidates, err := storage.selectMetrics(
+			ctx, storage.DB, "SELECT "+metricColumns+" FROM metrics"+whereClause(conditions), args...,
+		)
+		if err != nil {
+			storage.Logger.Errorf("Failed to select the metrics to delete: %s\n", err.Error())
+			return 0, err
+		}
+		var ids []string
+		for _, metrics := range candidates {
+			if filter.Match(metrics) {
+				ids = append(ids, metrics.ID)
+			}
+		}
+		if len(ids) == 0 {
+			storage.Logger.Infof("Deleted 0 metrics\n")
+			return 0, nil
+		}
+		args = append(args, ids)
+		conditions = append(conditions, fmt.Sprintf("id = ANY($%d)", len(args)))
+	}
+	// not retried, see Delete
+	deleted, err := storage.selectMetrics(
+		ctx, storage.DB, "DELETE FROM metrics"+whereClause(conditions)+" RETURNING "+metricColumns, args...,
+	)
+	if err != nil {
+		storage.Logger.Errorf("Failed to delete the metrics: %s\n", err.Error())
+		return 0, err
+	}
+	storage.Logger.Infof("Deleted %d metrics\n", len(deleted))
+	storage.recordDelete(deleted)
+	return len(deleted), nil
+}
+
+// Truncate removes all metrics from the database.
+func (storage *DBStorage) Truncate(ctx context.Context) (int, error) {
+	storage.Logger.Infoln("Truncating the storage")
+	// not retried, see Delete
+	deleted, err := storage.selectMetrics(ctx, storage.DB, "DELETE FROM metrics RETURNING "+metricColumns)
+	if err != nil {
+		storage.Logger.Errorf("Failed to truncate the storage: %s\n", err.Error())
+		return 0, err
+	}
+	storage.recordDelete(deleted)
+	return len(deleted), nil
+}
+
+// ResetCounter sets the value of an existing counter to zero.
+func (storage *DBStorage) ResetCounter(ctx context.Context, name string) (*common.Metrics, error) {
+	storage.Logger.Infof("Resetting the counter %s\n", name)
+	result, err := storage.selectMetrics(
+		ctx,
+		storage.DB,
+		"UPDATE metrics SET delta = 0, updated_at = $1 WHERE id = $2 AND mtype = $3 RETURNING "+metricColumns,
+		time.Now(),
+		name,
+		common.TypeCounter,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(result) == 0 {
+		storage.Logger.Errorf("No such counter\n")
+		return nil, common.ErrUnknownMetric
+	}
+	storage.recordUpdate(result[0])
+	return result[0], nil
+}
+
+// Snapshot returns all metrics stored in the database.
+func (storage *DBStorage) Snapshot(ctx context.Context) ([]*common.Metrics, error) {
+	return storage.query(ctx, "SELECT "+metricColumns+" FROM metrics")
+}
+
+// Init does nothing, since the database is the source of truth.
+func (storage *DBStorage) Init([]*common.Metrics) {
+	storage.Logger.Infoln("The database is the source of truth, skipping the initialization")
+}
+
+// Replay does nothing, since every update is written to the database immediately.
+func (storage *DBStorage) Replay() error {
+	return nil
+}
+
+// Ping tests the database connection.
+func (storage *DBStorage) Ping(ctx context.Context) error {
+	if err := storage.DB.PingContext(ctx); err != nil {
+		storage.Logger.Errorf("Database ping failed: %s\n", err.Error())
+		return err
+	}
+	return nil
+}
+
+// FlushPeriodic returns immediately, since there is nothing to flush.
+func (storage *DBStorage) FlushPeriodic(context.Context) {
+	storage.Logger.Infoln("The database is the source of truth, there is nothing to flush")
+}
+
+// EvictPeriodic handles periodic eviction of metrics that haven't been updated for longer than ttl.
+// The job is stopped when the context is cancelled.
+func (storage *DBStorage) EvictPeriodic(ctx context.Context, tick <-chan time.Time, ttl time.Duration) {
+	storage.Logger.Infoln("Launching the EvictPeriodic job")
+	for {
+		select {
+		case <-ctx.Done():
+			storage.Logger.Infoln("Stopping the EvictPeriodic job")
+			return
+		case tick := <-tick:
+			storage.Logger.Infof("The EvictPeriodic job is ticking at %v\n", tick)
+			if err := storage.evict(ctx, tick.Add(-ttl)); err != nil {
+				storage.Logger.Errorf("Failed to evict metrics: %s\n", err.Error())
+			}
+		}
+	}
+}
+
+// CompactPeriodic handles periodic compaction of the history: rolling up the samples
+// into coarser tiers and dropping the expired ones. The job is stopped when the context is cancelled.
+func (storage *DBStorage) CompactPeriodic(ctx context.Context, tick <-chan time.Time) {
+	storage.Logger.Infoln("Launching the CompactPeriodic job")
+	for {
+		select {
+		case <-ctx.Done():
+			storage.Logger.Infoln("Stopping the CompactPeriodic job")
+			return
+		case tick := <-tick:
+			storage.Logger.Infof("The CompactPeriodic job is ticking at %v\n", tick)
+			storage.History.Compact(tick)
+		}
+	}
+}
+
+func (storage *DBStorage) evict(ctx context.Context, deadline time.Time) error {
+	// not retried, see Delete
+	evicted, err := storage.selectMetrics(
+		ctx, storage.DB, "DELETE FROM metrics WHERE updated_at < $1 RETURNING "+metricColumns, deadline,
+	)
+	if err != nil {
+		return err
+	}
+	if len(evicted) > 0 {
+		storage.Logger.Infof("Evicted %d metrics\n", len(evicted))
+	}
+	storage.recordDelete(evicted)
+	return nil
+}
+
+// addSingle upserts the metric. It's not retried: if the response is lost, a retry could
+// increment a counter twice.
+func (storage *DBStorage) addSingle(ctx context.Context, q queryer, update *common.Metrics) (*common.Metrics, error) {
+	storage.Logger.Infof("Updating a metric %s %s\n", update.ID, update.MType)
+	labels, err := marshalLabels(update.Labels)
+	if err != nil {
+		storage.Logger.Errorf("Failed to marshal labels of %s: %s\n", update.ID, err.Error())
+		return nil, err
+	}
+	result, err := storage.selectMetrics(
+		ctx, q, addQuery, update.ID, update.MType, update.Delta, update.Value, labels, time.Now(),
+	)
+	if err != nil {
+		storage.Logger.Errorf("Failed to update metric %s: %s\n", update.ID, err.Error())
+		return nil, err
+	}
+	if _, ok := q.(*sql.Tx); !ok {
+		storage.recordUpdate(result[0])
+	}
+	return result[0], nil
+}
+
+// query runs a statement returning metrics, with retry logic for transient errors.
+// Statements passed here must be safe to repeat, so the deletions must not be run with it.
+func (storage *DBStorage) query(ctx context.Context, query string, args ...any) ([]*common.Metrics, error) {
+	f := func() (any, error) {
+		return storage.selectMetrics(ctx, storage.DB, query, args...)
+	}
+	result, err := storage.Retrier.RetryChecked(ctx, f, utils.CheckConnectionError)
+	if err != nil {
+		storage.Logger.Errorf("Query failed: %s\n", err.Error())
+		return nil, err
+	}
+	return result.([]*common.Metrics), nil
+}
+
+// selectMetrics runs a statement returning metrics and scans them, setting the staleness flags.
+func (storage *DBStorage) selectMetrics(
+	ctx context.Context, q queryer, query string, args ...any,
+) ([]*common.Metrics, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	var result []*common.Metrics
+	for rows.Next() {
+		var metrics common.Metrics
+		if err := scanMetric(rows, &metrics); err != nil {
+			return nil, err
+		}
+		metrics.Stale = metrics.IsStale(storage.StaleAfter, now)
+		result = append(result, &metrics)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// filterConditions translates the restrictions of the filter that the database can check into SQL conditions
+func filterConditions(filter *entities.Filter) ([]string, []any) {
+	var conditions []string
+	var args []any
+	if len(filter.IDs) > 0 {
+		args = append(args, filter.IDs)
+		conditions = append(conditions, fmt.Sprintf("id = ANY($%d)", len(args)))
+	}
+	if filter.MType != "" {
+		args = append(args, filter.MType)
+		conditions = append(conditions, fmt.Sprintf("mtype = $%d", len(args)))
+	}
+	if filter.Prefix != "" {
+		args = append(args, likeEscaper.Replace(filter.Prefix)+"%")
+		conditions = append(conditions, fmt.Sprintf(`id LIKE $%d ESCAPE '\'`, len(args)))
+	}
+	return conditions, args
+}
+
+// likeEscaper escapes the wildcards of a LIKE pattern
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// whereClause joins the conditions into a WHERE clause, which is empty without conditions
+func whereClause(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
+
+// recordUpdate saves the new value of the metric in the history and notifies the subscribers.
+func (storage *DBStorage) recordUpdate(metrics *common.Metrics) {
+	storage.History.Record(metrics, *metrics.UpdatedAt)
+	update := *metrics
+	storage.Hub.Publish(entities.Event{Kind: entities.EventUpdate, Metrics: &update})
+}
+
+// recordDelete drops the history of the deleted metrics and notifies the subscribers.
+func (storage *DBStorage) recordDelete(deleted []*common.Metrics) {
+	if len(deleted) == 0 {
+		return
+	}
+	ids := make([]string, 0, len(deleted))
+	for _, metrics := range deleted {
+		ids = append(ids, metrics.ID)
+		event := &common.Metrics{ID: metrics.ID, MType: metrics.MType, Labels: metrics.Labels}
+		storage.Hub.Publish(entities.Event{Kind: entities.EventDelete, Metrics: event})
+	}
+	storage.History.Delete(ids)
+}
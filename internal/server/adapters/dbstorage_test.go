@@ -0,0 +1,354 @@
+package adapters
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	common "github.com/matthiasBT/monitoring/internal/infra/entities"
+	"github.com/matthiasBT/monitoring/internal/infra/logging"
+	"github.com/matthiasBT/monitoring/internal/infra/utils"
+	"github.com/matthiasBT/monitoring/internal/server/entities"
+	"github.com/stretchr/testify/assert"
+)
+
+// arrayConverter passes the ID lists through as the pgx driver does, since sqlmock rejects slices by default
+type arrayConverter struct{}
+
+func (arrayConverter) ConvertValue(v any) (driver.Value, error) {
+	if ids, ok := v.([]string); ok {
+		return ids, nil
+	}
+	return driver.DefaultParameterConverter.ConvertValue(v)
+}
+
+func newMockDBStorage(t *testing.T) (*DBStorage, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New(sqlmock.ValueConverterOption(arrayConverter{}))
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	logger := logging.SetupLogger()
+	storage := &DBStorage{
+		DB:         db,
+		Logger:     logger,
+		Retrier:    utils.Retrier{Logger: logger},
+		StaleAfter: time.Minute,
+		History:    NewHistory(10, nil),
+		Hub:        NewHub(logger, 10),
+	}
+	return storage, mock
+}
+
+func storedRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "mtype", "delta", "val", "labels", "updated_at"})
+}
+
+func TestDBStorage_Add(t *testing.T) {
+	updatedAt := time.Now()
+	tests := []struct {
+		name    string
+		update  *common.Metrics
+		rows    *sqlmock.Rows
+		want    *common.Metrics
+		wantErr error
+	}{
+		{
+			name:   "counter_is_incremented_in_place",
+			update: &common.Metrics{ID: "PollCount", MType: common.TypeCounter, Delta: ptrint64(2)},
+			rows:   storedRows().AddRow("PollCount", common.TypeCounter, int64(5), nil, nil, updatedAt),
+			want: &common.Metrics{
+				ID: "PollCount", MType: common.TypeCounter, Delta: ptrint64(5), UpdatedAt: &updatedAt,
+			},
+		},
+		{
+			name: "gauge_with_labels",
+			update: &common.Metrics{
+				ID: "Alloc", MType: common.TypeGauge, Value: ptrfloat64(1.5), Labels: map[string]string{"host": "a"},
+			},
+			rows: storedRows().AddRow("Alloc", common.TypeGauge, nil, 1.5, []byte(`{"host":"a"}`), updatedAt),
+			want: &common.Metrics{
+				ID:        "Alloc",
+				MType:     common.TypeGauge,
+				Value:     ptrfloat64(1.5),
+				Labels:    map[string]string{"host": "a"},
+				UpdatedAt: &updatedAt,
+			},
+		},
+		{
+			name:    "database_error",
+			update:  &common.Metrics{ID: "PollCount", MType: common.TypeCounter, Delta: ptrint64(2)},
+			wantErr: errors.New("fake error"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage, mock := newMockDBStorage(t)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			events := storage.Subscribe(ctx, &entities.Filter{})
+
+			labels, _ := marshalLabels(tt.update.Labels)
+			query := mock.ExpectQuery(regexp.QuoteMeta("delta = CASE")).
+				WithArgs(tt.update.ID, tt.update.MType, tt.update.Delta, tt.update.Value, labels, sqlmock.AnyArg())
+			if tt.wantErr != nil {
+				query.WillReturnError(tt.wantErr)
+			} else {
+				query.WillReturnRows(tt.rows)
+			}
+
+			got, err := storage.Add(ctx, tt.update)
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Equal(t, tt.want, got)
+			if tt.wantErr == nil {
+				event := <-events
+				assert.Equal(t, entities.EventUpdate, event.Kind)
+				assert.Equal(t, tt.want, event.Metrics)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestDBStorage_AddBatch(t *testing.T) {
+	storage, mock := newMockDBStorage(t)
+	updatedAt := time.Now()
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO metrics")).
+		WillReturnRows(storedRows().AddRow("PollCount", common.TypeCounter, int64(1), nil, nil, updatedAt))
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO metrics")).
+		WillReturnRows(storedRows().AddRow("PollCount", common.TypeCounter, int64(3), nil, nil, updatedAt))
+	mock.ExpectCommit()
+
+	ctx := context.Background()
+	err := storage.AddBatch(ctx, []*common.Metrics{
+		{ID: "PollCount", MType: common.TypeCounter, Delta: ptrint64(1)},
+		{ID: "PollCount", MType: common.TypeCounter, Delta: ptrint64(2)},
+	})
+	assert.NoError(t, err)
+	query := &common.Metrics{ID: "PollCount", MType: common.TypeCounter}
+	samples, _ := storage.GetHistory(ctx, query, time.Time{}, time.Time{})
+	assert.Len(t, samples, 2, "Committed updates must be recorded in the history")
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestDBStorage_AddBatchSorted(t *testing.T) {
+	storage, mock := newMockDBStorage(t)
+	updatedAt := time.Now()
+	mock.ExpectBegin()
+	// the rows are locked in the order of the IDs, whatever the order of the batch
+	for _, update := range []struct {
+		id    string
+		delta int64
+	}{{"A", 1}, {"B", 2}, {"B", 4}, {"C", 3}} {
+		mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO metrics")).
+			WithArgs(update.id, common.TypeCounter, ptrint64(update.delta), nil, nil, sqlmock.AnyArg()).
+			WillReturnRows(storedRows().AddRow(update.id, common.TypeCounter, update.delta, nil, nil, updatedAt))
+	}
+	mock.ExpectCommit()
+
+	batch := []*common.Metrics{
+		{ID: "C", MType: common.TypeCounter, Delta: ptrint64(3)},
+		{ID: "B", MType: common.TypeCounter, Delta: ptrint64(2)},
+		{ID: "A", MType: common.TypeCounter, Delta: ptrint64(1)},
+		{ID: "B", MType: common.TypeCounter, Delta: ptrint64(4)},
+	}
+	assert.NoError(t, storage.AddBatch(context.Background(), batch))
+	assert.Equal(t, "C", batch[0].ID, "The batch of the caller must not be reordered")
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestDBStorage_Get(t *testing.T) {
+	fresh := time.Now()
+	old := fresh.Add(-time.Hour)
+	tests := []struct {
+		name    string
+		rows    *sqlmock.Rows
+		want    *common.Metrics
+		wantErr error
+	}{
+		{
+			name: "fresh_metric",
+			rows: storedRows().AddRow("Alloc", common.TypeGauge, nil, 1.5, nil, fresh),
+			want: &common.Metrics{ID: "Alloc", MType: common.TypeGauge, Value: ptrfloat64(1.5), UpdatedAt: &fresh},
+		},
+		{
+			name: "stale_metric",
+			rows: storedRows().AddRow("Alloc", common.TypeGauge, nil, 1.5, nil, old),
+			want: &common.Metrics{
+				ID: "Alloc", MType: common.TypeGauge, Value: ptrfloat64(1.5), UpdatedAt: &old, Stale: true,
+			},
+		},
+		{
+			name:    "unknown_metric",
+			rows:    storedRows(),
+			wantErr: common.ErrUnknownMetric,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage, mock := newMockDBStorage(t)
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT "+metricColumns+" FROM metrics WHERE id = $1 AND mtype = $2")).
+				WithArgs("Alloc", common.TypeGauge).
+				WillReturnRows(tt.rows)
+
+			got, err := storage.Get(context.Background(), &common.Metrics{ID: "Alloc", MType: common.TypeGauge})
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Equal(t, tt.want, got)
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestDBStorage_Delete(t *testing.T) {
+	tests := []struct {
+		name    string
+		rows    *sqlmock.Rows
+		wantErr error
+	}{
+		{
+			name: "deleted",
+			rows: storedRows().AddRow("PollCount", common.TypeCounter, int64(5), nil, nil, time.Now()),
+		},
+		{
+			name:    "unknown_metric",
+			rows:    storedRows(),
+			wantErr: common.ErrUnknownMetric,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage, mock := newMockDBStorage(t)
+			mock.ExpectQuery(regexp.QuoteMeta("DELETE FROM metrics WHERE id = $1 AND mtype = $2")).
+				WithArgs("PollCount", common.TypeCounter).
+				WillReturnRows(tt.rows)
+
+			err := storage.Delete(context.Background(), &common.Metrics{ID: "PollCount", MType: common.TypeCounter})
+			assert.ErrorIs(t, err, tt.wantErr)
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestDBStorage_DeleteNotRetried(t *testing.T) {
+	storage, mock := newMockDBStorage(t)
+	storage.Retrier.Attempts = 2
+	lost := &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}
+	query := regexp.QuoteMeta("DELETE FROM metrics WHERE id = $1 AND mtype = $2")
+	mock.ExpectQuery(query).WithArgs("PollCount", common.TypeCounter).WillReturnError(lost)
+	// the metric has been deleted by the first attempt, a retry would find nothing
+	mock.ExpectQuery(query).WithArgs("PollCount", common.TypeCounter).WillReturnRows(storedRows())
+
+	err := storage.Delete(context.Background(), &common.Metrics{ID: "PollCount", MType: common.TypeCounter})
+	assert.ErrorIs(t, err, lost)
+	assert.NotErrorIs(t, err, common.ErrUnknownMetric, "A lost response must not be retried")
+}
+
+func TestDBStorage_DeleteMatching(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		filter  *entities.Filter
+		prepare func(mock sqlmock.Sqlmock)
+		want    int
+		wantErr bool
+	}{
+		{
+			name:   "sql_conditions_only",
+			filter: &entities.Filter{MType: common.TypeCounter, Prefix: "Disk_"},
+			prepare: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta(
+					`DELETE FROM metrics WHERE mtype = $1 AND id LIKE $2 ESCAPE '\' RETURNING `+metricColumns,
+				)).
+					WithArgs(common.TypeCounter, `Disk\_%`).
+					WillReturnRows(storedRows().
+						AddRow("Disk_Read", common.TypeCounter, int64(5), nil, nil, now).
+						AddRow("Disk_Write", common.TypeCounter, int64(7), nil, nil, now))
+			},
+			want: 2,
+		},
+		{
+			name:   "regex_checked_on_candidates",
+			filter: &entities.Filter{Prefix: "Disk", Regex: regexp.MustCompile("Read$")},
+			prepare: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta(
+					`SELECT ` + metricColumns + ` FROM metrics WHERE id LIKE $1 ESCAPE '\'`,
+				)).
+					WithArgs("Disk%").
+					WillReturnRows(storedRows().
+						AddRow("DiskRead", common.TypeCounter, int64(5), nil, nil, now).
+						AddRow("DiskWrite", common.TypeCounter, int64(7), nil, nil, now))
+				mock.ExpectQuery(regexp.QuoteMeta(
+					`DELETE FROM metrics WHERE id LIKE $1 ESCAPE '\' AND id = ANY($2) RETURNING `+metricColumns,
+				)).
+					WithArgs("Disk%", []string{"DiskRead"}).
+					WillReturnRows(storedRows().AddRow("DiskRead", common.TypeCounter, int64(5), nil, nil, now))
+			},
+			want: 1,
+		},
+		{
+			name:   "no_candidates",
+			filter: &entities.Filter{IDs: []string{"Alloc"}, Regex: regexp.MustCompile("^Disk")},
+			prepare: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT ` + metricColumns + ` FROM metrics WHERE id = ANY($1)`)).
+					WithArgs([]string{"Alloc"}).
+					WillReturnRows(storedRows().AddRow("Alloc", common.TypeGauge, nil, 1.5, nil, now))
+			},
+		},
+		{
+			name:   "failure",
+			filter: &entities.Filter{MType: common.TypeGauge},
+			prepare: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("DELETE FROM metrics WHERE mtype = $1 RETURNING")).
+					WithArgs(common.TypeGauge).
+					WillReturnError(errors.New("fake error"))
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage, mock := newMockDBStorage(t)
+			tt.prepare(mock)
+
+			got, err := storage.DeleteMatching(context.Background(), tt.filter)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.want, got)
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestDBStorage_ResetCounter(t *testing.T) {
+	storage, mock := newMockDBStorage(t)
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE metrics SET delta = 0")).
+		WithArgs(sqlmock.AnyArg(), "Alloc", common.TypeCounter).
+		WillReturnRows(storedRows())
+
+	_, err := storage.ResetCounter(context.Background(), "Alloc")
+	assert.ErrorIs(t, err, common.ErrUnknownMetric)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
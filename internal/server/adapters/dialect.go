@@ -0,0 +1,57 @@
+// Package adapters provides the descriptions of the SQL dialects supported by DBKeeper.
+// The queries are written for PostgreSQL and rewritten for the other dialects.
+package adapters
+
+import (
+	"database/sql"
+	"regexp"
+
+	"github.com/matthiasBT/monitoring/internal/infra/migrations"
+)
+
+// placeholderRe matches the PostgreSQL placeholders: $1, $2 and so on
+var placeholderRe = regexp.MustCompile(`\$(\d+)`)
+
+// Dialect describes the differences between the SQL databases supported by DBKeeper.
+type Dialect struct {
+	Name        string             // Name of the dialect, as known to the migrations
+	Driver      string             // Name of the database/sql driver
+	Isolation   sql.IsolationLevel // Isolation level of the write transactions
+	Placeholder string             // Prefix of numbered placeholders replacing "$"
+}
+
+var (
+	// PostgresDialect is the dialect of PostgreSQL, the queries are written in it.
+	PostgresDialect = &Dialect{
+		Name:        migrations.Postgres,
+		Driver:      "pgx",
+		Isolation:   sql.LevelReadCommitted,
+		Placeholder: "$",
+	}
+
+	// SQLiteDialect is the dialect of SQLite. It supports upserts and RETURNING clauses,
+	// but uses "?" for numbered placeholders, and its transactions are always serializable.
+	SQLiteDialect = &Dialect{
+		Name:        migrations.SQLite,
+		Driver:      "sqlite",
+		Isolation:   sql.LevelDefault,
+		Placeholder: "?",
+	}
+)
+
+// Rebind rewrites a query written for PostgreSQL in the dialect.
+// A nil Dialect is treated as PostgreSQL.
+func (d *Dialect) Rebind(query string) string {
+	if d == nil || d.Placeholder == "$" {
+		return query
+	}
+	return placeholderRe.ReplaceAllString(query, d.Placeholder+"$1")
+}
+
+// isolation returns the isolation level of the write transactions.
+func (d *Dialect) isolation() sql.IsolationLevel {
+	if d == nil {
+		return PostgresDialect.Isolation
+	}
+	return d.Isolation
+}
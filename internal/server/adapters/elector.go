@@ -0,0 +1,175 @@
+// Package adapters provides the leader election of the server replicas sharing a PostgreSQL database.
+// The leader is the replica holding a session-level advisory lock, so the leadership is released
+// by the database as soon as the leader's connection is lost.
+package adapters
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"sync"
+	"time"
+
+	"github.com/matthiasBT/monitoring/internal/infra/logging"
+	"github.com/matthiasBT/monitoring/internal/server/entities"
+)
+
+// StandaloneElector is the Elector of a server without replicas, which is always the leader.
+type StandaloneElector struct{}
+
+// NewStandaloneElector creates and returns a new StandaloneElector.
+func NewStandaloneElector() entities.Elector {
+	return StandaloneElector{}
+}
+
+// IsLeader reports that a standalone server runs the singleton jobs.
+func (StandaloneElector) IsLeader() bool {
+	return true
+}
+
+// Role returns RoleStandalone.
+func (StandaloneElector) Role() string {
+	return entities.RoleStandalone
+}
+
+// Gate returns the given channel, since a standalone server receives all ticks.
+func (StandaloneElector) Gate(_ context.Context, tick <-chan time.Time) <-chan time.Time {
+	return tick
+}
+
+// AdvisoryElector elects the leader among the replicas with a PostgreSQL advisory lock.
+type AdvisoryElector struct {
+	DB     *sql.DB         // Database shared by the replicas
+	LockID int64           // Key of the advisory lock, the same for all replicas
+	Conn   *sql.Conn       // Dedicated connection holding the lock, nil if there is none
+	Leader bool            // Whether this replica holds the lock
+	Lock   *sync.Mutex     // Mutex for synchronization
+	Logger logging.ILogger // Logger for logging activities
+}
+
+// NewAdvisoryElector creates and returns a new AdvisoryElector. The replica is a follower
+// until it acquires the lock, see Run.
+func NewAdvisoryElector(db *sql.DB, lockID int64, logger logging.ILogger) *AdvisoryElector {
+	return &AdvisoryElector{
+		DB:     db,
+		LockID: lockID,
+		Lock:   &sync.Mutex{},
+		Logger: logger,
+	}
+}
+
+// Run tries to acquire the leadership immediately and on every tick, and checks that the leader
+// still holds the lock. The leadership is released when the context is cancelled.
+func (e *AdvisoryElector) Run(ctx context.Context, tick <-chan time.Time) {
+	e.Logger.Infoln("Launching the leader election")
+	e.elect(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			e.Logger.Infoln("Stopping the leader election")
+			e.resign()
+			return
+		case <-tick:
+			e.elect(ctx)
+		}
+	}
+}
+
+// IsLeader reports whether this replica holds the lock.
+func (e *AdvisoryElector) IsLeader() bool {
+	e.Lock.Lock()
+	defer e.Lock.Unlock()
+
+	return e.Leader
+}
+
+// Role returns the role of this replica: RoleLeader or RoleFollower.
+func (e *AdvisoryElector) Role() string {
+	if e.IsLeader() {
+		return entities.RoleLeader
+	}
+	return entities.RoleFollower
+}
+
+// Gate returns a channel which receives the ticks of the given channel only while this replica
+// is the leader. It's used for running the singleton jobs on a single replica.
+func (e *AdvisoryElector) Gate(ctx context.Context, tick <-chan time.Time) <-chan time.Time {
+	gated := make(chan time.Time)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case t := <-tick:
+				if !e.IsLeader() {
+					continue
+				}
+				select {
+				case gated <- t:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return gated
+}
+
+// elect checks the connection of the leader, or tries to acquire the lock if this replica is a follower.
+func (e *AdvisoryElector) elect(ctx context.Context) {
+	e.Lock.Lock()
+	defer e.Lock.Unlock()
+
+	if e.Leader {
+		// the lock is held as long as the session is alive
+		if err := e.Conn.PingContext(ctx); err != nil {
+			e.Logger.Errorf("Lost the connection holding the leader lock: %s\n", err.Error())
+			e.dropConn()
+		}
+		return
+	}
+	if e.Conn == nil {
+		conn, err := e.DB.Conn(ctx)
+		if err != nil {
+			e.Logger.Errorf("Failed to open a connection for the leader election: %s\n", err.Error())
+			return
+		}
+		e.Conn = conn
+	}
+	var acquired bool
+	row := e.Conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", e.LockID)
+	if err := row.Scan(&acquired); err != nil {
+		e.Logger.Errorf("Failed to acquire the leader lock: %s\n", err.Error())
+		e.dropConn()
+		return
+	}
+	if acquired {
+		e.Logger.Infoln("This replica is the leader now")
+		e.Leader = true
+	}
+}
+
+// resign releases the lock, if it's held, and closes the dedicated connection.
+func (e *AdvisoryElector) resign() {
+	e.Lock.Lock()
+	defer e.Lock.Unlock()
+
+	if e.Leader {
+		if _, err := e.Conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", e.LockID); err != nil {
+			e.Logger.Errorf("Failed to release the leader lock: %s\n", err.Error())
+		}
+		e.Logger.Infoln("Released the leadership")
+	}
+	e.dropConn()
+}
+
+// dropConn closes the dedicated connection, so that the lock held by it, if any, is released by the database.
+// The connection is discarded instead of being returned to the pool, where it would keep holding the lock.
+func (e *AdvisoryElector) dropConn() {
+	if e.Conn != nil {
+		e.Conn.Raw(func(any) error { return driver.ErrBadConn })
+		e.Conn.Close()
+		e.Conn = nil
+	}
+	e.Leader = false
+}
@@ -0,0 +1,83 @@
+package adapters
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/matthiasBT/monitoring/internal/infra/logging"
+	"github.com/matthiasBT/monitoring/internal/server/entities"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdvisoryElector_elect(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+	elector := NewAdvisoryElector(db, 42, logging.SetupLogger())
+	tryLock := regexp.QuoteMeta("SELECT pg_try_advisory_lock($1)")
+
+	// another replica holds the lock
+	mock.ExpectQuery(tryLock).WithArgs(42).WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(false))
+	elector.elect(ctx)
+	assert.Equal(t, entities.RoleFollower, elector.Role())
+
+	// the lock is released by the other replica
+	mock.ExpectQuery(tryLock).WithArgs(42).WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(true))
+	elector.elect(ctx)
+	assert.Equal(t, entities.RoleLeader, elector.Role())
+
+	// the leader only checks its connection
+	mock.ExpectPing()
+	elector.elect(ctx)
+	assert.True(t, elector.IsLeader())
+
+	// the connection holding the lock is lost
+	mock.ExpectPing().WillReturnError(errors.New("fake error"))
+	elector.elect(ctx)
+	assert.False(t, elector.IsLeader())
+	assert.Nil(t, elector.Conn)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestAdvisoryElector_Gate(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	standalone := NewStandaloneElector()
+	assert.True(t, standalone.IsLeader())
+	assert.Equal(t, entities.RoleStandalone, standalone.Role())
+	ticks := make(chan time.Time)
+	assert.Equal(t, (<-chan time.Time)(ticks), standalone.Gate(ctx, ticks), "A standalone server receives all ticks")
+
+	elector := NewAdvisoryElector(nil, 42, logging.SetupLogger())
+	tick := make(chan time.Time)
+	gated := elector.Gate(ctx, tick)
+
+	tick <- time.Now()
+	select {
+	case <-gated:
+		t.Fatalf("A follower must not receive ticks")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	elector.Lock.Lock()
+	elector.Leader = true
+	elector.Lock.Unlock()
+	now := time.Now()
+	tick <- now
+	select {
+	case got := <-gated:
+		assert.Equal(t, now, got)
+	case <-time.After(time.Second):
+		t.Fatalf("The leader must receive ticks")
+	}
+}
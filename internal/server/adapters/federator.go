@@ -0,0 +1,292 @@
+// Package adapters provides the federation job shipping the metrics of an edge server
+// to an upstream server.
+package adapters
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	common "github.com/matthiasBT/monitoring/internal/infra/entities"
+	"github.com/matthiasBT/monitoring/internal/infra/logging"
+	"github.com/matthiasBT/monitoring/internal/server/entities"
+)
+
+const (
+	// OriginLabel is the label of the forwarded metrics naming the edge server which collected them.
+	// Metrics already carrying it, e.g. forwarded by another edge server, keep the original value.
+	OriginLabel = "origin"
+
+	// OriginSeparator separates the origin from the ID of a forwarded metric, like edge-1:Alloc
+	OriginSeparator = ":"
+)
+
+// Federator periodically ships the changes of the local metrics to an upstream server.
+// Instead of queueing the batches, it compares the current state with the last shipped one:
+// gauges updated since then are sent with their latest values, and counters are sent with
+// the increments since then. So if the upstream server is unavailable or slow, the changes
+// are coalesced and shipped later, and the memory usage doesn't grow.
+// The IDs of the forwarded metrics are prefixed with the origin, like edge-1:Alloc, so that the metrics
+// of different edge servers don't overwrite each other upstream. The last shipped state is persisted
+// after every sent batch, so that the changes made before a restart are shipped after it.
+// Of the replicas sharing a database, only the leader ships the metrics, and it keeps the shipped state
+// in the database, so a new leader takes it over. A batch sent right before a crash may still be shipped twice.
+type Federator struct {
+	Storage     entities.Storage           // Local storage of the metrics
+	Upstream    entities.Upstream          // Upstream server receiving the metrics
+	Elector     entities.Elector           // Leader elector of the replicas, nil for a standalone server
+	State       entities.ShippedState      // Persisted shipped state, nil to not persist it
+	Origin      string                     // Value of the origin label
+	BatchSize   int                        // Maximal number of metrics in a single request
+	Shipped     map[string]*common.Metrics // Last shipped state of the metrics, valid while Leading
+	Leading     bool                       // Whether Shipped has been loaded since this replica became the leader
+	Unsaved     map[string]bool            // IDs whose shipped state has changed, but hasn't been persisted yet
+	PausedUntil time.Time                  // Time before which the upstream server asked not to send anything
+	Logger      logging.ILogger            // Logger for logging activities
+}
+
+// NewFederator creates and returns a new Federator.
+func NewFederator(
+	storage entities.Storage,
+	upstream entities.Upstream,
+	elector entities.Elector,
+	state entities.ShippedState,
+	origin string,
+	batchSize int,
+	logger logging.ILogger,
+) *Federator {
+	return &Federator{
+		Storage:   storage,
+		Upstream:  upstream,
+		Elector:   elector,
+		State:     state,
+		Origin:    origin,
+		BatchSize: batchSize,
+		Shipped:   make(map[string]*common.Metrics),
+		Unsaved:   make(map[string]bool),
+		Logger:    logger,
+	}
+}
+
+// Init prepares the shipped state. Without the persisted State, the current state of the storage
+// is treated as already shipped, so that the counters restored from the storage aren't added
+// to the upstream ones once again. Otherwise, the persisted state is loaded by the leader before shipping.
+func (f *Federator) Init(ctx context.Context) error {
+	if f.State != nil {
+		return nil
+	}
+	return f.lead(ctx)
+}
+
+// Run ships the changes on every tick until the context is cancelled. Followers don't ship anything
+// and don't keep any state: the shipped state is loaded from State on becoming the leader.
+func (f *Federator) Run(ctx context.Context, tick <-chan time.Time) {
+	f.Logger.Infoln("Launching the federation job")
+	for {
+		select {
+		case <-ctx.Done():
+			f.Logger.Infoln("Stopping the federation job")
+			return
+		case tick := <-tick:
+			f.Logger.Infof("The federation job is ticking at %v\n", tick)
+			if f.Elector != nil && !f.Elector.IsLeader() {
+				f.follow()
+				continue
+			}
+			if err := f.ship(ctx, tick); err != nil {
+				f.Logger.Errorf("Failed to ship metrics upstream: %s\n", err.Error())
+			}
+		}
+	}
+}
+
+// follow drops the state of a former leader, the new leader continues from the persisted one.
+func (f *Federator) follow() {
+	f.Leading = false
+	f.Shipped = make(map[string]*common.Metrics)
+	f.Unsaved = make(map[string]bool)
+}
+
+// lead loads the shipped state persisted by the previous leader, unless it has already been loaded.
+// Without the persisted State, the current state of the storage is treated as shipped.
+func (f *Federator) lead(ctx context.Context) error {
+	if f.Leading {
+		return nil
+	}
+	var shipped map[string]*common.Metrics
+	var err error
+	if f.State != nil {
+		shipped, err = f.State.Load(ctx)
+	} else {
+		shipped, err = f.Storage.GetAll(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	f.Shipped = shipped
+	f.Leading = true
+	return nil
+}
+
+// ship sends the changes since the last shipment in batches. The batches sent before a failure
+// are remembered as shipped, and the rest is retried on the next tick.
+func (f *Federator) ship(ctx context.Context, now time.Time) error {
+	if now.Before(f.PausedUntil) {
+		f.Logger.Infof("The upstream server asked to pause until %v\n", f.PausedUntil)
+		return nil
+	}
+	if err := f.lead(ctx); err != nil {
+		return err
+	}
+	state, err := f.Storage.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+	if err := f.forgetDeleted(ctx, state); err != nil {
+		return err
+	}
+	ids, batch := f.changes(state)
+	if len(batch) == 0 {
+		return nil
+	}
+	f.Logger.Infof("Shipping %d changed metrics upstream\n", len(batch))
+	return f.sendBatches(ctx, now, state, ids, batch)
+}
+
+// sendBatches sends the changes in batches, recording the metrics of every successfully sent one as shipped.
+func (f *Federator) sendBatches(
+	ctx context.Context, now time.Time, state map[string]*common.Metrics, ids []string, batch []*common.Metrics,
+) error {
+	for start := 0; start < len(batch); start += f.BatchSize {
+		end := start + f.BatchSize
+		if end > len(batch) {
+			end = len(batch)
+		}
+		if err := f.Upstream.Send(ctx, batch[start:end]); err != nil {
+			var throttled *ThrottledError
+			if errors.As(err, &throttled) {
+				f.PausedUntil = now.Add(throttled.RetryAfter)
+			}
+			return err
+		}
+		shipped := make([]*common.Metrics, 0, end-start)
+		for _, id := range ids[start:end] {
+			f.Shipped[id] = state[id]
+			shipped = append(shipped, state[id])
+		}
+		if err := f.save(ctx, shipped, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// save persists the changes of the shipped state, if it is persisted. The changes which failed
+// to be persisted before are saved again.
+func (f *Federator) save(ctx context.Context, shipped []*common.Metrics, forgotten []string) error {
+	if f.State == nil {
+		return nil
+	}
+	for _, metrics := range shipped {
+		f.Unsaved[metrics.ID] = true
+	}
+	for _, id := range forgotten {
+		f.Unsaved[id] = true
+	}
+	ids := make([]string, 0, len(f.Unsaved))
+	for id := range f.Unsaved {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	var changed []*common.Metrics
+	var deleted []string
+	for _, id := range ids {
+		if metrics, ok := f.Shipped[id]; ok {
+			changed = append(changed, metrics)
+		} else {
+			deleted = append(deleted, id)
+		}
+	}
+	if err := f.State.Save(ctx, changed, deleted); err != nil {
+		return fmt.Errorf("failed to persist the shipped state: %w", err)
+	}
+	f.Unsaved = make(map[string]bool)
+	return nil
+}
+
+// changes returns the IDs of the metrics changed since the last shipment, sorted,
+// and the metrics to be sent upstream.
+func (f *Federator) changes(state map[string]*common.Metrics) ([]string, []*common.Metrics) {
+	var ids []string
+	for id, metrics := range state {
+		if shipped := f.Shipped[id]; shipped == nil || isUpdatedAfter(metrics, shipped) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	batch := make([]*common.Metrics, 0, len(ids))
+	for _, id := range ids {
+		metrics := *state[id]
+		metrics.UpdatedAt = nil
+		metrics.Stale = false
+		metrics.Labels = f.withOrigin(metrics.Labels)
+		metrics.ID = f.upstreamID(id, metrics.Labels[OriginLabel])
+		if shipped := f.Shipped[id]; metrics.MType == common.TypeCounter && shipped != nil &&
+			shipped.MType == common.TypeCounter && *shipped.Delta <= *metrics.Delta {
+			// otherwise, the counter is new, has replaced a gauge or has been reset since the last shipment
+			increment := *metrics.Delta - *shipped.Delta
+			metrics.Delta = &increment
+		}
+		batch = append(batch, &metrics)
+	}
+	return ids, batch
+}
+
+// forgetDeleted drops the shipped state of the deleted metrics, so that they are shipped
+// from scratch if they are created again.
+func (f *Federator) forgetDeleted(ctx context.Context, state map[string]*common.Metrics) error {
+	var forgotten []string
+	for id := range f.Shipped {
+		if _, ok := state[id]; !ok {
+			delete(f.Shipped, id)
+			forgotten = append(forgotten, id)
+		}
+	}
+	if len(forgotten) == 0 {
+		return nil
+	}
+	return f.save(ctx, nil, forgotten)
+}
+
+// withOrigin returns a copy of the labels with the origin label added, unless it's already set.
+func (f *Federator) withOrigin(labels map[string]string) map[string]string {
+	result := make(map[string]string, len(labels)+1)
+	for name, value := range labels {
+		result[name] = value
+	}
+	if _, ok := result[OriginLabel]; !ok {
+		result[OriginLabel] = f.Origin
+	}
+	return result
+}
+
+// upstreamID prefixes the ID with the origin of this server, unless the metric has been forwarded
+// by another edge server and is already prefixed with its origin.
+func (f *Federator) upstreamID(id, origin string) string {
+	if strings.HasPrefix(id, origin+OriginSeparator) {
+		return id
+	}
+	return f.Origin + OriginSeparator + id
+}
+
+// isUpdatedAfter reports whether the metric has been updated after the shipped state was taken.
+func isUpdatedAfter(metrics, shipped *common.Metrics) bool {
+	if metrics.UpdatedAt == nil || shipped.UpdatedAt == nil {
+		return metrics.UpdatedAt != shipped.UpdatedAt
+	}
+	return metrics.UpdatedAt.After(*shipped.UpdatedAt)
+}
@@ -0,0 +1,277 @@
+package adapters
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	common "github.com/matthiasBT/monitoring/internal/infra/entities"
+	"github.com/matthiasBT/monitoring/internal/infra/logging"
+	"github.com/matthiasBT/monitoring/internal/server/entities"
+	"github.com/stretchr/testify/assert"
+)
+
+type FakeUpstream struct {
+	batches [][]*common.Metrics
+	err     error
+}
+
+func (u *FakeUpstream) Send(ctx context.Context, batch []*common.Metrics) error {
+	if u.err != nil {
+		return u.err
+	}
+	u.batches = append(u.batches, batch)
+	return nil
+}
+
+func TestFederator_ship(t *testing.T) {
+	logger := logging.SetupLogger()
+	storage := &MemStorage{
+		State:  State{Metrics: map[string]*common.Metrics{}, Lock: &sync.Mutex{}},
+		Logger: logger,
+	}
+	ctx := context.Background()
+	storage.Add(ctx, &common.Metrics{ID: "PollCount", MType: common.TypeCounter, Delta: ptrint64(5)})
+	upstream := &FakeUpstream{}
+	federator := NewFederator(storage, upstream, nil, nil, "edge-1", 10, logger)
+	if err := federator.Init(ctx); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+
+	storage.Add(ctx, &common.Metrics{ID: "PollCount", MType: common.TypeCounter, Delta: ptrint64(2)})
+	storage.Add(ctx, &common.Metrics{
+		ID: "Alloc", MType: common.TypeGauge, Value: ptrfloat64(1.5), Labels: map[string]string{"origin": "agent"},
+	})
+	now := time.Now()
+	assert.NoError(t, federator.ship(ctx, now))
+	assert.Equal(t, [][]*common.Metrics{{
+		{
+			ID: "edge-1:Alloc", MType: common.TypeGauge, Value: ptrfloat64(1.5),
+			Labels: map[string]string{"origin": "agent"},
+		},
+		{
+			ID: "edge-1:PollCount", MType: common.TypeCounter, Delta: ptrint64(2),
+			Labels: map[string]string{"origin": "edge-1"},
+		},
+	}}, upstream.batches, "Only the increments since startup must be shipped, the origin label is kept")
+
+	assert.NoError(t, federator.ship(ctx, now))
+	assert.Len(t, upstream.batches, 1, "Nothing must be shipped without changes")
+
+	upstream.err = errors.New("fake error")
+	storage.Add(ctx, &common.Metrics{ID: "PollCount", MType: common.TypeCounter, Delta: ptrint64(3)})
+	assert.Error(t, federator.ship(ctx, now))
+	storage.Add(ctx, &common.Metrics{ID: "PollCount", MType: common.TypeCounter, Delta: ptrint64(4)})
+	upstream.err = nil
+	assert.NoError(t, federator.ship(ctx, now))
+	assert.Equal(t, ptrint64(7), upstream.batches[1][0].Delta, "Failed shipments must be coalesced")
+
+	storage.ResetCounter(ctx, "PollCount")
+	storage.Add(ctx, &common.Metrics{ID: "PollCount", MType: common.TypeCounter, Delta: ptrint64(1)})
+	assert.NoError(t, federator.ship(ctx, now))
+	assert.Equal(t, ptrint64(1), upstream.batches[2][0].Delta, "A reset counter must be shipped from scratch")
+}
+
+func TestFederator_shipThrottled(t *testing.T) {
+	logger := logging.SetupLogger()
+	storage := &MemStorage{
+		State:  State{Metrics: map[string]*common.Metrics{}, Lock: &sync.Mutex{}},
+		Logger: logger,
+	}
+	ctx := context.Background()
+	for _, id := range []string{"A", "B", "C"} {
+		storage.Add(ctx, &common.Metrics{ID: id, MType: common.TypeGauge, Value: ptrfloat64(1)})
+	}
+	upstream := &FakeUpstream{err: &ThrottledError{RetryAfter: time.Minute}}
+	state := &SharedShippedState{shipped: make(map[string]*common.Metrics)}
+	federator := NewFederator(storage, upstream, nil, state, "edge-1", 2, logger)
+
+	now := time.Now()
+	assert.Error(t, federator.ship(ctx, now))
+	upstream.err = nil
+	assert.NoError(t, federator.ship(ctx, now.Add(30*time.Second)))
+	assert.Empty(t, upstream.batches, "Nothing must be shipped until the pause is over")
+
+	assert.NoError(t, federator.ship(ctx, now.Add(time.Minute)))
+	if assert.Len(t, upstream.batches, 2, "The changes must be split into batches") {
+		assert.Len(t, upstream.batches[0], 2)
+		assert.Len(t, upstream.batches[1], 1)
+	}
+}
+
+// CentralUpstream adds the shipped metrics to the storage of a central server
+type CentralUpstream struct {
+	storage *MemStorage
+}
+
+func (u *CentralUpstream) Send(ctx context.Context, batch []*common.Metrics) error {
+	return u.storage.AddBatch(ctx, batch)
+}
+
+func newTestMemStorage() *MemStorage {
+	return &MemStorage{
+		State:  State{Metrics: map[string]*common.Metrics{}, Lock: &sync.Mutex{}},
+		Logger: logging.SetupLogger(),
+	}
+}
+
+func TestFederator_shipSameIDs(t *testing.T) {
+	ctx := context.Background()
+	central := &CentralUpstream{storage: newTestMemStorage()}
+	for i, origin := range []string{"edge-1", "edge-2"} {
+		edge := newTestMemStorage()
+		edge.Add(ctx, &common.Metrics{ID: "Alloc", MType: common.TypeGauge, Value: ptrfloat64(float64(i + 1))})
+		edge.Add(ctx, &common.Metrics{ID: "PollCount", MType: common.TypeCounter, Delta: ptrint64(int64(10 * (i + 1)))})
+		edge.Add(ctx, &common.Metrics{
+			ID: "edge-0:Alloc", MType: common.TypeGauge, Value: ptrfloat64(5), Labels: map[string]string{"origin": "edge-0"},
+		})
+		state := NewFileShippedState(filepath.Join(t.TempDir(), "state.json"))
+		federator := NewFederator(edge, central, nil, state, origin, 10, edge.Logger)
+		if err := federator.Init(ctx); err != nil {
+			t.Fatalf("Init() error = %v", err)
+		}
+		assert.NoError(t, federator.ship(ctx, time.Now()))
+	}
+
+	state, err := central.storage.GetAll(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, ptrfloat64(1), state["edge-1:Alloc"].Value)
+	assert.Equal(t, ptrfloat64(2), state["edge-2:Alloc"].Value)
+	assert.Equal(t, ptrint64(10), state["edge-1:PollCount"].Delta)
+	assert.Equal(t, ptrint64(20), state["edge-2:PollCount"].Delta)
+	assert.Equal(t, map[string]string{"origin": "edge-2"}, state["edge-2:PollCount"].Labels)
+	assert.Contains(t, state, "edge-0:Alloc", "The metrics forwarded by another edge server must keep their IDs")
+	assert.Len(t, state, 5)
+}
+
+func TestFederator_InitPersisted(t *testing.T) {
+	ctx := context.Background()
+	storage := newTestMemStorage()
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	storage.Add(ctx, &common.Metrics{ID: "PollCount", MType: common.TypeCounter, Delta: ptrint64(5)})
+	upstream := &FakeUpstream{}
+	federator := NewFederator(storage, upstream, nil, NewFileShippedState(statePath), "edge-1", 10, storage.Logger)
+	assert.NoError(t, federator.Init(ctx))
+	assert.NoError(t, federator.ship(ctx, time.Now()))
+	assert.Equal(t, ptrint64(5), upstream.batches[0][0].Delta, "Everything must be shipped on the first start")
+
+	// the changes made before the crash must be shipped after the restart, and only them
+	storage.Add(ctx, &common.Metrics{ID: "PollCount", MType: common.TypeCounter, Delta: ptrint64(3)})
+	storage.Add(ctx, &common.Metrics{ID: "Alloc", MType: common.TypeGauge, Value: ptrfloat64(1)})
+	restarted := NewFederator(storage, upstream, nil, NewFileShippedState(statePath), "edge-1", 10, storage.Logger)
+	assert.NoError(t, restarted.Init(ctx))
+	assert.NoError(t, restarted.ship(ctx, time.Now()))
+	if assert.Len(t, upstream.batches, 2) && assert.Len(t, upstream.batches[1], 2) {
+		assert.Equal(t, "edge-1:Alloc", upstream.batches[1][0].ID)
+		assert.Equal(t, ptrint64(3), upstream.batches[1][1].Delta)
+	}
+}
+
+// FakeElector is an Elector whose leadership is switched by the test
+type FakeElector struct {
+	leader bool
+}
+
+func (e *FakeElector) IsLeader() bool {
+	return e.leader
+}
+
+func (e *FakeElector) Role() string {
+	if e.leader {
+		return entities.RoleLeader
+	}
+	return entities.RoleFollower
+}
+
+func (e *FakeElector) Gate(_ context.Context, tick <-chan time.Time) <-chan time.Time {
+	return tick
+}
+
+// SharedShippedState is a ShippedState shared by the replicas, like DBShippedState
+type SharedShippedState struct {
+	shipped map[string]*common.Metrics
+	err     error
+}
+
+func (s *SharedShippedState) Load(context.Context) (map[string]*common.Metrics, error) {
+	return copyShipped(s.shipped), nil
+}
+
+func (s *SharedShippedState) Save(_ context.Context, shipped []*common.Metrics, forgotten []string) error {
+	if s.err != nil {
+		return s.err
+	}
+	for _, metrics := range shipped {
+		s.shipped[metrics.ID] = metrics
+	}
+	for _, id := range forgotten {
+		delete(s.shipped, id)
+	}
+	return nil
+}
+
+func TestFederator_failover(t *testing.T) {
+	ctx := context.Background()
+	storage := newTestMemStorage() // shared by the replicas, like DBStorage
+	upstream := &FakeUpstream{}
+	state := &SharedShippedState{shipped: make(map[string]*common.Metrics)}
+	electors := []*FakeElector{{leader: true}, {}}
+	replicas := make([]*Federator, 0, len(electors))
+	for _, elector := range electors {
+		federator := NewFederator(storage, upstream, elector, state, "edge-1", 10, storage.Logger)
+		assert.NoError(t, federator.Init(ctx))
+		replicas = append(replicas, federator)
+	}
+	tick := func() {
+		for _, replica := range replicas {
+			ticks := make(chan time.Time, 1)
+			ticks <- time.Now()
+			ctx, cancel := context.WithCancel(ctx)
+			go func() {
+				time.Sleep(10 * time.Millisecond)
+				cancel()
+			}()
+			replica.Run(ctx, ticks)
+		}
+	}
+
+	storage.Add(ctx, &common.Metrics{ID: "PollCount", MType: common.TypeCounter, Delta: ptrint64(5)})
+	tick()
+	// the increment isn't shipped by the leader before the failover
+	storage.Add(ctx, &common.Metrics{ID: "PollCount", MType: common.TypeCounter, Delta: ptrint64(3)})
+	tick()
+	assert.Empty(t, replicas[1].Shipped, "A follower must not keep its own shipped state")
+	storage.Add(ctx, &common.Metrics{ID: "PollCount", MType: common.TypeCounter, Delta: ptrint64(2)})
+	electors[0].leader, electors[1].leader = false, true
+	tick()
+
+	var shipped int64
+	for _, batch := range upstream.batches {
+		for _, metrics := range batch {
+			shipped += *metrics.Delta
+		}
+	}
+	assert.Equal(t, int64(10), shipped, "Every increment must be shipped exactly once across the failover")
+	assert.Equal(t, ptrint64(10), state.shipped["PollCount"].Delta)
+}
+
+func TestFederator_saveFailure(t *testing.T) {
+	ctx := context.Background()
+	storage := newTestMemStorage()
+	upstream := &FakeUpstream{}
+	state := &SharedShippedState{shipped: make(map[string]*common.Metrics), err: errors.New("fake error")}
+	federator := NewFederator(storage, upstream, nil, state, "edge-1", 10, storage.Logger)
+	assert.NoError(t, federator.Init(ctx))
+
+	storage.Add(ctx, &common.Metrics{ID: "PollCount", MType: common.TypeCounter, Delta: ptrint64(5)})
+	assert.Error(t, federator.ship(ctx, time.Now()))
+	state.err = nil
+	storage.Add(ctx, &common.Metrics{ID: "Alloc", MType: common.TypeGauge, Value: ptrfloat64(1)})
+	assert.NoError(t, federator.ship(ctx, time.Now()))
+	assert.Len(t, upstream.batches, 2, "A sent batch must not be sent again after a failed save")
+	assert.Contains(t, state.shipped, "PollCount", "The unsaved state must be saved with the next batch")
+	assert.Contains(t, state.shipped, "Alloc")
+}
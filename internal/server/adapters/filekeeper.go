@@ -1,13 +1,14 @@
 // Package adapters provides functionality for managing file-based storage,
-// including reading from and writing to a file. It handles JSON serialization
-// of metrics data and ensures thread safety with a mutex.
+// including reading from and writing to a file. It protects the files from
+// partial writes, keeps previous snapshots, and ensures thread safety with a mutex.
 package adapters
 
 import (
-	"bufio"
 	"context"
-	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
 	"sync"
 
 	"github.com/matthiasBT/monitoring/internal/infra/config/server"
@@ -19,26 +20,34 @@ import (
 
 // FileKeeper is a struct that manages file operations and holds a logger,
 // the path to the file storage, a retrier for handling retry logic, and a mutex for
-// synchronizing operations.
+// synchronizing operations. Snapshots are written atomically: to a temporary file
+// that replaces the storage file, whose previous versions are kept as generations
+// named like "metrics.json.1", "metrics.json.2" and so on.
 type FileKeeper struct {
-	Lock    *sync.Mutex     // Mutex for synchronization
-	Path    string          // Path to the file storage
-	Logger  logging.ILogger // Logger for logging activities
-	Retrier utils.Retrier   // Retrier for retry logic
+	Lock        *sync.Mutex     // Mutex for synchronization
+	Path        string          // Path to the file storage
+	Generations int             // Number of previous snapshots kept
+	Format      string          // Format of the new snapshots, json or gob. Any format is restored
+	Logger      logging.ILogger // Logger for logging activities
+	Retrier     utils.Retrier   // Retrier for retry logic
 }
 
 // NewFileKeeper creates and returns a new FileKeeper instance with the provided configuration,
-// logger, and retrier. It initializes a mutex for thread safety.
+// logger, and retrier. The file path is taken from the storage URL or FileStoragePath.
+// It initializes a mutex for thread safety.
 func NewFileKeeper(conf *server.Config, logger logging.ILogger, retrier utils.Retrier) entities.Keeper {
+	_, path, _ := conf.Storage()
 	return &FileKeeper{
-		Logger:  logger,
-		Path:    conf.FileStoragePath,
-		Retrier: retrier,
-		Lock:    &sync.Mutex{},
+		Logger:      logger,
+		Path:        path,
+		Generations: int(conf.StoreGenerations),
+		Format:      conf.StoreFormat,
+		Retrier:     retrier,
+		Lock:        &sync.Mutex{},
 	}
 }
 
-// Flush writes a snapshot of storage data (metrics) to a file in JSON format,
+// Flush writes a snapshot of storage data (metrics) to a file in the configured format,
 // ensuring thread safety and error handling.
 func (fs *FileKeeper) Flush(ctx context.Context, storageSnapshot []*common.Metrics) error {
 	fs.Logger.Infoln("Starting saving the storage data")
@@ -46,59 +55,186 @@ func (fs *FileKeeper) Flush(ctx context.Context, storageSnapshot []*common.Metri
 	fs.Lock.Lock()
 	defer fs.Lock.Unlock()
 
-	file, err := os.OpenFile(fs.Path, os.O_CREATE|os.O_WRONLY, 0666)
-	if err != nil {
-		fs.Logger.Errorf("Failed to open storage file: %s\n", err.Error())
+	if err := fs.write(storageSnapshot); err != nil {
 		return err
 	}
-	defer file.Close()
+	fs.Logger.Infoln("Saving complete")
+	return nil
+}
 
-	for _, metrics := range storageSnapshot {
-		var err error
-		var body []byte
-		body, err = json.Marshal(metrics)
-		if err != nil {
-			fs.Logger.Errorf("Failed to marshal a metric: %s, %s\n", metrics.ID, err.Error())
-			return err
-		}
-		if _, err = file.Write(body); err != nil {
-			fs.Logger.Errorf("Failed to write a metric to the file %s\n", err.Error())
-			return err
+// Restore reads and returns all metrics from the newest valid snapshot, falling back to
+// the previous generations if the current one is corrupted. If every snapshot is corrupted,
+// it panics like the other keepers: starting empty would make the next flushes rotate
+// the snapshots, which may still be recovered by hand, away.
+func (fs *FileKeeper) Restore() []*common.Metrics {
+	fs.Logger.Infoln("Restoring the storage data")
+
+	fs.Lock.Lock()
+	defer fs.Lock.Unlock()
+
+	result, err := fs.readNewestValid()
+	if err != nil {
+		fs.Logger.Errorf("No valid snapshot found: %s\n", err.Error())
+		panic(err)
+	}
+	fs.Logger.Infoln("Success")
+	return result
+}
+
+// Delete removes the metrics with the given IDs from the file storage
+// by rewriting the file without them. The previous generations aren't rotated,
+// so frequent deletions don't push the older snapshots out. The metrics are taken
+// from the newest valid snapshot, the same one Restore would read.
+func (fs *FileKeeper) Delete(ctx context.Context, ids []string) error {
+	fs.Logger.Infof("Deleting %d metrics from the file\n", len(ids))
+
+	fs.Lock.Lock()
+	defer fs.Lock.Unlock()
+
+	stored, err := fs.readNewestValid()
+	if err != nil {
+		fs.Logger.Errorf("No valid snapshot to delete from: %s\n", err.Error())
+		return err
+	}
+	deleted := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		deleted[id] = true
+	}
+	kept := make([]*common.Metrics, 0, len(stored))
+	for _, metrics := range stored {
+		if !deleted[metrics.ID] {
+			kept = append(kept, metrics)
 		}
-		if _, err = file.WriteString("\n"); err != nil {
-			fs.Logger.Errorf("Failed to write a newline to the file %s\n", err.Error())
+	}
+	data, err := EncodeSnapshot(kept, fs.Format)
+	if err != nil {
+		fs.Logger.Errorf("Failed to encode the snapshot: %s\n", err.Error())
+		return err
+	}
+	if err := writeAtomic(fs.Path, data, nil); err != nil {
+		fs.Logger.Errorf("Failed to rewrite the storage file: %s\n", err.Error())
+		return err
+	}
+	fs.Logger.Infoln("Deletion complete")
+	return nil
+}
+
+// write encodes the snapshot and replaces the storage file with it, rotating the previous generations
+func (fs *FileKeeper) write(storageSnapshot []*common.Metrics) error {
+	data, err := EncodeSnapshot(storageSnapshot, fs.Format)
+	if err != nil {
+		fs.Logger.Errorf("Failed to encode the snapshot: %s\n", err.Error())
+		return err
+	}
+	if err := writeAtomic(fs.Path, data, fs.rotate); err != nil {
+		fs.Logger.Errorf("Failed to write the storage file: %s\n", err.Error())
+		return err
+	}
+	return nil
+}
+
+// rotate shifts the previous generations of the snapshot: the current file becomes
+// the first generation, and the oldest generation is overwritten.
+func (fs *FileKeeper) rotate() error {
+	for i := fs.Generations; i > 0; i-- {
+		err := os.Rename(fs.generationPath(i-1), fs.generationPath(i))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
 			return err
 		}
 	}
-	fs.Logger.Infoln("Saving complete")
 	return nil
 }
 
-// Restore reads and returns all metrics from the file storage, parsing them from JSON.
-func (fs *FileKeeper) Restore() []*common.Metrics {
-	fs.Logger.Infoln("Restoring the storage data")
-	var result []*common.Metrics
+// generationPath returns the path of the i-th previous snapshot. The current one is the zeroth.
+func (fs *FileKeeper) generationPath(i int) string {
+	if i == 0 {
+		return fs.Path
+	}
+	return fmt.Sprintf("%s.%d", fs.Path, i)
+}
 
-	file, err := os.OpenFile(fs.Path, os.O_CREATE|os.O_RDONLY, 0666)
+// readNewestValid reads the newest snapshot that isn't corrupted, starting with the current one.
+func (fs *FileKeeper) readNewestValid() ([]*common.Metrics, error) {
+	var errs []error
+	for i := 0; i <= fs.Generations; i++ {
+		result, err := fs.readGeneration(i)
+		if err == nil {
+			if i > 0 {
+				fs.Logger.Warningf("Restored the previous snapshot %s\n", fs.generationPath(i))
+			}
+			return result, nil
+		}
+		fs.Logger.Errorf("Failed to read the snapshot %s: %s\n", fs.generationPath(i), err.Error())
+		errs = append(errs, err)
+	}
+	return nil, errors.Join(errs...)
+}
+
+// readGeneration reads and verifies the i-th previous snapshot. A missing file is treated
+// as an empty snapshot unless there are older generations, which may be left by a crash
+// between rotating the generations and replacing the current file.
+func (fs *FileKeeper) readGeneration(i int) ([]*common.Metrics, error) {
+	data, err := os.ReadFile(fs.generationPath(i))
+	if errors.Is(err, os.ErrNotExist) {
+		if i < fs.Generations && fs.hasGeneration(i+1) {
+			return nil, err
+		}
+		return nil, nil
+	}
 	if err != nil {
-		fs.Logger.Errorf("Failed to open storage file: %v\n", err.Error())
-		panic(err)
+		return nil, err
 	}
-	defer file.Close()
+	return DecodeSnapshot(data)
+}
+
+// hasGeneration checks whether the i-th previous snapshot exists.
+func (fs *FileKeeper) hasGeneration(i int) bool {
+	_, err := os.Stat(fs.generationPath(i))
+	return err == nil
+}
 
-	scanner := bufio.NewScanner(file)
-	scanner.Split(bufio.ScanLines)
-	for scanner.Scan() {
-		metrics := common.Metrics{}
-		err = json.Unmarshal([]byte(scanner.Text()), &metrics)
-		if err != nil {
-			fs.Logger.Errorf("Failed to unmarshal data from file: %v\n", err.Error())
-			panic(err)
+// writeAtomic replaces the file with the data, so that the file is either old or new after a crash.
+// The optional beforeRename is called once the data is safely written, right before replacing the file.
+func writeAtomic(path string, data []byte, beforeRename func() error) error {
+	dir, name := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	file, err := os.CreateTemp(dir, name+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name()) // fails harmlessly after the successful rename
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if beforeRename != nil {
+		if err := beforeRename(); err != nil {
+			return err
 		}
-		result = append(result, &metrics)
 	}
-	fs.Logger.Infoln("Success")
-	return result
+	if err := os.Rename(file.Name(), path); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// syncDir syncs a directory, so that the renames in it survive a crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
 }
 
 // Ping is a no-op for the FileKeeper, as it does not require a live connection.
@@ -3,11 +3,13 @@ package adapters
 import (
 	"context"
 	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 
 	common "github.com/matthiasBT/monitoring/internal/infra/entities"
 	"github.com/matthiasBT/monitoring/internal/infra/logging"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestFileKeeper_Flush(t *testing.T) {
@@ -59,3 +61,170 @@ func TestFileKeeper_Flush(t *testing.T) {
 		})
 	}
 }
+
+func TestFileKeeper_Delete(t *testing.T) {
+	fs := &FileKeeper{
+		Logger:      logging.SetupLogger(),
+		Path:        filepath.Join(t.TempDir(), "metrics.json"),
+		Generations: 2,
+		Lock:        &sync.Mutex{},
+	}
+	previous := []*common.Metrics{{ID: "Previous", MType: common.TypeCounter, Delta: ptrint64(1)}}
+	snapshot := []*common.Metrics{
+		{ID: "BarFoo1", MType: common.TypeGauge, Value: ptrfloat64(44.1)},
+		{ID: "BarFoo2", MType: common.TypeGauge, Value: ptrfloat64(55.5)},
+		{ID: "FooBar", MType: common.TypeCounter, Delta: ptrint64(3)},
+	}
+	for _, flushed := range [][]*common.Metrics{previous, snapshot} {
+		if err := fs.Flush(context.Background(), flushed); err != nil {
+			t.Fatalf("Flush() error = %v", err)
+		}
+	}
+	if err := fs.Delete(context.Background(), []string{"BarFoo1", "FooBar", "Unknown"}); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	restoredState := fs.Restore()
+	if len(restoredState) != 1 || !compare(restoredState[0], snapshot[1]) {
+		t.Errorf("State after Delete() is not equal: %v", restoredState)
+	}
+	generation, err := fs.readGeneration(1)
+	if err != nil || len(generation) != 1 || !compare(generation[0], previous[0]) {
+		t.Errorf("Delete() must not rotate the generations, the first one is: %v, %v", generation, err)
+	}
+	if fs.hasGeneration(2) {
+		t.Errorf("Delete() must not rotate the generations")
+	}
+}
+
+func TestFileKeeper_DeleteCorrupt(t *testing.T) {
+	fs := &FileKeeper{
+		Logger:      logging.SetupLogger(),
+		Path:        filepath.Join(t.TempDir(), "metrics.json"),
+		Generations: 2,
+		Lock:        &sync.Mutex{},
+	}
+	previous := []*common.Metrics{
+		{ID: "BarFoo1", MType: common.TypeGauge, Value: ptrfloat64(44.1)},
+		{ID: "FooBar", MType: common.TypeCounter, Delta: ptrint64(3)},
+	}
+	for _, flushed := range [][]*common.Metrics{previous, previous[:1]} {
+		if err := fs.Flush(context.Background(), flushed); err != nil {
+			t.Fatalf("Flush() error = %v", err)
+		}
+	}
+	if err := os.WriteFile(fs.Path, []byte("garbage"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Delete(context.Background(), []string{"BarFoo1"}); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	restoredState := fs.Restore()
+	if len(restoredState) != 1 || !compare(restoredState[0], previous[1]) {
+		t.Errorf("Delete() must rewrite the newest valid snapshot, got: %v", restoredState)
+	}
+}
+
+func TestFileKeeper_Restore(t *testing.T) {
+	first := []*common.Metrics{
+		{ID: "BarFoo1", MType: common.TypeGauge, Value: ptrfloat64(44.1)},
+		{ID: "FooBar", MType: common.TypeCounter, Delta: ptrint64(3)},
+	}
+	second := []*common.Metrics{
+		{ID: "FooBar", MType: common.TypeCounter, Delta: ptrint64(5)},
+	}
+	tests := []struct {
+		name      string
+		corrupt   func(t *testing.T, fs *FileKeeper)
+		want      []*common.Metrics
+		wantPanic bool
+	}{
+		{
+			name:    "latest_snapshot",
+			corrupt: func(t *testing.T, fs *FileKeeper) {},
+			want:    second,
+		},
+		{
+			name: "corrupt_latest_snapshot",
+			corrupt: func(t *testing.T, fs *FileKeeper) {
+				data, err := os.ReadFile(fs.Path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(fs.Path, data[:len(data)-5], 0666); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: first,
+		},
+		{
+			name: "missing_latest_snapshot",
+			corrupt: func(t *testing.T, fs *FileKeeper) {
+				if err := os.Remove(fs.Path); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: first,
+		},
+		{
+			name: "all_snapshots_corrupt",
+			corrupt: func(t *testing.T, fs *FileKeeper) {
+				for i := 0; i <= fs.Generations; i++ {
+					if err := os.WriteFile(fs.generationPath(i), []byte("garbage"), 0666); err != nil {
+						t.Fatal(err)
+					}
+				}
+			},
+			wantPanic: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := &FileKeeper{
+				Logger:      logging.SetupLogger(),
+				Path:        filepath.Join(t.TempDir(), "metrics.json"),
+				Generations: 2,
+				Lock:        &sync.Mutex{},
+			}
+			for _, snapshot := range [][]*common.Metrics{first, second} {
+				if err := fs.Flush(context.Background(), snapshot); err != nil {
+					t.Fatalf("Flush() error = %v", err)
+				}
+			}
+			tt.corrupt(t, fs)
+			if tt.wantPanic {
+				if !assert.Panics(t, func() { fs.Restore() }, "The server must not start without the snapshots") {
+					return
+				}
+				for i := 0; i <= fs.Generations; i++ {
+					assert.True(t, fs.hasGeneration(i), "The corrupted snapshots must be kept for recovery")
+				}
+				return
+			}
+			got := fs.Restore()
+			if len(got) != len(tt.want) {
+				t.Fatalf("Restore() returned %d metrics, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if !compare(got[i], tt.want[i]) {
+					t.Errorf("Restore() metric %d = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFileKeeper_RestoreLegacy(t *testing.T) {
+	fs := &FileKeeper{
+		Logger: logging.SetupLogger(),
+		Path:   filepath.Join(t.TempDir(), "metrics.json"),
+		Lock:   &sync.Mutex{},
+	}
+	legacy := `{"id":"FooBar","type":"counter","delta":3}` + "\n"
+	if err := os.WriteFile(fs.Path, []byte(legacy), 0666); err != nil {
+		t.Fatal(err)
+	}
+	got := fs.Restore()
+	if len(got) != 1 || *got[0].Delta != 3 {
+		t.Errorf("Snapshots without a header must be restored, got: %v", got)
+	}
+}
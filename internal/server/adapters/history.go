@@ -0,0 +1,290 @@
+// Package adapters provides functionality for keeping the history of
+// metric values in memory. The history consists of retention tiers: raw samples
+// are kept for a short time and are rolled up into coarser tiers by a background
+// compaction job, so that longer periods take less memory.
+package adapters
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	common "github.com/matthiasBT/monitoring/internal/infra/entities"
+	"github.com/matthiasBT/monitoring/internal/server/entities"
+)
+
+// defCompactInterval is the compaction interval used when there are no rollup tiers.
+const defCompactInterval = time.Minute
+
+// ErrInvalidRetention is returned when a retention specification can't be parsed.
+var ErrInvalidRetention = errors.New("invalid history retention")
+
+// Tier describes how long the samples of a single resolution are kept.
+type Tier struct {
+	Resolution time.Duration // Width of the rollup buckets, zero for raw samples
+	Retention  time.Duration // Time the samples are kept for, zero to keep them until the limit is hit
+	Limit      int           // Maximal number of samples kept per metric, set by NewHistory
+}
+
+// series holds the samples of a single metric in chronological order.
+type series struct {
+	MType  string              // Type of the metric the samples belong to
+	Tiers  [][]entities.Sample // Samples of every tier, oldest first
+	Rolled []time.Time         // For every tier, the moment before which the finer samples are already rolled up
+}
+
+// History is a struct that keeps the samples of every metric in memory.
+// A nil History records nothing.
+type History struct {
+	Lock   *sync.Mutex        // Mutex for synchronization
+	Series map[string]*series // Samples by metric ID
+	Limit  int                // Maximal number of raw samples kept per metric, zero to keep no history
+	Tiers  []Tier             // Retention tiers, the raw one first
+}
+
+// NewHistory creates and returns a new History keeping up to limit raw samples per metric.
+// A rollup tier keeps as many samples as its retention needs at its resolution, plus the bucket
+// crossing the retention deadline, or up to limit samples if it has no retention.
+// Without tiers, only raw samples are kept.
+func NewHistory(limit int, tiers []Tier) *History {
+	if len(tiers) == 0 {
+		tiers = []Tier{{}}
+	}
+	tiers = append([]Tier(nil), tiers...)
+	for i := range tiers {
+		tiers[i].Limit = limit
+		if i > 0 && tiers[i].Retention > 0 {
+			tiers[i].Limit = int((tiers[i].Retention+tiers[i].Resolution-1)/tiers[i].Resolution) + 1
+		}
+	}
+	return &History{
+		Lock:   &sync.Mutex{},
+		Series: make(map[string]*series),
+		Limit:  limit,
+		Tiers:  tiers,
+	}
+}
+
+// ParseRetention parses a comma-separated list of retention tiers like "raw:1d,1m:30d,1h:365d".
+// Every tier is a resolution ("raw" for raw samples) and a retention period. Durations are
+// accepted in the time.ParseDuration format or as a whole number of days. The first tier must
+// be the raw one, resolutions must grow, and every tier must keep its samples at least for
+// the resolution of the next tier, so that they can be rolled up.
+func ParseRetention(spec string) ([]Tier, error) {
+	var tiers []Tier
+	for _, part := range strings.Split(spec, ",") {
+		resolution, retention, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok {
+			return nil, fmt.Errorf("%w: tier %q must look like resolution:retention", ErrInvalidRetention, part)
+		}
+		var tier Tier
+		var err error
+		if resolution != "raw" {
+			if tier.Resolution, err = parseDays(resolution); err != nil || tier.Resolution <= 0 {
+				return nil, fmt.Errorf("%w: bad resolution %q", ErrInvalidRetention, resolution)
+			}
+		}
+		if tier.Retention, err = parseDays(retention); err != nil || tier.Retention < 0 {
+			return nil, fmt.Errorf("%w: bad retention %q", ErrInvalidRetention, retention)
+		}
+		tiers = append(tiers, tier)
+	}
+	if tiers[0].Resolution != 0 {
+		return nil, fmt.Errorf("%w: the first tier must be raw", ErrInvalidRetention)
+	}
+	for i := 1; i < len(tiers); i++ {
+		prev, tier := tiers[i-1], tiers[i]
+		if tier.Resolution <= prev.Resolution {
+			return nil, fmt.Errorf("%w: resolutions must grow", ErrInvalidRetention)
+		}
+		if prev.Retention != 0 && prev.Retention < tier.Resolution {
+			return nil, fmt.Errorf("%w: %v samples expire before they're rolled up", ErrInvalidRetention, prev.Retention)
+		}
+	}
+	return tiers, nil
+}
+
+// parseDays parses a duration, additionally accepting a whole number of days like "30d".
+func parseDays(raw string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(raw, "d"); ok {
+		n, err := strconv.Atoi(days)
+		return time.Duration(n) * 24 * time.Hour, err
+	}
+	return time.ParseDuration(raw)
+}
+
+// CompactInterval returns how often the history should be compacted:
+// the resolution of the finest rollup tier, or a minute if there are no rollups.
+func (h *History) CompactInterval() time.Duration {
+	if h == nil || len(h.Tiers) < 2 {
+		return defCompactInterval
+	}
+	return h.Tiers[1].Resolution
+}
+
+// Record appends the current value of the metric to its raw history.
+// If the type of the metric has changed, the previous samples are dropped.
+func (h *History) Record(metrics *common.Metrics, at time.Time) {
+	if h == nil || h.Limit <= 0 {
+		return
+	}
+	h.Lock.Lock()
+	defer h.Lock.Unlock()
+
+	s := h.Series[metrics.ID]
+	if s == nil || s.MType != metrics.MType {
+		s = &series{
+			MType:  metrics.MType,
+			Tiers:  make([][]entities.Sample, len(h.Tiers)),
+			Rolled: make([]time.Time, len(h.Tiers)),
+		}
+		h.Series[metrics.ID] = s
+	}
+	sample := entities.Sample{Time: at, Value: sampleValue(metrics)}
+	s.Tiers[0] = limitSamples(append(s.Tiers[0], sample), h.Tiers[0].Limit)
+}
+
+// Compact rolls up the complete buckets of every tier into the next one and drops
+// the samples that have outlived their retention.
+func (h *History) Compact(now time.Time) {
+	if h == nil {
+		return
+	}
+	h.Lock.Lock()
+	defer h.Lock.Unlock()
+
+	for _, s := range h.Series {
+		for i := 1; i < len(h.Tiers); i++ {
+			s.rollup(i, h.Tiers[i].Resolution, now)
+			s.Tiers[i] = limitSamples(s.Tiers[i], h.Tiers[i].Limit)
+		}
+		for i, tier := range h.Tiers {
+			if tier.Retention > 0 {
+				s.Tiers[i] = dropBefore(s.Tiers[i], now.Add(-tier.Retention))
+			}
+		}
+	}
+}
+
+// Query returns the samples of the metric recorded within [from, to]. Zero bounds are treated as open.
+// The finest tier still covering from is used; without from, the raw tier is used.
+// Returns ErrUnknownMetric if there is no history for the metric.
+func (h *History) Query(query *common.Metrics, from, to time.Time) ([]entities.Sample, error) {
+	if h == nil {
+		return nil, common.ErrUnknownMetric
+	}
+	h.Lock.Lock()
+	defer h.Lock.Unlock()
+
+	s := h.Series[query.ID]
+	if s == nil || s.MType != query.MType {
+		return nil, common.ErrUnknownMetric
+	}
+	samples := s.Tiers[h.pickTier(from, time.Now())]
+	result := make([]entities.Sample, 0, len(samples))
+	for _, sample := range samples {
+		if !from.IsZero() && sample.Time.Before(from) || !to.IsZero() && sample.Time.After(to) {
+			continue
+		}
+		result = append(result, sample)
+	}
+	return result, nil
+}
+
+// Delete drops the history of the metrics with the given IDs.
+func (h *History) Delete(ids []string) {
+	if h == nil {
+		return
+	}
+	h.Lock.Lock()
+	defer h.Lock.Unlock()
+
+	for _, id := range ids {
+		delete(h.Series, id)
+	}
+}
+
+// pickTier returns the index of the finest tier whose retention covers the moment from.
+func (h *History) pickTier(from, now time.Time) int {
+	if from.IsZero() {
+		return 0
+	}
+	for i, tier := range h.Tiers {
+		if tier.Retention == 0 || !from.Before(now.Add(-tier.Retention)) {
+			return i
+		}
+	}
+	return len(h.Tiers) - 1
+}
+
+// limitSamples drops the oldest samples exceeding the limit.
+func limitSamples(samples []entities.Sample, limit int) []entities.Sample {
+	if len(samples) > limit {
+		return samples[len(samples)-limit:]
+	}
+	return samples
+}
+
+// rollup aggregates the samples of the tier preceding the i-th one into buckets of the given
+// resolution. Only the buckets completed by now and not rolled up before are aggregated.
+// Gauges are averaged, while counters keep the last value of the bucket.
+func (s *series) rollup(i int, resolution time.Duration, now time.Time) {
+	cutoff := now.Truncate(resolution)
+	var bucket *entities.Sample
+	var sum float64
+	for _, sample := range s.Tiers[i-1] {
+		if sample.Time.Before(s.Rolled[i]) {
+			continue
+		}
+		if !sample.Time.Before(cutoff) {
+			break
+		}
+		start := sample.Time.Truncate(resolution)
+		if bucket == nil || !bucket.Time.Equal(start) {
+			if bucket != nil {
+				s.Tiers[i] = append(s.Tiers[i], s.closeBucket(bucket, sum))
+			}
+			bucket, sum = &entities.Sample{Time: start}, 0
+		}
+		count := sample.Count
+		if count == 0 {
+			count = 1
+		}
+		bucket.Count += count
+		bucket.Value = sample.Value
+		sum += sample.Value * float64(count)
+	}
+	if bucket != nil {
+		s.Tiers[i] = append(s.Tiers[i], s.closeBucket(bucket, sum))
+	}
+	s.Rolled[i] = cutoff
+}
+
+// closeBucket finalizes the value of a rollup bucket given the weighted sum of its samples.
+func (s *series) closeBucket(bucket *entities.Sample, sum float64) entities.Sample {
+	if s.MType == common.TypeGauge {
+		bucket.Value = sum / float64(bucket.Count)
+	}
+	return *bucket
+}
+
+// dropBefore drops the samples recorded before the deadline.
+func dropBefore(samples []entities.Sample, deadline time.Time) []entities.Sample {
+	for i, sample := range samples {
+		if !sample.Time.Before(deadline) {
+			return samples[i:]
+		}
+	}
+	return nil
+}
+
+// sampleValue returns the value of a gauge or a counter as a float.
+func sampleValue(metrics *common.Metrics) float64 {
+	if metrics.MType == common.TypeCounter {
+		return float64(*metrics.Delta)
+	}
+	return *metrics.Value
+}
@@ -0,0 +1,193 @@
+package adapters
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	common "github.com/matthiasBT/monitoring/internal/infra/entities"
+	"github.com/matthiasBT/monitoring/internal/server/entities"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistory_Record(t *testing.T) {
+	start := time.Date(2023, 11, 1, 12, 0, 0, 0, time.UTC)
+	history := NewHistory(3, nil)
+	for i := 0; i < 5; i++ {
+		history.Record(&common.Metrics{ID: "Foo", MType: common.TypeCounter, Delta: ptrint64(int64(i))},
+			start.Add(time.Duration(i)*time.Second))
+	}
+	got, err := history.Query(&common.Metrics{ID: "Foo", MType: common.TypeCounter}, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	want := []entities.Sample{
+		{Time: start.Add(2 * time.Second), Value: 2},
+		{Time: start.Add(3 * time.Second), Value: 3},
+		{Time: start.Add(4 * time.Second), Value: 4},
+	}
+	assert.Equal(t, want, got)
+
+	history.Record(&common.Metrics{ID: "Foo", MType: common.TypeGauge, Value: ptrfloat64(1.5)}, start)
+	got, err = history.Query(&common.Metrics{ID: "Foo", MType: common.TypeGauge}, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	assert.Equal(t, []entities.Sample{{Time: start, Value: 1.5}}, got, "Type change must reset the history")
+}
+
+func TestHistory_Query(t *testing.T) {
+	start := time.Date(2023, 11, 1, 12, 0, 0, 0, time.UTC)
+	history := NewHistory(10, nil)
+	for i := 0; i < 5; i++ {
+		history.Record(&common.Metrics{ID: "Foo", MType: common.TypeGauge, Value: ptrfloat64(float64(i))},
+			start.Add(time.Duration(i)*time.Minute))
+	}
+	query := &common.Metrics{ID: "Foo", MType: common.TypeGauge}
+	got, err := history.Query(query, start.Add(time.Minute), start.Add(3*time.Minute))
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	assert.Len(t, got, 3)
+
+	_, err = history.Query(&common.Metrics{ID: "Foo", MType: common.TypeCounter}, time.Time{}, time.Time{})
+	if !errors.Is(err, common.ErrUnknownMetric) {
+		t.Errorf("Type mismatch must be reported as an unknown metric, got: %v", err)
+	}
+	history.Delete([]string{"Foo"})
+	if _, err := history.Query(query, time.Time{}, time.Time{}); !errors.Is(err, common.ErrUnknownMetric) {
+		t.Errorf("Deleted history must be reported as an unknown metric, got: %v", err)
+	}
+}
+
+func TestParseRetention(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    []Tier
+		wantErr bool
+	}{
+		{
+			name: "default",
+			spec: "raw:1d,1m:30d,1h:365d",
+			want: []Tier{
+				{Retention: 24 * time.Hour},
+				{Resolution: time.Minute, Retention: 30 * 24 * time.Hour},
+				{Resolution: time.Hour, Retention: 365 * 24 * time.Hour},
+			},
+		},
+		{
+			name: "raw_forever",
+			spec: "raw:0",
+			want: []Tier{{}},
+		},
+		{
+			name:    "no_raw_tier",
+			spec:    "1m:30d",
+			wantErr: true,
+		},
+		{
+			name:    "resolutions_must_grow",
+			spec:    "raw:1d,1h:30d,1m:365d",
+			wantErr: true,
+		},
+		{
+			name:    "expires_before_rollup",
+			spec:    "raw:30s,1m:30d",
+			wantErr: true,
+		},
+		{
+			name:    "malformed",
+			spec:    "raw=1d",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRetention(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRetention() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				assert.True(t, errors.Is(err, ErrInvalidRetention))
+				return
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestHistory_Compact(t *testing.T) {
+	start := time.Date(2023, 11, 1, 12, 0, 0, 0, time.UTC)
+	tiers := []Tier{
+		{Retention: 2 * time.Minute},
+		{Resolution: time.Minute, Retention: time.Hour},
+		{Resolution: time.Hour},
+	}
+	history := NewHistory(1000, tiers)
+	for i := 0; i < 180; i++ { // a sample every second for 3 minutes
+		at := start.Add(time.Duration(i) * time.Second)
+		history.Record(&common.Metrics{ID: "Gauge", MType: common.TypeGauge, Value: ptrfloat64(float64(i / 60))}, at)
+		history.Record(&common.Metrics{ID: "Counter", MType: common.TypeCounter, Delta: ptrint64(int64(i))}, at)
+	}
+
+	history.Compact(start.Add(150 * time.Second))
+	gauge := history.Series["Gauge"]
+	assert.Len(t, gauge.Tiers[0], 150, "Raw samples of the last 2 minutes must be kept")
+	assert.Equal(t, []entities.Sample{
+		{Time: start, Value: 0, Count: 60},
+		{Time: start.Add(time.Minute), Value: 1, Count: 60},
+	}, gauge.Tiers[1])
+	assert.Empty(t, gauge.Tiers[2], "The first hour isn't complete yet")
+
+	history.Compact(start.Add(time.Hour))
+	assert.Empty(t, gauge.Tiers[0])
+	assert.Len(t, gauge.Tiers[1], 3, "Rolled up samples must not be duplicated")
+	assert.Equal(t, []entities.Sample{{Time: start, Value: 1, Count: 180}}, gauge.Tiers[2])
+	assert.Equal(t, []entities.Sample{{Time: start, Value: 179, Count: 180}}, history.Series["Counter"].Tiers[2])
+
+	history.Compact(start.Add(2 * time.Hour))
+	assert.Empty(t, gauge.Tiers[1])
+	assert.Len(t, gauge.Tiers[2], 1, "Samples of the last tier without retention must be kept")
+}
+
+func TestHistory_pickTier(t *testing.T) {
+	now := time.Date(2023, 11, 1, 12, 0, 0, 0, time.UTC)
+	tiers, err := ParseRetention("raw:1d,1m:30d,1h:365d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	history := NewHistory(10, tiers)
+	assert.Equal(t, 0, history.pickTier(time.Time{}, now))
+	assert.Equal(t, 0, history.pickTier(now.Add(-time.Hour), now))
+	assert.Equal(t, 1, history.pickTier(now.Add(-7*24*time.Hour), now))
+	assert.Equal(t, 2, history.pickTier(now.Add(-90*24*time.Hour), now))
+	assert.Equal(t, 2, history.pickTier(now.Add(-900*24*time.Hour), now))
+}
+
+func TestNewHistory_tierLimits(t *testing.T) {
+	tiers, err := ParseRetention("raw:1d,1m:30d,1h:365d,1d:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	history := NewHistory(43200, tiers)
+	var limits []int
+	for _, tier := range history.Tiers {
+		limits = append(limits, tier.Limit)
+	}
+	assert.Equal(t, []int{43200, 30*24*60 + 1, 365*24 + 1, 43200}, limits)
+	assert.Zero(t, tiers[1].Limit, "The given tiers must not be changed")
+}
+
+func TestHistory_CompactRollupLimit(t *testing.T) {
+	start := time.Date(2023, 11, 1, 12, 0, 0, 0, time.UTC)
+	history := NewHistory(2, []Tier{{}, {Resolution: time.Second, Retention: time.Minute}})
+	for i := 0; i < 10; i++ {
+		at := start.Add(time.Duration(i) * time.Second)
+		history.Record(&common.Metrics{ID: "Gauge", MType: common.TypeGauge, Value: ptrfloat64(float64(i))}, at)
+		history.Compact(at.Add(time.Second))
+	}
+	gauge := history.Series["Gauge"]
+	assert.Len(t, gauge.Tiers[0], 2)
+	assert.Len(t, gauge.Tiers[1], 10, "The raw limit must not cap the rollup tiers")
+}
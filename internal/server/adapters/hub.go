@@ -0,0 +1,102 @@
+// Package adapters provides a publish/subscribe hub delivering metric changes
+// to subscribers. Every subscriber has a bounded buffer, and publishing never
+// blocks: when a buffer is full, the oldest pending event of that subscriber is dropped.
+package adapters
+
+import (
+	"context"
+	"sync"
+
+	"github.com/matthiasBT/monitoring/internal/infra/logging"
+	"github.com/matthiasBT/monitoring/internal/server/entities"
+)
+
+// subscription holds the buffered channel and the filter of a single subscriber.
+type subscription struct {
+	Events chan entities.Event // Buffered channel of pending events
+	Filter *entities.Filter    // Selection of metrics the subscriber is interested in
+}
+
+// Hub is a struct that manages subscribers and delivers published events to them.
+// A nil Hub publishes nothing.
+type Hub struct {
+	Lock          *sync.Mutex                // Mutex for synchronization
+	Subscriptions map[*subscription]struct{} // Active subscriptions
+	BufferSize    int                        // Number of pending events kept per subscriber
+	Logger        logging.ILogger            // Logger for logging activities
+}
+
+// NewHub creates and returns a new Hub buffering up to bufferSize events per subscriber.
+func NewHub(logger logging.ILogger, bufferSize int) *Hub {
+	if bufferSize < 1 {
+		bufferSize = 1
+	}
+	return &Hub{
+		Lock:          &sync.Mutex{},
+		Subscriptions: make(map[*subscription]struct{}),
+		BufferSize:    bufferSize,
+		Logger:        logger,
+	}
+}
+
+// Subscribe registers a new subscriber for the events of the metrics selected by the filter.
+// The returned channel is closed after the context is cancelled. A nil Hub returns
+// a channel that never receives events.
+func (h *Hub) Subscribe(ctx context.Context, filter *entities.Filter) <-chan entities.Event {
+	if h == nil {
+		events := make(chan entities.Event)
+		go func() {
+			<-ctx.Done()
+			close(events)
+		}()
+		return events
+	}
+	sub := &subscription{
+		Events: make(chan entities.Event, h.BufferSize),
+		Filter: filter,
+	}
+	h.Lock.Lock()
+	h.Subscriptions[sub] = struct{}{}
+	h.Logger.Infof("New subscriber, %d in total\n", len(h.Subscriptions))
+	h.Lock.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		h.Lock.Lock()
+		defer h.Lock.Unlock()
+		delete(h.Subscriptions, sub)
+		close(sub.Events)
+		h.Logger.Infof("Subscriber left, %d in total\n", len(h.Subscriptions))
+	}()
+	return sub.Events
+}
+
+// Publish delivers the event to all subscribers interested in it without blocking.
+func (h *Hub) Publish(event entities.Event) {
+	if h == nil {
+		return
+	}
+	h.Lock.Lock()
+	defer h.Lock.Unlock()
+
+	for sub := range h.Subscriptions {
+		if !sub.Filter.Match(event.Metrics) {
+			continue
+		}
+		select {
+		case sub.Events <- event:
+			continue
+		default:
+		}
+		// the subscriber is too slow, so the oldest event gives way to the newest one
+		select {
+		case <-sub.Events:
+			h.Logger.Warningf("Subscriber buffer is full, dropped an event\n")
+		default:
+		}
+		select {
+		case sub.Events <- event:
+		default:
+		}
+	}
+}
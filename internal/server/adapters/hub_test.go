@@ -0,0 +1,70 @@
+package adapters
+
+import (
+	"context"
+	"testing"
+
+	common "github.com/matthiasBT/monitoring/internal/infra/entities"
+	"github.com/matthiasBT/monitoring/internal/infra/logging"
+	"github.com/matthiasBT/monitoring/internal/server/entities"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHub_Publish(t *testing.T) {
+	hub := NewHub(logging.SetupLogger(), 2)
+	ctx, cancel := context.WithCancel(context.Background())
+	all := hub.Subscribe(ctx, &entities.Filter{})
+	counters := hub.Subscribe(ctx, &entities.Filter{MType: common.TypeCounter})
+
+	for i := 0; i < 3; i++ {
+		hub.Publish(entities.Event{
+			Kind:    entities.EventUpdate,
+			Metrics: &common.Metrics{ID: "Foo", MType: common.TypeCounter, Delta: ptrint64(int64(i))},
+		})
+	}
+	hub.Publish(entities.Event{
+		Kind:    entities.EventDelete,
+		Metrics: &common.Metrics{ID: "Bar", MType: common.TypeGauge},
+	})
+
+	// the buffers are full, so only the newest events are kept
+	assert.Equal(t, int64(2), *(<-all).Metrics.Delta)
+	assert.Equal(t, "Bar", (<-all).Metrics.ID)
+	assert.Equal(t, int64(1), *(<-counters).Metrics.Delta)
+	assert.Equal(t, int64(2), *(<-counters).Metrics.Delta)
+
+	cancel()
+	for range all {
+		t.Error("No events must be left after the subscription is cancelled")
+	}
+	for range counters {
+		t.Error("No events must be left after the subscription is cancelled")
+	}
+	assert.Empty(t, hub.Subscriptions)
+}
+
+func TestMemStorage_Subscribe(t *testing.T) {
+	hub := NewHub(logging.SetupLogger(), 10)
+	storage := NewMemStorage(nil, nil, logging.SetupLogger(), nil, 0, nil, hub, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := storage.Subscribe(ctx, &entities.Filter{IDs: []string{"Foo"}})
+
+	storage.Add(ctx, &common.Metrics{ID: "Foo", MType: common.TypeCounter, Delta: ptrint64(1)})
+	storage.Add(ctx, &common.Metrics{ID: "Bar", MType: common.TypeCounter, Delta: ptrint64(1)})
+	storage.Add(ctx, &common.Metrics{ID: "Foo", MType: common.TypeCounter, Delta: ptrint64(2)})
+	if err := storage.Delete(ctx, &common.Metrics{ID: "Foo", MType: common.TypeCounter}); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	event := <-events
+	assert.Equal(t, entities.EventUpdate, event.Kind)
+	assert.Equal(t, int64(1), *event.Metrics.Delta)
+	event = <-events
+	assert.Equal(t, entities.EventUpdate, event.Kind)
+	assert.Equal(t, int64(3), *event.Metrics.Delta)
+	event = <-events
+	assert.Equal(t, entities.EventDelete, event.Kind)
+	assert.Equal(t, "Foo", event.Metrics.ID)
+	assert.Empty(t, events)
+}
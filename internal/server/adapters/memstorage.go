@@ -23,11 +23,16 @@ type State struct {
 // MemStorage is a struct that manages in-memory storage operations,
 // periodic flushing to external storage, and logging.
 type MemStorage struct {
-	State                   // Embedded in-memory state
-	Done   <-chan struct{}  // Channel signaling the end of the application
-	Tick   <-chan time.Time // Ticker channel for periodic operations
-	Logger logging.ILogger  // Logger for logging activities
-	Keeper entities.Keeper  // External storage Keeper for flushing data
+	State                          // Embedded in-memory state
+	Done       <-chan struct{}     // Channel signaling the end of the application
+	Tick       <-chan time.Time    // Ticker channel for periodic flushes. If nil, every update is flushed immediately
+	Logger     logging.ILogger     // Logger for logging activities
+	Keeper     entities.Keeper     // External storage Keeper for flushing data
+	StaleAfter time.Duration       // Time without updates after which a metric is considered stale
+	History    *History            // Recent values of the metrics
+	Hub        *Hub                // Hub notifying the subscribers about metric changes
+	WAL        *WAL                // Write-ahead log of changes, replacing flushes on every update if set
+	Dirty      map[string]struct{} // IDs of the metrics changed since the last flush
 }
 
 // NewMemStorage creates and returns a new MemStorage instance.
@@ -37,16 +42,24 @@ func NewMemStorage(
 	tick <-chan time.Time,
 	logger logging.ILogger,
 	keeper entities.Keeper,
+	staleAfter time.Duration,
+	history *History,
+	hub *Hub,
+	wal *WAL,
 ) entities.Storage {
 	return &MemStorage{
 		State: State{
 			Metrics: make(map[string]*common.Metrics),
 			Lock:    &sync.Mutex{},
 		},
-		Done:   done,
-		Tick:   tick,
-		Logger: logger,
-		Keeper: keeper,
+		Done:       done,
+		Tick:       tick,
+		Logger:     logger,
+		Keeper:     keeper,
+		StaleAfter: staleAfter,
+		History:    history,
+		Hub:        hub,
+		WAL:        wal,
 	}
 }
 
@@ -73,19 +86,100 @@ func (storage *MemStorage) AddBatch(ctx context.Context, batch []*common.Metrics
 }
 
 // Get retrieves a single metric from the in-memory storage based on query criteria.
+// The result is a copy of the stored metric with its staleness flag set.
 func (storage *MemStorage) Get(ctx context.Context, query *common.Metrics) (*common.Metrics, error) {
+	storage.Lock.Lock()
+	defer storage.Lock.Unlock()
+
 	storage.Logger.Infof("Getting the metric %s %s\n", query.ID, query.MType)
 	result, ok := storage.Metrics[query.ID]
 	if !ok || result.MType != query.MType {
 		storage.Logger.Errorf("No such metric\n")
 		return nil, common.ErrUnknownMetric
 	}
-	return result, nil
+	return storage.withStaleness(result, time.Now()), nil
 }
 
-// GetAll returns all metrics currently stored in-memory.
+// GetAll returns copies of all metrics currently stored in-memory with their staleness flags set.
 func (storage *MemStorage) GetAll(ctx context.Context) (map[string]*common.Metrics, error) {
-	return storage.Metrics, nil
+	storage.Lock.Lock()
+	defer storage.Lock.Unlock()
+
+	now := time.Now()
+	result := make(map[string]*common.Metrics, len(storage.Metrics))
+	for id, metrics := range storage.Metrics {
+		result[id] = storage.withStaleness(metrics, now)
+	}
+	return result, nil
+}
+
+// GetHistory returns the recent values of a metric recorded within [from, to].
+func (storage *MemStorage) GetHistory(
+	ctx context.Context, query *common.Metrics, from, to time.Time,
+) ([]entities.Sample, error) {
+	storage.Logger.Infof("Getting the history of the metric %s %s\n", query.ID, query.MType)
+	return storage.History.Query(query, from, to)
+}
+
+// Subscribe returns a channel of the changes of the metrics selected by the filter.
+// The channel is closed after the context is cancelled.
+func (storage *MemStorage) Subscribe(ctx context.Context, filter *entities.Filter) <-chan entities.Event {
+	return storage.Hub.Subscribe(ctx, filter)
+}
+
+// Delete removes a single metric from the in-memory storage and from the Keeper, if available.
+func (storage *MemStorage) Delete(ctx context.Context, query *common.Metrics) error {
+	storage.Lock.Lock()
+	defer storage.Lock.Unlock()
+
+	storage.Logger.Infof("Deleting the metric %s %s\n", query.ID, query.MType)
+	metrics, ok := storage.Metrics[query.ID]
+	if !ok || metrics.MType != query.MType {
+		storage.Logger.Errorf("No such metric\n")
+		return common.ErrUnknownMetric
+	}
+	return storage.deleteIDs(ctx, []string{query.ID})
+}
+
+// DeleteMatching removes all metrics selected by the filter from the in-memory storage
+// and from the Keeper, if available.
+func (storage *MemStorage) DeleteMatching(ctx context.Context, filter *entities.Filter) (int, error) {
+	storage.Lock.Lock()
+	defer storage.Lock.Unlock()
+
+	return storage.deleteMatching(ctx, filter)
+}
+
+// Truncate removes all metrics from the in-memory storage and from the Keeper, if available.
+func (storage *MemStorage) Truncate(ctx context.Context) (int, error) {
+	storage.Lock.Lock()
+	defer storage.Lock.Unlock()
+
+	storage.Logger.Infoln("Truncating the storage")
+	return storage.deleteMatching(ctx, &entities.Filter{})
+}
+
+// ResetCounter sets the value of an existing counter to zero.
+func (storage *MemStorage) ResetCounter(ctx context.Context, name string) (*common.Metrics, error) {
+	storage.Lock.Lock()
+	defer storage.Lock.Unlock()
+
+	storage.Logger.Infof("Resetting the counter %s\n", name)
+	metrics, ok := storage.Metrics[name]
+	if !ok || metrics.MType != common.TypeCounter {
+		storage.Logger.Errorf("No such counter\n")
+		return nil, common.ErrUnknownMetric
+	}
+	var zero int64
+	now := time.Now()
+	metrics.Delta = &zero
+	metrics.UpdatedAt = &now
+	storage.History.Record(metrics, now)
+	storage.publish(entities.EventUpdate, metrics)
+	if err := storage.persist(ctx, metrics); err != nil {
+		return nil, err
+	}
+	return storage.withStaleness(metrics, now), nil
 }
 
 // Snapshot creates and returns a snapshot of the current in-memory metrics.
@@ -98,16 +192,45 @@ func (storage *MemStorage) Snapshot(context.Context) ([]*common.Metrics, error)
 }
 
 // Init initializes the in-memory storage with provided data.
+// Metrics without an update timestamp are considered updated at the moment of initialization.
 func (storage *MemStorage) Init(data []*common.Metrics) {
 	storage.Logger.Infoln("Initializing the storage with new data. Old data will be lost")
+	now := time.Now()
 	result := make(map[string]*common.Metrics, len(data))
 	for _, metrics := range data {
+		if metrics.UpdatedAt == nil {
+			metrics.UpdatedAt = &now
+		}
 		result[metrics.ID] = metrics
 	}
 	storage.Metrics = result
 	storage.Logger.Infoln("Init finished successfully")
 }
 
+// Replay applies the changes logged in the WAL since the last checkpoint on top of the current state.
+// It's called after Init, so the restored snapshot is brought up to date.
+func (storage *MemStorage) Replay() error {
+	storage.Lock.Lock()
+	defer storage.Lock.Unlock()
+
+	records, err := storage.WAL.Replay()
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		switch record.Op {
+		case walSet:
+			storage.Metrics[record.Metrics.ID] = record.Metrics
+			storage.markDirty(record.Metrics.ID)
+		case walDelete:
+			delete(storage.Metrics, record.Metrics.ID)
+			delete(storage.Dirty, record.Metrics.ID)
+		}
+	}
+	storage.Logger.Infof("Replayed %d WAL records\n", len(records))
+	return nil
+}
+
 // Ping delegates the ping operation to the Keeper, if available.
 func (storage *MemStorage) Ping(ctx context.Context) error {
 	if storage.Keeper != nil {
@@ -123,26 +246,141 @@ func (storage *MemStorage) FlushPeriodic(ctx context.Context) {
 		select {
 		case <-storage.Done:
 			storage.Logger.Infoln("Stopping the FlushPeriodic job")
-			if err := storage.flush(ctx); err != nil {
+			if err := storage.checkpoint(ctx); err != nil {
 				panic(err)
 			}
 			return
 		case tick := <-storage.Tick:
 			storage.Logger.Infof("The FlushPeriodic job is ticking at %v\n", tick)
-			if err := storage.flush(ctx); err != nil {
+			if err := storage.checkpoint(ctx); err != nil {
 				storage.Logger.Errorf("Failed to flush data: %s\n", err.Error())
 			}
 		}
 	}
 }
 
+// EvictPeriodic handles periodic eviction of metrics that haven't been updated for longer than ttl.
+// The job is stopped when the context is cancelled.
+func (storage *MemStorage) EvictPeriodic(ctx context.Context, tick <-chan time.Time, ttl time.Duration) {
+	storage.Logger.Infoln("Launching the EvictPeriodic job")
+	for {
+		select {
+		case <-ctx.Done():
+			storage.Logger.Infoln("Stopping the EvictPeriodic job")
+			return
+		case tick := <-tick:
+			storage.Logger.Infof("The EvictPeriodic job is ticking at %v\n", tick)
+			if err := storage.evict(ctx, tick.Add(-ttl)); err != nil {
+				storage.Logger.Errorf("Failed to evict metrics: %s\n", err.Error())
+			}
+		}
+	}
+}
+
+// CompactPeriodic handles periodic compaction of the history: rolling up the samples
+// into coarser tiers and dropping the expired ones. The job is stopped when the context is cancelled.
+func (storage *MemStorage) CompactPeriodic(ctx context.Context, tick <-chan time.Time) {
+	storage.Logger.Infoln("Launching the CompactPeriodic job")
+	for {
+		select {
+		case <-ctx.Done():
+			storage.Logger.Infoln("Stopping the CompactPeriodic job")
+			return
+		case tick := <-tick:
+			storage.Logger.Infof("The CompactPeriodic job is ticking at %v\n", tick)
+			storage.History.Compact(tick)
+		}
+	}
+}
+
+func (storage *MemStorage) evict(ctx context.Context, deadline time.Time) error {
+	storage.Lock.Lock()
+	defer storage.Lock.Unlock()
+
+	var evicted []string
+	for id, metrics := range storage.Metrics {
+		if metrics.UpdatedAt != nil && metrics.UpdatedAt.Before(deadline) {
+			storage.Logger.Infof("Evicting the metric %s %s\n", metrics.ID, metrics.MType)
+			evicted = append(evicted, id)
+		}
+	}
+	if len(evicted) == 0 {
+		return nil
+	}
+	storage.Logger.Infof("Evicting %d metrics\n", len(evicted))
+	return storage.deleteIDs(ctx, evicted)
+}
+
+func (storage *MemStorage) deleteMatching(ctx context.Context, filter *entities.Filter) (int, error) {
+	var ids []string
+	for id, metrics := range storage.Metrics {
+		if filter.Match(metrics) {
+			ids = append(ids, id)
+		}
+	}
+	storage.Logger.Infof("Deleting %d metrics\n", len(ids))
+	if err := storage.deleteIDs(ctx, ids); err != nil {
+		return 0, err
+	}
+	return len(ids), nil
+}
+
+func (storage *MemStorage) deleteIDs(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	// the keeper goes first, so if it fails, the metrics are kept everywhere and the deletion can be repeated
+	if storage.Keeper != nil {
+		if err := storage.Keeper.Delete(ctx, ids); err != nil {
+			return err
+		}
+	}
+	records := make([]walRecord, 0, len(ids))
+	for _, id := range ids {
+		records = append(records, walRecord{Op: walDelete, Metrics: &common.Metrics{ID: id}})
+	}
+	if err := storage.WAL.Append(records...); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if metrics, ok := storage.Metrics[id]; ok {
+			storage.publish(entities.EventDelete, &common.Metrics{ID: id, MType: metrics.MType, Labels: metrics.Labels})
+			delete(storage.Metrics, id)
+		}
+		delete(storage.Dirty, id)
+	}
+	storage.History.Delete(ids)
+	return nil
+}
+
+func (storage *MemStorage) withStaleness(metrics *common.Metrics, now time.Time) *common.Metrics {
+	result := *metrics
+	result.Stale = metrics.IsStale(storage.StaleAfter, now)
+	return &result
+}
+
+// publish notifies the subscribers about a change of the metric. The subscribers
+// receive a copy, so they can't observe further updates of the stored metric.
+func (storage *MemStorage) publish(kind string, metrics *common.Metrics) {
+	if storage.Hub == nil {
+		return
+	}
+	update := *metrics
+	storage.Hub.Publish(entities.Event{Kind: kind, Metrics: &update})
+}
+
 func (storage *MemStorage) addSingle(ctx context.Context, update *common.Metrics) (*common.Metrics, error) {
 	storage.Logger.Infof("Updating a metric %s %s\n", update.ID, update.MType)
+	now := time.Now()
 	metrics := storage.Metrics[update.ID]
 	if metrics == nil || metrics.MType != update.MType {
 		storage.Logger.Infoln("Creating a new metric")
+		update.UpdatedAt = &now
+		update.Stale = false
 		storage.Metrics[update.ID] = update
-		if err := storage.flush(ctx); err != nil {
+		storage.History.Record(update, now)
+		storage.publish(entities.EventUpdate, update)
+		if err := storage.persist(ctx, update); err != nil {
 			return nil, err
 		}
 		return update, nil
@@ -150,8 +388,14 @@ func (storage *MemStorage) addSingle(ctx context.Context, update *common.Metrics
 	if update.MType == common.TypeGauge {
 		storage.Logger.Infof("Old metric value: %f\n", *metrics.Value)
 		metrics.Value = update.Value
+		metrics.UpdatedAt = &now
+		if update.Labels != nil {
+			metrics.Labels = update.Labels
+		}
+		storage.History.Record(metrics, now)
+		storage.publish(entities.EventUpdate, metrics)
 		storage.Logger.Infof("New metric value: %f\n", *metrics.Value)
-		if err := storage.flush(ctx); err != nil {
+		if err := storage.persist(ctx, metrics); err != nil {
 			return nil, err
 		}
 		return metrics, nil
@@ -159,18 +403,75 @@ func (storage *MemStorage) addSingle(ctx context.Context, update *common.Metrics
 		storage.Logger.Infof("Old metric value: %d\n", *metrics.Delta)
 		var delta = *metrics.Delta + *update.Delta
 		metrics.Delta = &delta
+		metrics.UpdatedAt = &now
+		if update.Labels != nil {
+			metrics.Labels = update.Labels
+		}
+		storage.History.Record(metrics, now)
+		storage.publish(entities.EventUpdate, metrics)
 		storage.Logger.Infof("New metric value: %d\n", *metrics.Delta)
-		if err := storage.flush(ctx); err != nil {
+		if err := storage.persist(ctx, metrics); err != nil {
 			return nil, err
 		}
 		return metrics, nil
 	}
 }
 
+// persist marks an update as dirty and makes it durable: it's appended to the WAL if there is one.
+// Otherwise, it's flushed immediately in the synchronous mode, or left for the next periodic flush.
+func (storage *MemStorage) persist(ctx context.Context, metrics *common.Metrics) error {
+	storage.markDirty(metrics.ID)
+	if storage.WAL != nil {
+		return storage.WAL.Append(walRecord{Op: walSet, Metrics: metrics})
+	}
+	if storage.Tick != nil {
+		return nil
+	}
+	return storage.flush(ctx)
+}
+
+// markDirty remembers that the metric has changed since the last flush.
+func (storage *MemStorage) markDirty(id string) {
+	if storage.Dirty == nil {
+		storage.Dirty = make(map[string]struct{})
+	}
+	storage.Dirty[id] = struct{}{}
+}
+
+// checkpoint flushes the state to the Keeper and truncates the WAL, since
+// the changes logged so far are included in the snapshot.
+func (storage *MemStorage) checkpoint(ctx context.Context) error {
+	storage.Lock.Lock()
+	defer storage.Lock.Unlock()
+
+	if err := storage.flush(ctx); err != nil {
+		return err
+	}
+	return storage.WAL.Reset()
+}
+
+// flush saves the metrics changed since the last flush. Keepers which can't save a part
+// of the state receive the whole snapshot instead. Nothing is saved if nothing has changed.
 func (storage *MemStorage) flush(ctx context.Context) error {
-	if storage.Keeper != nil {
+	if storage.Keeper == nil || len(storage.Dirty) == 0 {
+		return nil
+	}
+	var err error
+	if keeper, ok := storage.Keeper.(entities.IncrementalKeeper); ok {
+		batch := make([]*common.Metrics, 0, len(storage.Dirty))
+		for id := range storage.Dirty {
+			if metrics, ok := storage.Metrics[id]; ok {
+				batch = append(batch, metrics)
+			}
+		}
+		err = keeper.Save(ctx, batch)
+	} else {
 		snapshot, _ := storage.Snapshot(ctx)
-		return storage.Keeper.Flush(ctx, snapshot)
+		err = storage.Keeper.Flush(ctx, snapshot)
+	}
+	if err != nil {
+		return err
 	}
+	storage.Dirty = nil
 	return nil
 }
@@ -3,14 +3,20 @@ package adapters
 import (
 	"context"
 	"errors"
+	"reflect"
+	"sort"
 	"sync"
 	"testing"
+	"time"
 
 	common "github.com/matthiasBT/monitoring/internal/infra/entities"
 	"github.com/matthiasBT/monitoring/internal/infra/logging"
+	"github.com/matthiasBT/monitoring/internal/server/entities"
 )
 
 type FakeKeeper struct {
+	deleted        []string
+	deleteErr      error
 	calledFlush    bool
 	calledRestore  bool
 	calledPing     bool
@@ -22,6 +28,14 @@ func (k *FakeKeeper) Flush(context.Context, []*common.Metrics) error {
 	return nil
 }
 
+func (k *FakeKeeper) Delete(ctx context.Context, ids []string) error {
+	if k.deleteErr != nil {
+		return k.deleteErr
+	}
+	k.deleted = append(k.deleted, ids...)
+	return nil
+}
+
 func (k *FakeKeeper) Restore() []*common.Metrics {
 	k.calledRestore = true
 	return nil
@@ -558,3 +572,242 @@ func TestMemStorage_Snapshot(t *testing.T) {
 		})
 	}
 }
+
+func TestMemStorage_GetAll(t *testing.T) {
+	now := time.Now()
+	old := now.Add(-time.Hour)
+	stor := MemStorage{
+		State: State{
+			Metrics: map[string]*common.Metrics{
+				"Fresh": {ID: "Fresh", MType: common.TypeGauge, Value: ptrfloat64(1.5), UpdatedAt: &now},
+				"Old":   {ID: "Old", MType: common.TypeCounter, Delta: ptrint64(7), UpdatedAt: &old},
+			},
+			Lock: &sync.Mutex{},
+		},
+		Logger:     logging.SetupLogger(),
+		StaleAfter: time.Minute,
+	}
+	got, err := stor.GetAll(context.Background())
+	if err != nil {
+		t.Fatalf("GetAll() error = %v", err)
+	}
+	if got["Fresh"].Stale || !got["Old"].Stale {
+		t.Errorf("Staleness mismatch. got: Fresh=%v, Old=%v", got["Fresh"].Stale, got["Old"].Stale)
+	}
+	if stor.Metrics["Old"].Stale {
+		t.Errorf("GetAll() must not modify the stored metrics")
+	}
+}
+
+func TestMemStorage_evict(t *testing.T) {
+	now := time.Now()
+	old := now.Add(-time.Hour)
+	keeper := &FakeKeeper{}
+	stor := MemStorage{
+		State: State{
+			Metrics: map[string]*common.Metrics{
+				"Fresh": {ID: "Fresh", MType: common.TypeGauge, Value: ptrfloat64(1.5), UpdatedAt: &now},
+				"Old":   {ID: "Old", MType: common.TypeCounter, Delta: ptrint64(7), UpdatedAt: &old},
+			},
+			Lock: &sync.Mutex{},
+		},
+		Logger: logging.SetupLogger(),
+		Keeper: keeper,
+	}
+	if err := stor.evict(context.Background(), now.Add(-time.Minute)); err != nil {
+		t.Fatalf("evict() error = %v", err)
+	}
+	if _, ok := stor.Metrics["Old"]; ok {
+		t.Errorf("The old metric must be evicted")
+	}
+	if _, ok := stor.Metrics["Fresh"]; !ok {
+		t.Errorf("The fresh metric must be kept")
+	}
+	if !reflect.DeepEqual(keeper.deleted, []string{"Old"}) {
+		t.Errorf("Eviction must be passed to the keeper. Deleted: %v", keeper.deleted)
+	}
+}
+
+func TestMemStorage_Delete(t *testing.T) {
+	errKeeper := errors.New("fake error")
+	tests := []struct {
+		name        string
+		query       common.Metrics
+		keeperErr   error
+		wantErr     error
+		wantDeleted []string
+	}{
+		{
+			name:        "delete_existing",
+			query:       common.Metrics{ID: "FooBar", MType: common.TypeCounter},
+			wantErr:     nil,
+			wantDeleted: []string{"FooBar"},
+		},
+		{
+			name:        "type_mismatch",
+			query:       common.Metrics{ID: "FooBar", MType: common.TypeGauge},
+			wantErr:     common.ErrUnknownMetric,
+			wantDeleted: nil,
+		},
+		{
+			name:        "unknown_metric",
+			query:       common.Metrics{ID: "BarFoo", MType: common.TypeCounter},
+			wantErr:     common.ErrUnknownMetric,
+			wantDeleted: nil,
+		},
+		{
+			name:        "keeper_failure_keeps_metric",
+			query:       common.Metrics{ID: "FooBar", MType: common.TypeCounter},
+			keeperErr:   errKeeper,
+			wantErr:     errKeeper,
+			wantDeleted: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keeper := &FakeKeeper{deleteErr: tt.keeperErr}
+			stor := MemStorage{
+				State: State{
+					Metrics: map[string]*common.Metrics{
+						"FooBar": {ID: "FooBar", MType: common.TypeCounter, Delta: ptrint64(3)},
+					},
+					Lock: &sync.Mutex{},
+				},
+				Logger: logging.SetupLogger(),
+				Keeper: keeper,
+			}
+			if err := stor.Delete(context.Background(), &tt.query); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Error mismatch. got: %v, want: %v\n", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(keeper.deleted, tt.wantDeleted) {
+				t.Errorf("Keeper deletions mismatch. got: %v, want: %v", keeper.deleted, tt.wantDeleted)
+			}
+			if _, ok := stor.Metrics["FooBar"]; ok == (tt.wantErr == nil) {
+				t.Errorf("Unexpected storage state: %v", stor.Metrics)
+			}
+		})
+	}
+}
+
+func TestMemStorage_DeleteMatching(t *testing.T) {
+	keeper := &FakeKeeper{}
+	stor := MemStorage{
+		State: State{
+			Metrics: map[string]*common.Metrics{
+				"HeapAlloc": {ID: "HeapAlloc", MType: common.TypeGauge, Value: ptrfloat64(1)},
+				"HeapSys":   {ID: "HeapSys", MType: common.TypeGauge, Value: ptrfloat64(2)},
+				"PollCount": {ID: "PollCount", MType: common.TypeCounter, Delta: ptrint64(3)},
+			},
+			Lock: &sync.Mutex{},
+		},
+		Logger: logging.SetupLogger(),
+		Keeper: keeper,
+	}
+	deleted, err := stor.DeleteMatching(context.Background(), &entities.Filter{Prefix: "Heap"})
+	if err != nil {
+		t.Fatalf("DeleteMatching() error = %v", err)
+	}
+	sort.Strings(keeper.deleted)
+	if deleted != 2 || !reflect.DeepEqual(keeper.deleted, []string{"HeapAlloc", "HeapSys"}) {
+		t.Errorf("DeleteMatching() deleted %d metrics, keeper got %v", deleted, keeper.deleted)
+	}
+	if len(stor.Metrics) != 1 || stor.Metrics["PollCount"] == nil {
+		t.Errorf("Unexpected storage state: %v", stor.Metrics)
+	}
+
+	deleted, err = stor.Truncate(context.Background())
+	if err != nil {
+		t.Fatalf("Truncate() error = %v", err)
+	}
+	if deleted != 1 || len(stor.Metrics) != 0 {
+		t.Errorf("Truncate() deleted %d metrics, left: %v", deleted, stor.Metrics)
+	}
+}
+
+func TestMemStorage_ResetCounter(t *testing.T) {
+	keeper := &FakeKeeper{}
+	stor := MemStorage{
+		State: State{
+			Metrics: map[string]*common.Metrics{
+				"HeapAlloc": {ID: "HeapAlloc", MType: common.TypeGauge, Value: ptrfloat64(1)},
+				"PollCount": {ID: "PollCount", MType: common.TypeCounter, Delta: ptrint64(3)},
+			},
+			Lock: &sync.Mutex{},
+		},
+		Logger: logging.SetupLogger(),
+		Keeper: keeper,
+	}
+	got, err := stor.ResetCounter(context.Background(), "PollCount")
+	if err != nil {
+		t.Fatalf("ResetCounter() error = %v", err)
+	}
+	if *got.Delta != 0 || *stor.Metrics["PollCount"].Delta != 0 {
+		t.Errorf("The counter must be reset. got: %v", got)
+	}
+	if !keeper.calledFlush {
+		t.Errorf("The reset must be flushed to the keeper")
+	}
+	if _, err := stor.ResetCounter(context.Background(), "HeapAlloc"); !errors.Is(err, common.ErrUnknownMetric) {
+		t.Errorf("Gauges can't be reset. got: %v", err)
+	}
+}
+
+type FakeIncrementalKeeper struct {
+	FakeKeeper
+	saved [][]string
+}
+
+func (k *FakeIncrementalKeeper) Save(ctx context.Context, batch []*common.Metrics) error {
+	ids := make([]string, 0, len(batch))
+	for _, metrics := range batch {
+		ids = append(ids, metrics.ID)
+	}
+	sort.Strings(ids)
+	k.saved = append(k.saved, ids)
+	return nil
+}
+
+func TestMemStorage_flushDirty(t *testing.T) {
+	keeper := &FakeIncrementalKeeper{}
+	stor := MemStorage{
+		State: State{
+			Metrics: map[string]*common.Metrics{},
+			Lock:    &sync.Mutex{},
+		},
+		Tick:   make(chan time.Time),
+		Logger: logging.SetupLogger(),
+		Keeper: keeper,
+	}
+	stor.Init([]*common.Metrics{{ID: "Restored", MType: common.TypeGauge, Value: ptrfloat64(1)}})
+	ctx := context.Background()
+	stor.Add(ctx, &common.Metrics{ID: "Foo", MType: common.TypeCounter, Delta: ptrint64(1)})
+	stor.Add(ctx, &common.Metrics{ID: "Bar", MType: common.TypeGauge, Value: ptrfloat64(2)})
+	stor.Add(ctx, &common.Metrics{ID: "Foo", MType: common.TypeCounter, Delta: ptrint64(1)})
+	if len(keeper.saved) != 0 {
+		t.Fatalf("Updates must wait for the periodic flush, saved: %v", keeper.saved)
+	}
+
+	if err := stor.checkpoint(ctx); err != nil {
+		t.Fatalf("checkpoint() error = %v", err)
+	}
+	if !reflect.DeepEqual(keeper.saved, [][]string{{"Bar", "Foo"}}) {
+		t.Errorf("Only the changed metrics must be saved, saved: %v", keeper.saved)
+	}
+
+	if err := stor.checkpoint(ctx); err != nil {
+		t.Fatalf("checkpoint() error = %v", err)
+	}
+	if len(keeper.saved) != 1 {
+		t.Errorf("Nothing must be saved without changes, saved: %v", keeper.saved)
+	}
+
+	stor.Add(ctx, &common.Metrics{ID: "Bar", MType: common.TypeGauge, Value: ptrfloat64(3)})
+	stor.Add(ctx, &common.Metrics{ID: "Foo", MType: common.TypeCounter, Delta: ptrint64(1)})
+	stor.Delete(ctx, &common.Metrics{ID: "Foo", MType: common.TypeCounter})
+	if err := stor.checkpoint(ctx); err != nil {
+		t.Fatalf("checkpoint() error = %v", err)
+	}
+	if !reflect.DeepEqual(keeper.saved[1:], [][]string{{"Bar"}}) {
+		t.Errorf("Deleted metrics must not be saved, saved: %v", keeper.saved)
+	}
+}
@@ -0,0 +1,173 @@
+// Package adapters provides the storages of the state last shipped upstream by the Federator:
+// a file for a standalone server, and a table for the replicas sharing a PostgreSQL database.
+package adapters
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	common "github.com/matthiasBT/monitoring/internal/infra/entities"
+	"github.com/matthiasBT/monitoring/internal/infra/logging"
+	"github.com/matthiasBT/monitoring/internal/infra/utils"
+	"github.com/matthiasBT/monitoring/internal/server/entities"
+)
+
+// shippedColumns lists the columns of the federation_shipped table in the order expected by Load
+const shippedColumns = "id, mtype, delta, val, updated_at"
+
+// FileShippedState keeps the shipped state in a JSON file, which is rewritten atomically on every change.
+type FileShippedState struct {
+	Path    string                     // Path of the file
+	Shipped map[string]*common.Metrics // Shipped state, as written to the file
+}
+
+// NewFileShippedState creates and returns a new FileShippedState.
+func NewFileShippedState(path string) entities.ShippedState {
+	return &FileShippedState{Path: path, Shipped: make(map[string]*common.Metrics)}
+}
+
+// Load reads the shipped state from the file. A missing file means that nothing has been shipped yet.
+func (s *FileShippedState) Load(context.Context) (map[string]*common.Metrics, error) {
+	raw, err := os.ReadFile(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		s.Shipped = make(map[string]*common.Metrics)
+		return copyShipped(s.Shipped), nil
+	} else if err != nil {
+		return nil, err
+	}
+	shipped := make(map[string]*common.Metrics)
+	if err := json.Unmarshal(raw, &shipped); err != nil {
+		return nil, fmt.Errorf("failed to read the shipped state: %w", err)
+	}
+	s.Shipped = shipped
+	return copyShipped(s.Shipped), nil
+}
+
+// Save applies the changes to the shipped state and rewrites the file.
+func (s *FileShippedState) Save(_ context.Context, shipped []*common.Metrics, forgotten []string) error {
+	for _, metrics := range shipped {
+		s.Shipped[metrics.ID] = metrics
+	}
+	for _, id := range forgotten {
+		delete(s.Shipped, id)
+	}
+	data, err := json.Marshal(s.Shipped)
+	if err != nil {
+		return err
+	}
+	return writeAtomic(s.Path, data, nil)
+}
+
+// DBShippedState keeps the shipped state in the federation_shipped table of the database shared
+// by the replicas, so that a new leader continues exactly where the previous one stopped.
+type DBShippedState struct {
+	DB      *sql.DB         // Database shared by the replicas
+	Logger  logging.ILogger // Logger for logging activities
+	Retrier utils.Retrier   // Retrier for retry logic
+}
+
+// NewDBShippedState creates and returns a new DBShippedState. The table is created by the migrations.
+func NewDBShippedState(db *sql.DB, logger logging.ILogger, retrier utils.Retrier) entities.ShippedState {
+	return &DBShippedState{DB: db, Logger: logger, Retrier: retrier}
+}
+
+// Load reads the shipped state from the database, with retry logic for transient errors.
+func (s *DBShippedState) Load(ctx context.Context) (map[string]*common.Metrics, error) {
+	f := func() (any, error) {
+		rows, err := s.DB.QueryContext(ctx, "SELECT "+shippedColumns+" FROM federation_shipped")
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		result := make(map[string]*common.Metrics)
+		for rows.Next() {
+			var metrics common.Metrics
+			err := rows.Scan(&metrics.ID, &metrics.MType, &metrics.Delta, &metrics.Value, &metrics.UpdatedAt)
+			if err != nil {
+				return nil, err
+			}
+			result[metrics.ID] = &metrics
+		}
+		return result, rows.Err()
+	}
+	result, err := s.Retrier.RetryChecked(ctx, f, utils.CheckConnectionError)
+	if err != nil {
+		s.Logger.Errorf("Failed to load the shipped state: %s\n", err.Error())
+		return nil, err
+	}
+	return result.(map[string]*common.Metrics), nil
+}
+
+// Save applies the changes to the shipped state within a single transaction.
+func (s *DBShippedState) Save(ctx context.Context, shipped []*common.Metrics, forgotten []string) error {
+	if len(shipped) == 0 && len(forgotten) == 0 {
+		return nil
+	}
+	f := func() (any, error) {
+		return s.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	}
+	txAny, err := s.Retrier.RetryChecked(ctx, f, utils.CheckConnectionError)
+	if err != nil {
+		s.Logger.Errorf("Failed to open a transaction: %s\n", err.Error())
+		return err
+	}
+	var tx = txAny.(*sql.Tx)
+
+	for start := 0; start < len(shipped); start += upsertBatchSize {
+		end := start + upsertBatchSize
+		if end > len(shipped) {
+			end = len(shipped)
+		}
+		if err := s.upsert(ctx, tx, shipped[start:end]); err != nil {
+			s.Logger.Errorf("Failed to save the shipped state: %s\n", err.Error())
+			tx.Rollback()
+			return err
+		}
+	}
+	for _, id := range forgotten {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM federation_shipped WHERE id = $1", id); err != nil {
+			s.Logger.Errorf("Failed to forget the shipped state of %s: %s\n", id, err.Error())
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		s.Logger.Errorf("Failed to commit the shipped state: %s\n", err.Error())
+		return err
+	}
+	return nil
+}
+
+// upsert inserts or overwrites the shipped state of the metrics with a single multi-row statement.
+func (s *DBShippedState) upsert(ctx context.Context, tx *sql.Tx, batch []*common.Metrics) error {
+	var query strings.Builder
+	query.WriteString("INSERT INTO federation_shipped(" + shippedColumns + ") VALUES ")
+	args := make([]any, 0, len(batch)*5)
+	for i, metrics := range batch {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		n := len(args)
+		fmt.Fprintf(&query, "($%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5)
+		args = append(args, metrics.ID, metrics.MType, metrics.Delta, metrics.Value, metrics.UpdatedAt)
+	}
+	query.WriteString(`
+		ON CONFLICT (id) DO UPDATE
+		SET mtype = excluded.mtype, delta = excluded.delta, val = excluded.val, updated_at = excluded.updated_at`)
+	_, err := tx.ExecContext(ctx, query.String(), args...)
+	return err
+}
+
+// copyShipped returns a shallow copy of the shipped state, so that the caller can change it freely
+func copyShipped(shipped map[string]*common.Metrics) map[string]*common.Metrics {
+	result := make(map[string]*common.Metrics, len(shipped))
+	for id, metrics := range shipped {
+		result[id] = metrics
+	}
+	return result
+}
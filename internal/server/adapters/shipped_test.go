@@ -0,0 +1,97 @@
+package adapters
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	common "github.com/matthiasBT/monitoring/internal/infra/entities"
+	"github.com/matthiasBT/monitoring/internal/infra/logging"
+	"github.com/matthiasBT/monitoring/internal/infra/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func newMockShippedState(t *testing.T) (*DBShippedState, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	logger := logging.SetupLogger()
+	return &DBShippedState{DB: db, Logger: logger, Retrier: utils.Retrier{Logger: logger}}, mock
+}
+
+func TestDBShippedState_Load(t *testing.T) {
+	state, mock := newMockShippedState(t)
+	updatedAt := time.Date(2023, 12, 15, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT " + shippedColumns + " FROM federation_shipped")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "mtype", "delta", "val", "updated_at"}).
+			AddRow("PollCount", common.TypeCounter, int64(5), nil, updatedAt).
+			AddRow("Alloc", common.TypeGauge, nil, 1.5, updatedAt))
+
+	shipped, err := state.Load(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]*common.Metrics{
+		"PollCount": {ID: "PollCount", MType: common.TypeCounter, Delta: ptrint64(5), UpdatedAt: &updatedAt},
+		"Alloc":     {ID: "Alloc", MType: common.TypeGauge, Value: ptrfloat64(1.5), UpdatedAt: &updatedAt},
+	}, shipped)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestDBShippedState_Save(t *testing.T) {
+	updatedAt := time.Date(2023, 12, 15, 12, 0, 0, 0, time.UTC)
+	shipped := []*common.Metrics{
+		{ID: "PollCount", MType: common.TypeCounter, Delta: ptrint64(5), UpdatedAt: &updatedAt},
+		{ID: "Alloc", MType: common.TypeGauge, Value: ptrfloat64(1.5), UpdatedAt: &updatedAt},
+	}
+	tests := []struct {
+		name    string
+		err     error
+		wantErr error
+	}{
+		{
+			name: "saved",
+		},
+		{
+			name:    "failure_rolls_back",
+			err:     errors.New("fake error"),
+			wantErr: errors.New("fake error"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state, mock := newMockShippedState(t)
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta("INSERT INTO federation_shipped("+shippedColumns+") VALUES")).
+				WithArgs(
+					"PollCount", common.TypeCounter, shipped[0].Delta, nil, updatedAt,
+					"Alloc", common.TypeGauge, nil, shipped[1].Value, updatedAt,
+				).
+				WillReturnResult(sqlmock.NewResult(0, 2))
+			deletion := mock.ExpectExec(regexp.QuoteMeta("DELETE FROM federation_shipped WHERE id = $1")).
+				WithArgs("Deleted")
+			if tt.err != nil {
+				deletion.WillReturnError(tt.err)
+				mock.ExpectRollback()
+			} else {
+				deletion.WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			}
+
+			err := state.Save(context.Background(), shipped, []string{"Deleted"})
+			if tt.wantErr != nil {
+				assert.EqualError(t, err, tt.wantErr.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+// Package adapters provides the encodings of storage snapshots. Snapshots are written
+// either as newline-delimited JSON with a checksummed header, or as a gzip-compressed
+// gob stream, which is much more compact. The format is detected automatically on reading.
+package adapters
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/matthiasBT/monitoring/internal/infra/config/server"
+	common "github.com/matthiasBT/monitoring/internal/infra/entities"
+)
+
+const (
+	snapshotMagic       = "#monitoring-snapshot" // First word of the header of JSON snapshots
+	snapshotVersion     = "v1"                   // Version of the JSON snapshot format
+	binarySnapshotMagic = "\x00MSNAP1"           // Prefix of gob snapshots, including the format version
+	maxSnapshotLine     = 1024 * 1024            // Maximal length of a single metric in a JSON snapshot
+	maxSnapshotPrealloc = 4096                   // Maximal number of metrics preallocated when reading a snapshot
+)
+
+var (
+	// ErrCorruptSnapshot is returned when a snapshot file is damaged.
+	ErrCorruptSnapshot = errors.New("corrupt snapshot")
+
+	// ErrUnknownFormat is returned when a snapshot is requested in an unsupported format.
+	ErrUnknownFormat = errors.New("unknown snapshot format")
+)
+
+// EncodeSnapshot converts metrics to a snapshot in the given format, json or gob.
+func EncodeSnapshot(storageSnapshot []*common.Metrics, format string) ([]byte, error) {
+	switch format {
+	case server.StoreFormatJSON, "":
+		return encodeJSONSnapshot(storageSnapshot)
+	case server.StoreFormatGob:
+		return encodeGobSnapshot(storageSnapshot)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+	}
+}
+
+// DecodeSnapshot detects the format of a snapshot, verifies its integrity and parses the metrics from it.
+func DecodeSnapshot(data []byte) ([]*common.Metrics, error) {
+	if bytes.HasPrefix(data, []byte(binarySnapshotMagic)) {
+		return decodeGobSnapshot(data[len(binarySnapshotMagic):])
+	}
+	return decodeJSONSnapshot(data)
+}
+
+// SnapshotFormat returns the format of the snapshot data: json or gob.
+func SnapshotFormat(data []byte) string {
+	if bytes.HasPrefix(data, []byte(binarySnapshotMagic)) {
+		return server.StoreFormatGob
+	}
+	return server.StoreFormatJSON
+}
+
+// encodeJSONSnapshot converts metrics to newline-delimited JSON preceded by
+// a header with the SHA-256 checksum of the data.
+func encodeJSONSnapshot(storageSnapshot []*common.Metrics) ([]byte, error) {
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, metrics := range storageSnapshot {
+		if err := encoder.Encode(metrics); err != nil {
+			return nil, err
+		}
+	}
+	header := fmt.Sprintf("%s %s %x\n", snapshotMagic, snapshotVersion, sha256.Sum256(body.Bytes()))
+	return append([]byte(header), body.Bytes()...), nil
+}
+
+// decodeJSONSnapshot verifies the checksum of a JSON snapshot and parses the metrics from it.
+// Snapshots without a header, written by older versions, are parsed without verification.
+func decodeJSONSnapshot(data []byte) ([]*common.Metrics, error) {
+	body := data
+	if bytes.HasPrefix(data, []byte(snapshotMagic+" ")) {
+		header, rest, ok := bytes.Cut(data, []byte("\n"))
+		if !ok {
+			return nil, fmt.Errorf("%w: truncated header", ErrCorruptSnapshot)
+		}
+		fields := strings.Fields(string(header))
+		if len(fields) != 3 || fields[1] != snapshotVersion {
+			return nil, fmt.Errorf("%w: unsupported header %q", ErrCorruptSnapshot, header)
+		}
+		if checksum := fmt.Sprintf("%x", sha256.Sum256(rest)); checksum != fields[2] {
+			return nil, fmt.Errorf("%w: checksum mismatch", ErrCorruptSnapshot)
+		}
+		body = rest
+	}
+
+	var result []*common.Metrics
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(nil, maxSnapshotLine)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		metrics := common.Metrics{}
+		if err := json.Unmarshal(scanner.Bytes(), &metrics); err != nil {
+			return nil, errors.Join(ErrCorruptSnapshot, err)
+		}
+		result = append(result, &metrics)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Join(ErrCorruptSnapshot, err)
+	}
+	return result, nil
+}
+
+// encodeGobSnapshot converts metrics to a gzip-compressed gob stream: the number
+// of metrics followed by the metrics themselves. The gzip trailer holds a CRC-32
+// of the stream, which protects it from corruption.
+func encodeGobSnapshot(storageSnapshot []*common.Metrics) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(binarySnapshotMagic)
+	gz := gzip.NewWriter(&buf)
+	encoder := gob.NewEncoder(gz)
+	if err := encoder.Encode(len(storageSnapshot)); err != nil {
+		return nil, err
+	}
+	for _, metrics := range storageSnapshot {
+		if err := encoder.Encode(metrics); err != nil {
+			return nil, err
+		}
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeGobSnapshot parses the metrics from a gzip-compressed gob stream.
+func decodeGobSnapshot(data []byte) ([]*common.Metrics, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Join(ErrCorruptSnapshot, err)
+	}
+	defer gz.Close()
+
+	decoder := gob.NewDecoder(gz)
+	var count int
+	if err := decoder.Decode(&count); err != nil {
+		return nil, errors.Join(ErrCorruptSnapshot, err)
+	}
+	if count < 0 {
+		return nil, fmt.Errorf("%w: negative number of metrics", ErrCorruptSnapshot)
+	}
+	// the count isn't trusted before the checksum is verified, so the slice grows as the metrics are read
+	capacity := count
+	if capacity > maxSnapshotPrealloc {
+		capacity = maxSnapshotPrealloc
+	}
+	result := make([]*common.Metrics, 0, capacity)
+	for i := 0; i < count; i++ {
+		metrics := common.Metrics{}
+		if err := decoder.Decode(&metrics); err != nil {
+			return nil, errors.Join(ErrCorruptSnapshot, err)
+		}
+		result = append(result, &metrics)
+	}
+	// reading up to the end verifies the checksum of the stream
+	if _, err := io.Copy(io.Discard, gz); err != nil {
+		return nil, errors.Join(ErrCorruptSnapshot, err)
+	}
+	return result, nil
+}
@@ -0,0 +1,60 @@
+package adapters
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/gob"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/matthiasBT/monitoring/internal/infra/config/server"
+	common "github.com/matthiasBT/monitoring/internal/infra/entities"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeSnapshot(t *testing.T) {
+	updatedAt := time.Date(2023, 11, 1, 12, 0, 0, 0, time.UTC)
+	snapshot := []*common.Metrics{
+		{ID: "BarFoo", MType: common.TypeGauge, Value: ptrfloat64(44.1), Labels: map[string]string{"host": "a"}},
+		{ID: "FooBar", MType: common.TypeCounter, Delta: ptrint64(3), UpdatedAt: &updatedAt},
+	}
+	for _, format := range []string{server.StoreFormatJSON, server.StoreFormatGob} {
+		t.Run(format, func(t *testing.T) {
+			data, err := EncodeSnapshot(snapshot, format)
+			if err != nil {
+				t.Fatalf("EncodeSnapshot() error = %v", err)
+			}
+			assert.Equal(t, format, SnapshotFormat(data))
+			got, err := DecodeSnapshot(data)
+			if err != nil {
+				t.Fatalf("DecodeSnapshot() error = %v", err)
+			}
+			assert.Equal(t, snapshot, got)
+
+			data[len(data)-3] ^= 0xff
+			if _, err := DecodeSnapshot(data); !errors.Is(err, ErrCorruptSnapshot) {
+				t.Errorf("Damaged snapshot must be reported as corrupt, got: %v", err)
+			}
+		})
+	}
+
+	if _, err := EncodeSnapshot(snapshot, "xml"); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("Unknown format must be rejected, got: %v", err)
+	}
+}
+
+func TestDecodeSnapshot_hugeCount(t *testing.T) {
+	var buf bytes.Buffer
+	buf.WriteString(binarySnapshotMagic)
+	gz := gzip.NewWriter(&buf)
+	if err := gob.NewEncoder(gz).Encode(math.MaxInt64); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	_, err := DecodeSnapshot(buf.Bytes())
+	assert.ErrorIs(t, err, ErrCorruptSnapshot, "A damaged count must not be trusted")
+}
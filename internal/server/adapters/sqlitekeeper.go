@@ -0,0 +1,49 @@
+// Package adapters provides functionality for keeping metrics in an embedded SQLite
+// database. It reuses the queries of DBKeeper, rewritten in the SQLite dialect,
+// so single-node deployments get SQL storage without running PostgreSQL.
+package adapters
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+
+	"github.com/matthiasBT/monitoring/internal/infra/logging"
+	"github.com/matthiasBT/monitoring/internal/infra/migrations"
+	"github.com/matthiasBT/monitoring/internal/infra/utils"
+	"github.com/matthiasBT/monitoring/internal/server/entities"
+	_ "modernc.org/sqlite"
+)
+
+// sqliteOptions are applied to every connection: writers wait for each other
+// instead of failing, and readers don't block writers.
+const sqliteOptions = "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+
+// SQLiteKeeper is a DBKeeper working with an embedded SQLite database file.
+type SQLiteKeeper struct {
+	DBKeeper
+}
+
+// OpenSQLite opens the SQLite database file, creating it if needed.
+func OpenSQLite(path string) *sql.DB {
+	db, err := sql.Open(SQLiteDialect.Driver, path+sqliteOptions)
+	if err != nil {
+		panic(err)
+	}
+	// SQLite allows a single writer at a time anyway
+	db.SetMaxOpenConns(1)
+	return db
+}
+
+// NewSQLiteKeeper creates and returns a new SQLiteKeeper instance with the provided database,
+// logger, and retrier. It tests the database connection and runs the SQLite migrations.
+func NewSQLiteKeeper(db *sql.DB, logger logging.ILogger, retrier utils.Retrier) entities.IncrementalKeeper {
+	keeper := SQLiteKeeper{
+		DBKeeper: DBKeeper{DB: db, Dialect: SQLiteDialect, Logger: logger, Retrier: retrier, Lock: &sync.Mutex{}},
+	}
+	if err := keeper.Ping(context.Background()); err != nil {
+		panic(err)
+	}
+	migrations.Migrate(db, migrations.SQLite)
+	return &keeper
+}
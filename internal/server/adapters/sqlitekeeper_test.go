@@ -0,0 +1,62 @@
+package adapters
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	common "github.com/matthiasBT/monitoring/internal/infra/entities"
+	"github.com/matthiasBT/monitoring/internal/infra/logging"
+	"github.com/matthiasBT/monitoring/internal/infra/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSQLiteKeeper(t *testing.T) {
+	db := OpenSQLite(filepath.Join(t.TempDir(), "metrics.sqlite"))
+	logger := logging.SetupLogger()
+	keeper := NewSQLiteKeeper(db, logger, utils.Retrier{Attempts: 1, Logger: logger})
+	defer keeper.Shutdown()
+	ctx := context.Background()
+
+	updatedAt := time.Date(2023, 12, 1, 12, 0, 0, 0, time.UTC)
+	snapshot := []*common.Metrics{
+		{
+			ID: "BarFoo", MType: common.TypeGauge, Value: ptrfloat64(44.1), Labels: map[string]string{"host": "a"},
+			UpdatedAt: &updatedAt,
+		},
+		{ID: "FooBar", MType: common.TypeCounter, Delta: ptrint64(3), UpdatedAt: &updatedAt},
+	}
+	for i := 0; i < 2; i++ { // flushing the same snapshot twice must not add up the counters
+		if err := keeper.Flush(ctx, snapshot); err != nil {
+			t.Fatalf("Flush() error = %v", err)
+		}
+	}
+	assert.Equal(t, snapshot, keeper.Restore())
+
+	// the metrics which have never been updated are stamped when they are saved
+	fresh := []*common.Metrics{{ID: "New", MType: common.TypeCounter, Delta: ptrint64(1)}}
+	if err := keeper.Flush(ctx, fresh); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	for _, metrics := range keeper.Restore() {
+		if assert.NotNil(t, metrics.UpdatedAt, metrics.ID) && metrics.ID == "New" {
+			assert.WithinDuration(t, time.Now(), *metrics.UpdatedAt, time.Minute)
+		}
+	}
+	if err := keeper.Delete(ctx, []string{"New"}); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	if err := keeper.Delete(ctx, []string{"BarFoo", "Unknown"}); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	assert.Equal(t, snapshot[1:], keeper.Restore())
+}
+
+func TestDialect_Rebind(t *testing.T) {
+	query := "SELECT id FROM metrics WHERE id = $1 AND mtype = $2"
+	assert.Equal(t, query, PostgresDialect.Rebind(query))
+	assert.Equal(t, query, (*Dialect)(nil).Rebind(query))
+	assert.Equal(t, "SELECT id FROM metrics WHERE id = ?1 AND mtype = ?2", SQLiteDialect.Rebind(query))
+}
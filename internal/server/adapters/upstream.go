@@ -0,0 +1,151 @@
+// Package adapters provides the HTTP client of an upstream server receiving the metrics
+// of this server in the federation mode. The batches are sent to the /updates/ endpoint
+// the same way the agents send them: encrypted, signed and compressed.
+package adapters
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/matthiasBT/monitoring/internal/infra/compression"
+	common "github.com/matthiasBT/monitoring/internal/infra/entities"
+	"github.com/matthiasBT/monitoring/internal/infra/logging"
+	"github.com/matthiasBT/monitoring/internal/infra/secure"
+	"github.com/matthiasBT/monitoring/internal/server/entities"
+)
+
+const (
+	// upstreamPath is the endpoint of the upstream server accepting batches of metrics
+	upstreamPath = "/updates/"
+
+	// upstreamTimeout limits the time of a single request to the upstream server
+	upstreamTimeout = 30 * time.Second
+
+	// defaultRetryAfter is the pause after the upstream server asks to slow down without saying for how long
+	defaultRetryAfter = time.Minute
+)
+
+// ErrUpstreamRejected is returned when the upstream server responds with an unexpected status.
+var ErrUpstreamRejected = errors.New("upstream server rejected the batch")
+
+// ThrottledError is returned when the upstream server is overloaded and asks to retry later.
+type ThrottledError struct {
+	RetryAfter time.Duration // Time to wait before the next attempt
+}
+
+// Error describes the throttling.
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("upstream server is overloaded, retry after %s", e.RetryAfter)
+}
+
+// HTTPUpstream sends batches of metrics to an upstream server over HTTP.
+type HTTPUpstream struct {
+	Addr      string          // Address of the upstream server: host:port
+	HMACKey   []byte          // Key for signing the batches, empty if they aren't signed
+	CryptoKey *rsa.PublicKey  // Public key of the upstream server, nil if the batches aren't encrypted
+	Client    *http.Client    // HTTP client sending the requests
+	Logger    logging.ILogger // Logger for logging activities
+}
+
+// NewHTTPUpstream creates and returns a new HTTPUpstream.
+func NewHTTPUpstream(
+	addr string, hmacKey string, cryptoKey *rsa.PublicKey, logger logging.ILogger,
+) entities.Upstream {
+	return &HTTPUpstream{
+		Addr:      addr,
+		HMACKey:   []byte(hmacKey),
+		CryptoKey: cryptoKey,
+		Client:    &http.Client{Timeout: upstreamTimeout},
+		Logger:    logger,
+	}
+}
+
+// Send ships a batch of metrics to the upstream server. Returns a ThrottledError if the server
+// responds with 429 Too Many Requests or 503 Service Unavailable, and ErrUpstreamRejected
+// if it responds with another unexpected status.
+func (u *HTTPUpstream) Send(ctx context.Context, batch []*common.Metrics) error {
+	req, err := u.createRequest(ctx, batch)
+	if err != nil {
+		return err
+	}
+	resp, err := u.Client.Do(req)
+	if err != nil {
+		u.Logger.Errorf("Request to the upstream server failed: %s\n", err.Error())
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body) //nolint:errcheck // the connection is reused only if the body is read
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		u.Logger.Infof("Sent %d metrics to the upstream server\n", len(batch))
+		return nil
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		throttled := &ThrottledError{RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"))}
+		u.Logger.Errorf("%s\n", throttled.Error())
+		return throttled
+	default:
+		u.Logger.Errorf("Upstream server responded with code: %d\n", resp.StatusCode)
+		return fmt.Errorf("%w: status %d", ErrUpstreamRejected, resp.StatusCode)
+	}
+}
+
+// createRequest encodes the batch the same way as the agents do: the payload is encrypted,
+// then signed, then compressed.
+func (u *HTTPUpstream) createRequest(ctx context.Context, batch []*common.Metrics) (*http.Request, error) {
+	payload, err := json.Marshal(batch)
+	if err != nil {
+		return nil, err
+	}
+	if u.CryptoKey != nil {
+		if payload, err = secure.Encrypt(payload, u.CryptoKey); err != nil {
+			return nil, err
+		}
+	}
+	var hash string
+	if len(u.HMACKey) > 0 {
+		if hash, err = secure.Sign(u.HMACKey, payload); err != nil {
+			return nil, err
+		}
+	}
+	compressed, err := compression.Compress(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	target := url.URL{Scheme: "http", Host: u.Addr, Path: upstreamPath}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target.String(), bytes.NewReader(compressed))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	if hash != "" {
+		req.Header.Set("HashSHA256", hash)
+	}
+	return req, nil
+}
+
+// parseRetryAfter parses the Retry-After header given in seconds or as an HTTP date.
+// Returns defaultRetryAfter if the header is missing or invalid.
+func parseRetryAfter(value string) time.Duration {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if pause := time.Until(at); pause > 0 {
+			return pause
+		}
+		return 0
+	}
+	return defaultRetryAfter
+}
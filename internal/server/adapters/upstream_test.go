@@ -0,0 +1,70 @@
+package adapters
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/matthiasBT/monitoring/internal/infra/compression"
+	common "github.com/matthiasBT/monitoring/internal/infra/entities"
+	"github.com/matthiasBT/monitoring/internal/infra/logging"
+	"github.com/matthiasBT/monitoring/internal/infra/secure"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPUpstream_Send(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate a key: %v", err)
+	}
+	var received []*common.Metrics
+	r := chi.NewRouter()
+	r.Use(compression.MiddlewareReader, secure.MiddlewareHashReader("secret"), secure.MiddlewareCryptoReader(key))
+	r.Post("/updates/", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &received); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	})
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	upstream := NewHTTPUpstream(strings.TrimPrefix(srv.URL, "http://"), "secret", &key.PublicKey, logging.SetupLogger())
+	batch := []*common.Metrics{{ID: "PollCount", MType: common.TypeCounter, Delta: ptrint64(3)}}
+	assert.NoError(t, upstream.Send(context.Background(), batch))
+	assert.Equal(t, batch, received)
+
+	wrongKey := NewHTTPUpstream(strings.TrimPrefix(srv.URL, "http://"), "wrong", &key.PublicKey, logging.SetupLogger())
+	assert.ErrorIs(t, wrongKey.Send(context.Background(), batch), ErrUpstreamRejected)
+}
+
+func TestHTTPUpstream_SendThrottled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	upstream := NewHTTPUpstream(strings.TrimPrefix(srv.URL, "http://"), "", nil, logging.SetupLogger())
+	err := upstream.Send(context.Background(), nil)
+	var throttled *ThrottledError
+	if assert.True(t, errors.As(err, &throttled)) {
+		assert.Equal(t, 2*time.Minute, throttled.RetryAfter)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	assert.Equal(t, 30*time.Second, parseRetryAfter("30"))
+	assert.Equal(t, defaultRetryAfter, parseRetryAfter(""))
+	assert.Equal(t, defaultRetryAfter, parseRetryAfter("soon"))
+	assert.Equal(t, time.Duration(0), parseRetryAfter(time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)))
+}
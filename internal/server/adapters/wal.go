@@ -0,0 +1,145 @@
+// Package adapters provides a write-ahead log (WAL) of metric changes. Every change
+// is appended to the log and synced to disk before it's acknowledged, so the state
+// can be recovered after a crash by replaying the log on top of the last snapshot.
+// The log is truncated after every successful snapshot (checkpoint).
+package adapters
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+
+	common "github.com/matthiasBT/monitoring/internal/infra/entities"
+	"github.com/matthiasBT/monitoring/internal/infra/logging"
+)
+
+const (
+	walSet    = "set"    // The metric has been created or updated, the record holds its new state
+	walDelete = "delete" // The metric has been deleted
+)
+
+// walRecord is a single entry of the WAL. Records hold the resulting state
+// of the metrics rather than the increments, so replaying them is idempotent.
+type walRecord struct {
+	Op      string          `json:"op"`
+	Metrics *common.Metrics `json:"metrics"`
+}
+
+// WAL is a struct that manages an append-only log file of metric changes.
+// A nil WAL logs nothing.
+type WAL struct {
+	Lock   *sync.Mutex     // Mutex for synchronization
+	Path   string          // Path to the log file
+	File   *os.File        // Log file opened for appending
+	Logger logging.ILogger // Logger for logging activities
+}
+
+// OpenWAL opens the log file at the given path, creating it if needed.
+func OpenWAL(path string, logger logging.ILogger) (*WAL, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, err
+	}
+	return &WAL{
+		Lock:   &sync.Mutex{},
+		Path:   path,
+		File:   file,
+		Logger: logger,
+	}, nil
+}
+
+// Append writes the records to the end of the log and syncs the file to disk.
+func (w *WAL) Append(records ...walRecord) error {
+	if w == nil || len(records) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			w.Logger.Errorf("Failed to marshal a WAL record: %s\n", err.Error())
+			return err
+		}
+	}
+
+	w.Lock.Lock()
+	defer w.Lock.Unlock()
+
+	if _, err := w.File.Write(buf.Bytes()); err != nil {
+		w.Logger.Errorf("Failed to write to the WAL: %s\n", err.Error())
+		return err
+	}
+	return w.File.Sync()
+}
+
+// Replay reads all records of the log, oldest first. A malformed last record
+// is the result of a crash in the middle of writing it, so it's skipped and cut off,
+// so that the next records aren't appended to it.
+func (w *WAL) Replay() ([]walRecord, error) {
+	if w == nil {
+		return nil, nil
+	}
+	w.Lock.Lock()
+	defer w.Lock.Unlock()
+
+	if _, err := w.File.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	var result []walRecord
+	var offset int64 // the end of the last complete record
+	reader := bufio.NewReader(w.File)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				w.Logger.Warningf("Skipping a torn WAL record at the end of the log\n")
+				if err := w.File.Truncate(offset); err != nil {
+					return nil, err
+				}
+				if err := w.File.Sync(); err != nil {
+					return nil, err
+				}
+			}
+			return result, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		var record walRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			w.Logger.Errorf("Failed to unmarshal a WAL record: %s\n", err.Error())
+			return nil, err
+		}
+		result = append(result, record)
+		offset += int64(len(line))
+	}
+}
+
+// Reset truncates the log. It's called after the state has been saved elsewhere.
+func (w *WAL) Reset() error {
+	if w == nil {
+		return nil
+	}
+	w.Lock.Lock()
+	defer w.Lock.Unlock()
+
+	if err := w.File.Truncate(0); err != nil {
+		w.Logger.Errorf("Failed to truncate the WAL: %s\n", err.Error())
+		return err
+	}
+	return w.File.Sync()
+}
+
+// Close closes the log file.
+func (w *WAL) Close() error {
+	if w == nil {
+		return nil
+	}
+	w.Lock.Lock()
+	defer w.Lock.Unlock()
+
+	return w.File.Close()
+}
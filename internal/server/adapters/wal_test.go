@@ -0,0 +1,140 @@
+package adapters
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	common "github.com/matthiasBT/monitoring/internal/infra/entities"
+	"github.com/matthiasBT/monitoring/internal/infra/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWAL_Replay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.wal")
+	wal, err := OpenWAL(path, logging.SetupLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+
+	err = wal.Append(
+		walRecord{Op: walSet, Metrics: &common.Metrics{ID: "Foo", MType: common.TypeCounter, Delta: ptrint64(1)}},
+		walRecord{Op: walDelete, Metrics: &common.Metrics{ID: "Foo"}},
+	)
+	if err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+	// a crash in the middle of writing a record
+	if _, err := wal.File.WriteString(`{"op":"set","metr`); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := wal.Replay()
+	if err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+	assert.Len(t, records, 2)
+	assert.Equal(t, walSet, records[0].Op)
+	assert.Equal(t, int64(1), *records[0].Metrics.Delta)
+	assert.Equal(t, walDelete, records[1].Op)
+
+	if err := wal.Reset(); err != nil {
+		t.Fatalf("Reset() error = %v", err)
+	}
+	records, err = wal.Replay()
+	if err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+	assert.Empty(t, records)
+}
+
+func TestWAL_ReplayTornThenAppend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.wal")
+	wal, err := OpenWAL(path, logging.SetupLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := walRecord{Op: walSet, Metrics: &common.Metrics{ID: "Foo", MType: common.TypeCounter, Delta: ptrint64(1)}}
+	if err := wal.Append(record); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+	if _, err := wal.File.WriteString(`{"op":"set","metr`); err != nil {
+		t.Fatal(err)
+	}
+	records, err := wal.Replay()
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+
+	// the records appended after the recovery must survive the next restart
+	record.Metrics.Delta = ptrint64(2)
+	if err := wal.Append(record); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+	wal.Close()
+	wal, err = OpenWAL(path, logging.SetupLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+	records, err = wal.Replay()
+	if err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+	if assert.Len(t, records, 2) {
+		assert.Equal(t, int64(2), *records[1].Metrics.Delta)
+	}
+}
+
+func TestMemStorage_Replay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.wal")
+	wal, err := OpenWAL(path, logging.SetupLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+	keeper := &FakeKeeper{}
+	stor := &MemStorage{
+		State: State{
+			Metrics: map[string]*common.Metrics{},
+			Lock:    &sync.Mutex{},
+		},
+		Logger: logging.SetupLogger(),
+		Keeper: keeper,
+		WAL:    wal,
+	}
+	ctx := context.Background()
+	stor.Add(ctx, &common.Metrics{ID: "Foo", MType: common.TypeCounter, Delta: ptrint64(2)})
+	stor.Add(ctx, &common.Metrics{ID: "Foo", MType: common.TypeCounter, Delta: ptrint64(3)})
+	stor.Add(ctx, &common.Metrics{ID: "Bar", MType: common.TypeGauge, Value: ptrfloat64(1.5)})
+	if err := stor.Delete(ctx, &common.Metrics{ID: "Bar", MType: common.TypeGauge}); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	assert.False(t, keeper.calledFlush, "Updates must go to the WAL instead of the keeper")
+
+	restored := &MemStorage{
+		State: State{
+			Metrics: map[string]*common.Metrics{},
+			Lock:    &sync.Mutex{},
+		},
+		Logger: logging.SetupLogger(),
+		WAL:    wal,
+	}
+	if err := restored.Replay(); err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+	assert.Len(t, restored.Metrics, 1)
+	assert.Equal(t, int64(5), *restored.Metrics["Foo"].Delta)
+
+	if err := stor.checkpoint(ctx); err != nil {
+		t.Fatalf("checkpoint() error = %v", err)
+	}
+	assert.True(t, keeper.calledFlush)
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Zero(t, info.Size(), "The WAL must be truncated after a checkpoint")
+}
@@ -0,0 +1,29 @@
+// Package entities defines interfaces and types for abstracting
+// storage operations in the monitoring application. This file
+// contains the Elector interface used by replicas sharing a database.
+package entities
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	RoleStandalone = "standalone" // The only replica, running all jobs
+	RoleLeader     = "leader"     // One of the replicas, running the singleton jobs
+	RoleFollower   = "follower"   // One of the replicas, serving requests only
+)
+
+// Elector decides which of the server replicas sharing a database runs the singleton jobs,
+// such as eviction of the metrics without updates.
+type Elector interface {
+	// IsLeader reports whether this replica must run the singleton jobs.
+	IsLeader() bool
+
+	// Role returns the role of this replica: RoleStandalone, RoleLeader or RoleFollower.
+	Role() string
+
+	// Gate returns a channel which receives the ticks of the given channel only while this replica
+	// is the leader. It's used for running the singleton jobs on a single replica.
+	Gate(ctx context.Context, tick <-chan time.Time) <-chan time.Time
+}
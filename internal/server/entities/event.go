@@ -0,0 +1,21 @@
+// Package entities defines interfaces and types for abstracting
+// storage operations in the monitoring application. This file
+// contains the Event type describing changes of metrics.
+package entities
+
+import "github.com/matthiasBT/monitoring/internal/infra/entities"
+
+const (
+	EventUpdate = "update" // A metric has been created or updated
+	EventDelete = "delete" // A metric has been deleted
+)
+
+// Event describes a change of a single metric published to the subscribers of the storage.
+type Event struct {
+	// Kind is either EventUpdate or EventDelete.
+	Kind string
+
+	// Metrics is the state of the metric after the change. For deletions,
+	// only the ID and the type of the metric are set.
+	Metrics *entities.Metrics
+}
@@ -0,0 +1,79 @@
+// Package entities defines interfaces and types for abstracting
+// storage operations in the monitoring application. This file
+// contains the Filter type used for selecting groups of metrics.
+package entities
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/matthiasBT/monitoring/internal/infra/entities"
+)
+
+// LabelMatcher selects metrics by the value of a single label.
+// A missing label is treated as a label with an empty value.
+type LabelMatcher struct {
+	Name   string // Name of the label
+	Value  string // Expected value of the label
+	Negate bool   // If set, metrics whose label value differs from Value are selected
+}
+
+// Match reports whether the labels satisfy the matcher.
+func (lm *LabelMatcher) Match(labels map[string]string) bool {
+	return (labels[lm.Name] == lm.Value) != lm.Negate
+}
+
+// Filter selects metrics by ID, type, ID prefix, ID regular expression and labels.
+// Empty fields match any metric, so an empty Filter matches everything.
+type Filter struct {
+	// IDs restricts the selection to metrics with one of the given IDs.
+	IDs []string
+
+	// MType restricts the selection to metrics of the given type.
+	MType string
+
+	// Prefix restricts the selection to metrics whose ID starts with it.
+	Prefix string
+
+	// Regex restricts the selection to metrics whose ID matches it.
+	Regex *regexp.Regexp
+
+	// Labels restricts the selection to metrics satisfying all the label matchers.
+	Labels []LabelMatcher
+}
+
+// IsEmpty reports whether the filter has no restrictions.
+func (f *Filter) IsEmpty() bool {
+	return len(f.IDs) == 0 && f.MType == "" && f.Prefix == "" && f.Regex == nil && len(f.Labels) == 0
+}
+
+// Match reports whether the metric satisfies all restrictions of the filter.
+func (f *Filter) Match(m *entities.Metrics) bool {
+	if len(f.IDs) > 0 && !containsID(f.IDs, m.ID) {
+		return false
+	}
+	if f.MType != "" && m.MType != f.MType {
+		return false
+	}
+	if f.Prefix != "" && !strings.HasPrefix(m.ID, f.Prefix) {
+		return false
+	}
+	if f.Regex != nil && !f.Regex.MatchString(m.ID) {
+		return false
+	}
+	for _, lm := range f.Labels {
+		if !lm.Match(m.Labels) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsID(ids []string, id string) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+package entities
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/matthiasBT/monitoring/internal/infra/entities"
+)
+
+func TestFilter_Match(t *testing.T) {
+	counter := &entities.Metrics{ID: "PollCount", MType: entities.TypeCounter}
+	gauge := &entities.Metrics{ID: "HeapAlloc", MType: entities.TypeGauge, Labels: map[string]string{"host": "a"}}
+	tests := []struct {
+		name    string
+		filter  Filter
+		metrics *entities.Metrics
+		want    bool
+	}{
+		{
+			name:    "empty_filter_matches_everything",
+			filter:  Filter{},
+			metrics: gauge,
+			want:    true,
+		},
+		{
+			name:    "id_match",
+			filter:  Filter{IDs: []string{"PollCount", "HeapAlloc"}},
+			metrics: gauge,
+			want:    true,
+		},
+		{
+			name:    "id_mismatch",
+			filter:  Filter{IDs: []string{"PollCount"}},
+			metrics: gauge,
+			want:    false,
+		},
+		{
+			name:    "type_mismatch",
+			filter:  Filter{MType: entities.TypeCounter},
+			metrics: gauge,
+			want:    false,
+		},
+		{
+			name:    "prefix_match",
+			filter:  Filter{Prefix: "Heap"},
+			metrics: gauge,
+			want:    true,
+		},
+		{
+			name:    "prefix_mismatch",
+			filter:  Filter{Prefix: "Heap"},
+			metrics: counter,
+			want:    false,
+		},
+		{
+			name:    "regex_match",
+			filter:  Filter{Regex: regexp.MustCompile("Count$")},
+			metrics: counter,
+			want:    true,
+		},
+		{
+			name:    "label_match",
+			filter:  Filter{Labels: []LabelMatcher{{Name: "host", Value: "a"}}},
+			metrics: gauge,
+			want:    true,
+		},
+		{
+			name:    "label_mismatch",
+			filter:  Filter{Labels: []LabelMatcher{{Name: "host", Value: "b"}}},
+			metrics: gauge,
+			want:    false,
+		},
+		{
+			name:    "negated_label_on_missing_label",
+			filter:  Filter{Labels: []LabelMatcher{{Name: "host", Value: "a", Negate: true}}},
+			metrics: counter,
+			want:    true,
+		},
+		{
+			name:    "all_restrictions_must_match",
+			filter:  Filter{MType: entities.TypeCounter, Prefix: "Poll", Regex: regexp.MustCompile("^Heap")},
+			metrics: counter,
+			want:    false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Match(tt.metrics); got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,15 @@
+// Package entities defines interfaces and types for abstracting
+// storage operations in the monitoring application. This file
+// contains the types describing the history of metric values.
+package entities
+
+import "time"
+
+// Sample is a single value of a metric at a point in time.
+// Counter values are converted to floats. Rollup samples describe a whole bucket:
+// the average value for gauges and the last value for counters.
+type Sample struct {
+	Time  time.Time `json:"time"`            // Moment when the value was recorded, or the start of the rollup bucket
+	Value float64   `json:"value"`           // Value of the metric at that moment
+	Count int       `json:"count,omitempty"` // Number of raw samples in the rollup bucket, zero for raw samples
+}
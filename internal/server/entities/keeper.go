@@ -17,6 +17,10 @@ type Keeper interface {
 	// depending on the implementation.
 	Flush(context.Context, []*entities.Metrics) error
 
+	// Delete removes the metrics with the given IDs from the storage.
+	// Unknown IDs are ignored.
+	Delete(ctx context.Context, ids []string) error
+
 	// Restore retrieves all stored metrics from the storage. The method
 	// is expected to return a slice of Metrics, potentially involving
 	// database queries or file read operations.
@@ -32,3 +36,12 @@ type Keeper interface {
 	// connections in a managed way.
 	Shutdown()
 }
+
+// IncrementalKeeper is a Keeper able to save individual metrics without rewriting
+// the whole state. Such keepers receive every update separately instead of a snapshot.
+type IncrementalKeeper interface {
+	Keeper
+
+	// Save writes the given metrics to the storage, leaving the other stored metrics intact.
+	Save(ctx context.Context, batch []*entities.Metrics) error
+}
@@ -5,6 +5,7 @@ package entities
 
 import (
 	"context"
+	"time"
 
 	"github.com/matthiasBT/monitoring/internal/infra/entities"
 )
@@ -22,14 +23,39 @@ type Storage interface {
 	// Returns the found metric and an error, if any.
 	Get(ctx context.Context, query *entities.Metrics) (*entities.Metrics, error)
 
-	// GetAll returns all the metrics currently stored.
+	// GetAll returns all the metrics currently stored, with their staleness flags set.
 	// Returns a map of metrics and an error, if any.
 	GetAll(ctx context.Context) (map[string]*entities.Metrics, error)
 
+	// GetHistory returns the values of a metric recorded within [from, to].
+	// Zero bounds are treated as open, and the older from is, the coarser the returned values are.
+	// Returns the samples, oldest first, and an error, if any.
+	GetHistory(ctx context.Context, query *entities.Metrics, from, to time.Time) ([]Sample, error)
+
+	// Subscribe returns a channel of the changes of the metrics selected by the filter.
+	// The channel is closed after the context is cancelled. Slow subscribers may miss events.
+	Subscribe(ctx context.Context, filter *Filter) <-chan Event
+
 	// AddBatch inserts or updates a batch of metrics in the storage.
 	// Returns an error, if any occurs during the operation.
 	AddBatch(ctx context.Context, batch []*entities.Metrics) error
 
+	// Delete removes a single metric matching the provided ID and type.
+	// Returns ErrUnknownMetric if there is no such metric.
+	Delete(ctx context.Context, query *entities.Metrics) error
+
+	// DeleteMatching removes all metrics selected by the filter.
+	// Returns the number of removed metrics and an error, if any.
+	DeleteMatching(ctx context.Context, filter *Filter) (int, error)
+
+	// Truncate removes all metrics from the storage.
+	// Returns the number of removed metrics and an error, if any.
+	Truncate(ctx context.Context) (int, error)
+
+	// ResetCounter sets the value of the counter with the given name to zero.
+	// Returns the updated metric, or ErrUnknownMetric if there is no such counter.
+	ResetCounter(ctx context.Context, name string) (*entities.Metrics, error)
+
 	// Snapshot creates and returns a snapshot of the current metrics in storage.
 	// This is typically used for backup or synchronization purposes.
 	Snapshot(ctx context.Context) ([]*entities.Metrics, error)
@@ -38,6 +64,10 @@ type Storage interface {
 	// This could be used for setting up the storage with default or initial data.
 	Init([]*entities.Metrics)
 
+	// Replay applies the changes logged since the last checkpoint on top of the current state.
+	// It's used for recovering the changes lost after a crash.
+	Replay() error
+
 	// Ping checks the liveness or connectivity of the storage system,
 	// ensuring that it is ready for operations.
 	Ping(ctx context.Context) error
@@ -46,4 +76,12 @@ type Storage interface {
 	// to some persistent or external storage system. This is often used
 	// to ensure data durability and consistency.
 	FlushPeriodic(ctx context.Context)
+
+	// EvictPeriodic handles the periodic removal of metrics that haven't been
+	// updated for longer than the given TTL. It runs until the context is cancelled.
+	EvictPeriodic(ctx context.Context, tick <-chan time.Time, ttl time.Duration)
+
+	// CompactPeriodic handles the periodic compaction of the history of metrics,
+	// rolling up old samples and dropping the expired ones. It runs until the context is cancelled.
+	CompactPeriodic(ctx context.Context, tick <-chan time.Time)
 }
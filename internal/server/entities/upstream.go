@@ -0,0 +1,27 @@
+// Package entities defines interfaces and types for abstracting
+// storage operations in the monitoring application. This file
+// contains the Upstream and ShippedState interfaces used for federation.
+package entities
+
+import (
+	"context"
+
+	"github.com/matthiasBT/monitoring/internal/infra/entities"
+)
+
+// Upstream is a central server receiving the metrics collected by this (edge) server.
+type Upstream interface {
+	// Send ships a batch of metrics to the upstream server. Counters carry the increments
+	// since the previous successful shipment, as expected by the /updates/ endpoint.
+	Send(ctx context.Context, batch []*entities.Metrics) error
+}
+
+// ShippedState persists the state of the metrics last shipped upstream, the watermark of the federation,
+// so that the changes are neither lost nor shipped twice after a restart or a failover.
+type ShippedState interface {
+	// Load returns the last shipped state of the metrics by their IDs, empty if nothing has been shipped yet.
+	Load(ctx context.Context) (map[string]*entities.Metrics, error)
+
+	// Save records the metrics as shipped and forgets the shipped state of the deleted ones.
+	Save(ctx context.Context, shipped []*entities.Metrics, forgotten []string) error
+}
@@ -4,32 +4,47 @@
 package usecases
 
 import (
+	"html/template"
+	"net/http"
+
 	"github.com/go-chi/chi/v5"
 	"github.com/matthiasBT/monitoring/internal/infra/logging"
+	"github.com/matthiasBT/monitoring/internal/infra/secure"
 	"github.com/matthiasBT/monitoring/internal/server/entities"
+	"github.com/matthiasBT/monitoring/web"
 )
 
-// BaseController is a struct that holds a logger, storage interface, and a path to HTML templates.
+// BaseController is a struct that holds a logger, storage interface, leader elector, and parsed HTML templates.
 // It is responsible for handling HTTP requests and directing them to appropriate handlers.
 type BaseController struct {
-	Logger       logging.ILogger  // Logger for logging activities
-	Stor         entities.Storage // Storage interface for managing metrics data
-	TemplatePath string           // Path to HTML templates
+	Logger    logging.ILogger    // Logger for logging activities
+	Stor      entities.Storage   // Storage interface for managing metrics data
+	Elector   entities.Elector   // Leader elector of the replicas, nil for a standalone server
+	HMACKey   string             // Key of the signatures required by the destructive endpoints, empty if unsigned
+	Templates *template.Template // HTML templates embedded into the binary
 }
 
 // NewBaseController creates and returns a new instance of BaseController.
-// It initializes the controller with a logger, storage interface, and template path.
-func NewBaseController(logger logging.ILogger, stor entities.Storage, templatePath string) *BaseController {
+// It initializes the controller with a logger, storage interface, leader elector and HMAC key,
+// and parses the embedded templates.
+func NewBaseController(
+	logger logging.ILogger, stor entities.Storage, elector entities.Elector, hmacKey string,
+) *BaseController {
 	return &BaseController{
-		Logger:       logger,
-		Stor:         stor,
-		TemplatePath: templatePath,
+		Logger:    logger,
+		Stor:      stor,
+		Elector:   elector,
+		HMACKey:   hmacKey,
+		Templates: template.Must(template.ParseFS(web.Assets, "template/*.html")),
 	}
 }
 
 // Route sets up the HTTP routes for the BaseController. It defines endpoints
 // for operations like pinging the server, updating metrics, retrieving metrics,
-// batch updating metrics, and retrieving all metrics.
+// batch updating metrics, retrieving and listing all metrics, retrieving the history
+// of a metric or of several ones, streaming metric changes, deleting metrics, and serving the static
+// assets of the dashboard. If the HMAC key is configured, the endpoints deleting
+// and resetting metrics only accept the requests signed by secure.SignRequest.
 func (c *BaseController) Route() *chi.Mux {
 	r := chi.NewRouter()
 	r.Get("/ping", c.Ping)
@@ -39,5 +54,17 @@ func (c *BaseController) Route() *chi.Mux {
 	r.Get("/value/{type}/{name}", c.GetMetric)
 	r.Post("/updates/", c.MassUpdate)
 	r.Get("/", c.GetAllMetrics)
+	r.Get("/api/metrics", c.ListMetrics)
+	r.Get("/api/history", c.ListHistories)
+	r.Get("/api/history/{type}/{name}", c.GetHistory)
+	r.Get("/stream", c.Stream)
+	r.Handle("/static/*", http.FileServer(http.FS(web.Assets)))
+	r.Group(func(r chi.Router) {
+		r.Use(secure.MiddlewareSignatureRequired(c.HMACKey, secure.DefSignatureWindow))
+		r.Delete("/value/{type}/{name}", c.DeleteMetric)
+		r.Post("/admin/delete/", c.DeleteMetrics)
+		r.Post("/admin/reset/{name}", c.ResetCounter)
+		r.Post("/admin/truncate/", c.TruncateMetrics)
+	})
 	return r
 }
@@ -0,0 +1,98 @@
+package usecases
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/matthiasBT/monitoring/internal/infra/entities"
+	"github.com/matthiasBT/monitoring/internal/infra/logging"
+	"github.com/matthiasBT/monitoring/internal/infra/secure"
+	"github.com/matthiasBT/monitoring/internal/server/adapters"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBaseController_RouteSigned(t *testing.T) {
+	const key = "secret"
+	logger := logging.SetupLogger()
+	storage := adapters.NewMemStorage(nil, nil, logger, nil, time.Minute, nil, nil, nil)
+	storage.Init([]*entities.Metrics{
+		{ID: "PollCount", MType: entities.TypeCounter, Delta: ptrint64(5)},
+		{ID: "HeapAlloc", MType: entities.TypeGauge, Value: ptrfloat64(1.25)},
+	})
+	r := chi.NewRouter()
+	r.Use(secure.MiddlewareHashReader(key))
+	r.Mount("/", NewBaseController(logger, storage, nil, key).Route())
+	sign := func(method, path string) http.Header {
+		req := httptest.NewRequest(method, path, nil)
+		if err := secure.SignRequest([]byte(key), req, nil); err != nil {
+			t.Fatalf("Failed to sign: %v", err)
+		}
+		return req.Header
+	}
+	// a signature of a request to another path, which a client has sent before
+	captured := sign(http.MethodPost, "/admin/reset/PollCount")
+	forged := sign(http.MethodPost, "/admin/truncate/")
+	forged.Set(secure.SignatureHeader, "forged")
+	expired := sign(http.MethodPost, "/admin/truncate/")
+	expired.Set(secure.TimestampHeader, strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10))
+	deletion := sign(http.MethodDelete, "/value/gauge/HeapAlloc")
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		header http.Header
+		want   int
+	}{
+		{name: "unsigned", method: http.MethodPost, path: "/admin/truncate/", want: http.StatusUnauthorized},
+		{name: "unsigned", method: http.MethodDelete, path: "/value/gauge/HeapAlloc", want: http.StatusUnauthorized},
+		{
+			name: "body hash only", method: http.MethodPost, path: "/admin/truncate/",
+			header: http.Header{"Hashsha256": {bodySignature(t, key)}}, want: http.StatusUnauthorized,
+		},
+		{name: "forged", method: http.MethodPost, path: "/admin/truncate/", header: forged, want: http.StatusUnauthorized},
+		{
+			name: "expired", method: http.MethodPost, path: "/admin/truncate/",
+			header: expired, want: http.StatusUnauthorized,
+		},
+		{
+			name: "signature of another path", method: http.MethodPost, path: "/admin/truncate/",
+			header: captured, want: http.StatusUnauthorized,
+		},
+		{name: "public", method: http.MethodGet, path: "/value/gauge/HeapAlloc", want: http.StatusOK},
+		{name: "signed", method: http.MethodDelete, path: "/value/gauge/HeapAlloc", header: deletion, want: http.StatusOK},
+		{
+			name: "replayed", method: http.MethodDelete, path: "/value/gauge/HeapAlloc",
+			header: deletion, want: http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name+" "+tt.method+" "+tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			for name, values := range tt.header {
+				req.Header[name] = values
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			assert.Equal(t, tt.want, w.Code)
+		})
+	}
+	state, err := storage.GetAll(context.Background())
+	assert.NoError(t, err)
+	assert.Contains(t, state, "PollCount", "Unsigned requests must not change anything")
+	assert.NotContains(t, state, "HeapAlloc")
+}
+
+// bodySignature returns the signature of an empty body, which is the same for all the requests without a body
+func bodySignature(t *testing.T, key string) string {
+	signature, err := secure.Sign([]byte(key), nil)
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	return signature
+}
@@ -7,10 +7,12 @@ package usecases
 import (
 	"bytes"
 	"context"
-	"html/template"
-	"path/filepath"
+	"errors"
+	"sort"
+	"time"
 
 	"github.com/matthiasBT/monitoring/internal/infra/entities"
+	server "github.com/matthiasBT/monitoring/internal/server/entities"
 )
 
 // UpdateMetric updates a single metric in the storage using the provided BaseController.
@@ -37,29 +39,149 @@ func GetAllMetrics(ctx context.Context, c *BaseController, templateName string)
 		return nil, err
 	}
 	data := prepareTemplateData(metrics)
-	initialBytes := make([]byte, 0, len(data))
 	var result bytes.Buffer
-	result.Write(initialBytes)
-	path := filepath.Join(c.TemplatePath, templateName)
-	tmpl := template.Must(template.ParseFiles(path))
-	if err := tmpl.Execute(&result, data); err != nil {
+	if err := c.Templates.ExecuteTemplate(&result, templateName, data); err != nil {
 		return nil, err
 	}
 	return &result, nil
 }
 
+// GetHistory retrieves the values of a metric recorded within [from, to] from the storage.
+// It returns the samples, oldest first, and an error, if any.
+func GetHistory(
+	ctx context.Context, c *BaseController, metrics *entities.Metrics, from, to time.Time,
+) ([]server.Sample, error) {
+	return c.Stor.GetHistory(ctx, metrics, from, to)
+}
+
+// ListHistories retrieves the histories of the metrics selected by the filter within [from, to],
+// sorted by the metric type and ID. The metrics without history are skipped.
+func ListHistories(
+	ctx context.Context, c *BaseController, filter *server.Filter, from, to time.Time,
+) ([]*historyResponse, error) {
+	metrics, err := c.Stor.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	selected := make([]*entities.Metrics, 0, len(metrics))
+	for _, m := range metrics {
+		if filter.Match(m) {
+			selected = append(selected, m)
+		}
+	}
+	sort.Slice(selected, func(i, j int) bool {
+		if selected[i].MType != selected[j].MType {
+			return selected[i].MType < selected[j].MType
+		}
+		return selected[i].ID < selected[j].ID
+	})
+	result := make([]*historyResponse, 0, len(selected))
+	for _, m := range selected {
+		samples, err := c.Stor.GetHistory(ctx, m, from, to)
+		if errors.Is(err, entities.ErrUnknownMetric) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		result = append(result, &historyResponse{ID: m.ID, MType: m.MType, Samples: samples})
+	}
+	return result, nil
+}
+
+// Stream subscribes to the changes of the metrics selected by the filter.
+// The returned channel is closed after the context is cancelled.
+func Stream(ctx context.Context, c *BaseController, filter *server.Filter) <-chan server.Event {
+	return c.Stor.Subscribe(ctx, filter)
+}
+
+// ListMetrics retrieves the metrics selected by the query from the storage,
+// sorted and cut into a page. It returns the page and an error, if any.
+func ListMetrics(ctx context.Context, c *BaseController, query *listQuery) (*listResponse, error) {
+	metrics, err := c.Stor.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return paginate(metrics, query)
+}
+
 // MassUpdate updates a batch of metrics in the storage using the provided BaseController.
 // It returns an error, if any occurs during the operation.
 func MassUpdate(ctx context.Context, c *BaseController, batch []*entities.Metrics) error {
 	return c.Stor.AddBatch(ctx, batch)
 }
 
-// prepareTemplateData prepares a map of metrics data for rendering in an HTML template.
-// It converts the metrics data into a suitable format for templating.
-func prepareTemplateData(metrics map[string]*entities.Metrics) map[string]string {
-	var data = make(map[string]string, len(metrics))
+// DeleteMetric removes a single metric from the storage using the provided BaseController.
+// It returns an error, if any occurs during the operation.
+func DeleteMetric(ctx context.Context, c *BaseController, metrics *entities.Metrics) error {
+	return c.Stor.Delete(ctx, metrics)
+}
+
+// DeleteMetrics removes all metrics selected by the filter from the storage.
+// It returns the number of removed metrics and an error, if any.
+func DeleteMetrics(ctx context.Context, c *BaseController, filter *server.Filter) (int, error) {
+	return c.Stor.DeleteMatching(ctx, filter)
+}
+
+// TruncateMetrics removes all metrics from the storage.
+// It returns the number of removed metrics and an error, if any.
+func TruncateMetrics(ctx context.Context, c *BaseController) (int, error) {
+	return c.Stor.Truncate(ctx)
+}
+
+// ResetCounter sets the value of the counter with the given name to zero.
+// It returns the updated counter and an error, if any.
+func ResetCounter(ctx context.Context, c *BaseController, name string) (*entities.Metrics, error) {
+	return c.Stor.ResetCounter(ctx, name)
+}
+
+// templateRow is a single metric row rendered in an HTML template.
+type templateRow struct {
+	ID        string // Metric name
+	Type      string // Metric type
+	Value     string // Metric value formatted as a string
+	UpdatedAt string // Time of the last update formatted as a string
+	Stale     bool   // Whether the metric hasn't been updated for too long
+}
+
+// templateGroup is a table of metrics of the same type rendered in an HTML template.
+type templateGroup struct {
+	Type  string        // Metric type
+	Title string        // Table title
+	Rows  []templateRow // Metrics sorted by name
+}
+
+// templateData is the data rendered in the dashboard HTML template.
+type templateData struct {
+	Groups []templateGroup // Non-empty groups of metrics
+}
+
+// prepareTemplateData prepares metrics data for rendering in an HTML template.
+// It groups the metrics by type and sorts them by name within each group.
+func prepareTemplateData(metrics map[string]*entities.Metrics) templateData {
+	groups := []templateGroup{
+		{Type: entities.TypeGauge, Title: "Gauges"},
+		{Type: entities.TypeCounter, Title: "Counters"},
+	}
 	for _, m := range metrics {
-		data[m.ID] = m.ValueAsString()
+		row := templateRow{ID: m.ID, Type: m.MType, Value: m.ValueAsString(), Stale: m.Stale}
+		if m.UpdatedAt != nil {
+			row.UpdatedAt = m.UpdatedAt.Local().Format(time.DateTime)
+		}
+		for i := range groups {
+			if groups[i].Type == m.MType {
+				groups[i].Rows = append(groups[i].Rows, row)
+			}
+		}
+	}
+	var data templateData
+	for _, group := range groups {
+		if len(group.Rows) == 0 {
+			continue
+		}
+		sort.Slice(group.Rows, func(i, j int) bool {
+			return group.Rows[i].ID < group.Rows[j].ID
+		})
+		data.Groups = append(data.Groups, group)
 	}
 	return data
 }
@@ -1,24 +1,30 @@
 package usecases
 
 import (
+	"context"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/matthiasBT/monitoring/internal/infra/entities"
+	"github.com/matthiasBT/monitoring/internal/infra/logging"
+	"github.com/matthiasBT/monitoring/internal/server/adapters"
+	server "github.com/matthiasBT/monitoring/internal/server/entities"
+	"github.com/stretchr/testify/assert"
 )
 
 func Test_prepareTemplateData(t *testing.T) {
+	updatedAt := time.Date(2023, 11, 1, 12, 0, 0, 0, time.Local)
 	tests := []struct {
 		name    string
 		Metrics map[string]*entities.Metrics
-		want    map[string]string
-		wantErr error
+		want    templateData
 	}{
 		{
 			name:    "get empty data for template",
 			Metrics: make(map[string]*entities.Metrics),
-			want:    make(map[string]string),
-			wantErr: nil,
+			want:    templateData{},
 		},
 		{
 			name: "get mixed data for template",
@@ -30,16 +36,41 @@ func Test_prepareTemplateData(t *testing.T) {
 					Value: nil,
 				},
 				"BarFoo": {
-					ID:    "BarFoo",
+					ID:        "BarFoo",
+					MType:     entities.TypeGauge,
+					Delta:     nil,
+					Value:     ptrfloat64(55.1534),
+					UpdatedAt: &updatedAt,
+					Stale:     true,
+				},
+				"AbcFoo": {
+					ID:    "AbcFoo",
 					MType: entities.TypeGauge,
 					Delta: nil,
-					Value: ptrfloat64(55.1534),
+					Value: ptrfloat64(1),
 				},
 			},
-			want: map[string]string{
-				"FooBar": "33", "BarFoo": "55.1534",
-			},
-			wantErr: nil,
+			want: templateData{Groups: []templateGroup{
+				{
+					Type:  entities.TypeGauge,
+					Title: "Gauges",
+					Rows: []templateRow{
+						{ID: "AbcFoo", Type: entities.TypeGauge, Value: "1."},
+						{
+							ID:        "BarFoo",
+							Type:      entities.TypeGauge,
+							Value:     "55.1534",
+							UpdatedAt: "2023-11-01 12:00:00",
+							Stale:     true,
+						},
+					},
+				},
+				{
+					Type:  entities.TypeCounter,
+					Title: "Counters",
+					Rows:  []templateRow{{ID: "FooBar", Type: entities.TypeCounter, Value: "33"}},
+				},
+			}},
 		},
 	}
 	for _, tt := range tests {
@@ -59,3 +90,62 @@ func ptrfloat64(val float64) *float64 {
 func ptrint64(val int64) *int64 {
 	return &val
 }
+
+func TestGetAllMetrics(t *testing.T) {
+	logger := logging.SetupLogger()
+	storage := adapters.NewMemStorage(nil, nil, logger, nil, time.Minute, nil, nil, nil)
+	storage.Init([]*entities.Metrics{
+		{ID: "PollCount", MType: entities.TypeCounter, Delta: ptrint64(5)},
+		{ID: "HeapAlloc", MType: entities.TypeGauge, Value: ptrfloat64(1.25)},
+	})
+	controller := NewBaseController(logger, storage, nil, "")
+	got, err := GetAllMetrics(context.Background(), controller, "all_metrics.html")
+	if err != nil {
+		t.Fatalf("GetAllMetrics() error = %v", err)
+	}
+	page := got.String()
+	for _, want := range []string{"Gauges", "Counters", `data-id="PollCount"`, "1.25"} {
+		if !strings.Contains(page, want) {
+			t.Errorf("Rendered page doesn't contain %q", want)
+		}
+	}
+}
+
+func TestListHistories(t *testing.T) {
+	logger := logging.SetupLogger()
+	history := adapters.NewHistory(10, nil)
+	storage := adapters.NewMemStorage(nil, nil, logger, nil, time.Minute, history, nil, nil)
+	controller := NewBaseController(logger, storage, nil, "")
+	ctx := context.Background()
+	storage.Init([]*entities.Metrics{{ID: "Restored", MType: entities.TypeGauge, Value: ptrfloat64(1)}})
+	for _, metrics := range []*entities.Metrics{
+		{ID: "PollCount", MType: entities.TypeCounter, Delta: ptrint64(5)},
+		{ID: "HeapAlloc", MType: entities.TypeGauge, Value: ptrfloat64(1.25)},
+		{ID: "Alloc", MType: entities.TypeGauge, Value: ptrfloat64(2.5)},
+	} {
+		if _, err := storage.Add(ctx, metrics); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+	}
+
+	got, err := ListHistories(ctx, controller, &server.Filter{}, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("ListHistories() error = %v", err)
+	}
+	var ids []string
+	for _, h := range got {
+		ids = append(ids, h.MType+"/"+h.ID)
+		assert.Len(t, h.Samples, 1)
+	}
+	assert.Equal(t, []string{"counter/PollCount", "gauge/Alloc", "gauge/HeapAlloc"}, ids,
+		"Histories must be sorted, and the metrics without history skipped")
+
+	filter := &server.Filter{MType: entities.TypeGauge, Prefix: "Heap"}
+	got, err = ListHistories(ctx, controller, filter, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("ListHistories() error = %v", err)
+	}
+	if assert.Len(t, got, 1) {
+		assert.Equal(t, "HeapAlloc", got[0].ID)
+	}
+}
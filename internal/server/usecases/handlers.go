@@ -1,6 +1,6 @@
 // Package usecases provides methods for handling HTTP requests related to
 // metrics management in the monitoring application. It includes methods for
-// updating, retrieving, and batch processing metrics, as well as health checking.
+// updating, retrieving, deleting, and batch processing metrics, as well as health checking.
 package usecases
 
 import (
@@ -8,7 +8,10 @@ import (
 	"errors"
 	"io"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/go-chi/chi/v5"
 	common "github.com/matthiasBT/monitoring/internal/infra/entities"
 )
 
@@ -92,6 +95,103 @@ func (c *BaseController) GetAllMetrics(w http.ResponseWriter, r *http.Request) {
 	w.Write(result.Bytes())
 }
 
+// ListMetrics handles the HTTP request for listing metrics as JSON.
+// It supports filtering, sorting and cursor pagination via URL query parameters.
+func (c *BaseController) ListMetrics(w http.ResponseWriter, r *http.Request) {
+	query, err := parseListQuery(r)
+	if err != nil {
+		handleInvalidMetric(w, err)
+		return
+	}
+
+	result, err := ListMetrics(r.Context(), c, query)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	body, err := json.Marshal(result)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+// GetHistory handles the HTTP request for retrieving the history of a metric as JSON.
+// The metric type and name are taken from the URL; optional "from" and "to" query
+// parameters limit the time range and must be formatted as RFC 3339.
+func (c *BaseController) GetHistory(w http.ResponseWriter, r *http.Request) {
+	metrics := parseMetric(r, false, false)
+	if err := metrics.Validate(false); err != nil {
+		handleInvalidMetric(w, err)
+		return
+	}
+	from, to, err := parseTimeRange(r.URL.Query())
+	if err != nil {
+		handleInvalidMetric(w, err)
+		return
+	}
+
+	samples, err := GetHistory(r.Context(), c, metrics, from, to)
+	if err != nil {
+		var status int
+		if errors.Is(err, common.ErrUnknownMetric) {
+			status = http.StatusNotFound
+		} else {
+			status = http.StatusInternalServerError
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	body, err := json.Marshal(historyResponse{ID: metrics.ID, MType: metrics.MType, Samples: samples})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+// ListHistories handles the HTTP request for retrieving the histories of several metrics as JSON,
+// so that a client doesn't request them one by one. The metrics are selected by the same filter
+// parameters as in ListMetrics, and the optional "from" and "to" limit the time range.
+func (c *BaseController) ListHistories(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	filter, err := parseFilterQuery(values)
+	if err != nil {
+		handleInvalidMetric(w, err)
+		return
+	}
+	from, to, err := parseTimeRange(values)
+	if err != nil {
+		handleInvalidMetric(w, err)
+		return
+	}
+
+	histories, err := ListHistories(r.Context(), c, filter, from, to)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	body, err := json.Marshal(historiesResponse{Histories: histories})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
 // MassUpdate handles the HTTP request for updating a batch of metrics.
 // It only accepts JSON data, validates the input, and sends an appropriate response.
 func (c *BaseController) MassUpdate(w http.ResponseWriter, r *http.Request) {
@@ -130,12 +230,151 @@ func (c *BaseController) MassUpdate(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+// DeleteMetric handles the HTTP request for deleting a single metric.
+// The metric type and name are taken from the URL.
+func (c *BaseController) DeleteMetric(w http.ResponseWriter, r *http.Request) {
+	metrics := parseMetric(r, false, false)
+	if err := metrics.Validate(false); err != nil {
+		handleInvalidMetric(w, err)
+		return
+	}
+
+	if err := DeleteMetric(r.Context(), c, metrics); err != nil {
+		var status int
+		if errors.Is(err, common.ErrUnknownMetric) {
+			status = http.StatusNotFound
+		} else {
+			status = http.StatusInternalServerError
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// DeleteMetrics handles the HTTP request for deleting all metrics selected by a filter.
+// It only accepts JSON data and refuses empty filters; use TruncateMetrics to delete everything.
+func (c *BaseController) DeleteMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Content-Type") != "application/json" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("Supply data as JSON"))
+		return
+	}
+
+	filter, err := parseFilter(r)
+	if err != nil {
+		handleInvalidMetric(w, err)
+		return
+	}
+	if filter.IsEmpty() {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("Specify a type, prefix or regex"))
+		return
+	}
+
+	deleted, err := DeleteMetrics(r.Context(), c, filter)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	writeDeleted(w, deleted)
+}
+
+// TruncateMetrics handles the HTTP request for deleting all metrics from the storage.
+func (c *BaseController) TruncateMetrics(w http.ResponseWriter, r *http.Request) {
+	deleted, err := TruncateMetrics(r.Context(), c)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	writeDeleted(w, deleted)
+}
+
+// ResetCounter handles the HTTP request for setting a counter to zero.
+// The counter name is taken from the URL, and the updated counter is written back as JSON.
+func (c *BaseController) ResetCounter(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	if strings.TrimSpace(name) == "" {
+		handleInvalidMetric(w, common.ErrMissingMetricName)
+		return
+	}
+
+	result, err := ResetCounter(r.Context(), c, name)
+	if err != nil {
+		var status int
+		if errors.Is(err, common.ErrUnknownMetric) {
+			status = http.StatusNotFound
+		} else {
+			status = http.StatusInternalServerError
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	if err := writeMetric(w, true, result); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+	}
+}
+
 // Ping handles the HTTP request for checking the storage connectivity or liveliness.
 // It uses the Ping method of the storage and sends an appropriate response.
+// On success, the body contains the role of the replica: standalone, leader or follower.
 func (c *BaseController) Ping(w http.ResponseWriter, r *http.Request) {
 	if err := c.Stor.Ping(r.Context()); err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(replicaRole(c.Elector)))
+}
+
+// Stream handles the HTTP request for streaming the changes of metrics as server-sent events.
+// The metrics can be selected by the "id", "type", "prefix", "regex" and "label" query parameters.
+// Every change is sent as an "update" or "delete" event with the metric as JSON data.
+// Comments are sent periodically to keep idle connections alive.
+func (c *BaseController) Stream(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseFilterQuery(r.URL.Query())
+	if err != nil {
+		handleInvalidMetric(w, err)
+		return
 	}
+
+	rc := http.NewResponseController(w)
+	events := Stream(r.Context(), c, filter)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
 	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		c.Logger.Errorf("Streaming is not supported: %s\n", err.Error())
+		return
+	}
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if err := writeEvent(w, rc, &event); err != nil {
+				c.Logger.Errorf("Failed to write an event: %s\n", err.Error())
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
 }
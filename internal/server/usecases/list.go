@@ -0,0 +1,204 @@
+// Package usecases provides helpers for listing metrics as JSON: parsing of
+// listing queries, sorting, and cursor-based pagination.
+package usecases
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	common "github.com/matthiasBT/monitoring/internal/infra/entities"
+	"github.com/matthiasBT/monitoring/internal/server/entities"
+)
+
+const (
+	defListLimit = 100  // Page size used when the limit isn't specified
+	maxListLimit = 1000 // Maximal page size
+
+	sortByID        = "id"
+	sortByType      = "type"
+	sortByValue     = "value"
+	sortByUpdatedAt = "updated_at"
+)
+
+// ErrInvalidQuery is returned when a listing query can't be parsed.
+var ErrInvalidQuery = errors.New("invalid query")
+
+// listQuery describes which metrics to list and how to order and paginate them.
+type listQuery struct {
+	Filter *entities.Filter // Selection of metrics
+	SortBy string           // Field to sort by: id, type, value or updated_at
+	Desc   bool             // Whether to sort in descending order
+	Limit  int              // Maximal number of metrics on the page
+	Cursor *common.Metrics  // Sort key of the last metric of the previous page, if any
+}
+
+// listResponse is the JSON response of the listing endpoint.
+type listResponse struct {
+	Metrics    []*common.Metrics `json:"metrics"`
+	NextCursor string            `json:"next_cursor,omitempty"`
+}
+
+// parseListQuery parses a listing query from the URL query parameters. Besides the filter
+// parameters, it accepts "sort", "order" (asc or desc), "limit" and "cursor".
+func parseListQuery(r *http.Request) (*listQuery, error) {
+	values := r.URL.Query()
+	filter, err := parseFilterQuery(values)
+	if err != nil {
+		return nil, err
+	}
+	query := listQuery{Filter: filter, SortBy: sortByID, Limit: defListLimit}
+	if sortBy := values.Get("sort"); sortBy != "" {
+		switch sortBy {
+		case sortByID, sortByType, sortByValue, sortByUpdatedAt:
+			query.SortBy = sortBy
+		default:
+			return nil, fmt.Errorf("%w: unknown sort field %q", ErrInvalidQuery, sortBy)
+		}
+	}
+	switch order := values.Get("order"); order {
+	case "", "asc":
+	case "desc":
+		query.Desc = true
+	default:
+		return nil, fmt.Errorf("%w: unknown order %q", ErrInvalidQuery, order)
+	}
+	if limit := values.Get("limit"); limit != "" {
+		query.Limit, err = strconv.Atoi(limit)
+		if err != nil || query.Limit <= 0 || query.Limit > maxListLimit {
+			return nil, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidQuery, maxListLimit)
+		}
+	}
+	if cursor := values.Get("cursor"); cursor != "" {
+		if query.Cursor, err = decodeCursor(cursor); err != nil {
+			return nil, errors.Join(ErrInvalidQuery, err)
+		}
+	}
+	return &query, nil
+}
+
+// paginate filters, sorts and cuts a page out of the metrics according to the query.
+// The returned cursor is empty on the last page.
+func paginate(metrics map[string]*common.Metrics, query *listQuery) (*listResponse, error) {
+	selected := make([]*common.Metrics, 0, len(metrics))
+	for _, m := range metrics {
+		if !query.Filter.Match(m) {
+			continue
+		}
+		if query.Cursor != nil && !query.after(m, query.Cursor) {
+			continue
+		}
+		selected = append(selected, m)
+	}
+	sort.Slice(selected, func(i, j int) bool {
+		return query.after(selected[j], selected[i])
+	})
+
+	result := listResponse{Metrics: selected}
+	if len(selected) > query.Limit {
+		result.Metrics = selected[:query.Limit]
+		cursor, err := encodeCursor(result.Metrics[query.Limit-1])
+		if err != nil {
+			return nil, err
+		}
+		result.NextCursor = cursor
+	}
+	return &result, nil
+}
+
+// after reports whether the metric a goes after the metric b in the order defined by the query.
+func (query *listQuery) after(a, b *common.Metrics) bool {
+	cmp := compareMetrics(a, b, query.SortBy)
+	if cmp == 0 {
+		cmp = strings.Compare(a.ID, b.ID)
+	}
+	if query.Desc {
+		return cmp < 0
+	}
+	return cmp > 0
+}
+
+// compareMetrics compares two metrics by the given field, returning -1, 0 or 1.
+func compareMetrics(a, b *common.Metrics, sortBy string) int {
+	switch sortBy {
+	case sortByType:
+		return strings.Compare(a.MType, b.MType)
+	case sortByValue:
+		return compareFloats(numericValue(a), numericValue(b))
+	case sortByUpdatedAt:
+		return compareTimes(a.UpdatedAt, b.UpdatedAt)
+	default:
+		return strings.Compare(a.ID, b.ID)
+	}
+}
+
+// numericValue returns the value of a gauge or a counter as a float.
+func numericValue(m *common.Metrics) float64 {
+	switch {
+	case m.Value != nil:
+		return *m.Value
+	case m.Delta != nil:
+		return float64(*m.Delta)
+	default:
+		return 0
+	}
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// compareTimes compares two optional timestamps. Missing timestamps go first.
+func compareTimes(a, b *time.Time) int {
+	var ta, tb time.Time
+	if a != nil {
+		ta = *a
+	}
+	if b != nil {
+		tb = *b
+	}
+	switch {
+	case ta.Before(tb):
+		return -1
+	case ta.After(tb):
+		return 1
+	default:
+		return 0
+	}
+}
+
+// encodeCursor converts the sort key of a metric to an opaque cursor string.
+func encodeCursor(m *common.Metrics) (string, error) {
+	key := common.Metrics{ID: m.ID, MType: m.MType, Delta: m.Delta, Value: m.Value, UpdatedAt: m.UpdatedAt}
+	raw, err := json.Marshal(key)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// decodeCursor converts an opaque cursor string back to the sort key of a metric.
+func decodeCursor(cursor string) (*common.Metrics, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+	var key common.Metrics
+	if err := json.Unmarshal(raw, &key); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
@@ -0,0 +1,125 @@
+package usecases
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	common "github.com/matthiasBT/monitoring/internal/infra/entities"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_parseListQuery(t *testing.T) {
+	tests := []struct {
+		name      string
+		url       string
+		wantSort  string
+		wantDesc  bool
+		wantLimit int
+		wantErr   error
+	}{
+		{
+			name:      "defaults",
+			url:       "/api/metrics",
+			wantSort:  sortByID,
+			wantLimit: defListLimit,
+		},
+		{
+			name:      "sort_order_limit",
+			url:       "/api/metrics?sort=value&order=desc&limit=5&label=host%3Da",
+			wantSort:  sortByValue,
+			wantDesc:  true,
+			wantLimit: 5,
+		},
+		{
+			name:    "unknown_sort_field",
+			url:     "/api/metrics?sort=color",
+			wantErr: ErrInvalidQuery,
+		},
+		{
+			name:    "limit_too_big",
+			url:     "/api/metrics?limit=100500",
+			wantErr: ErrInvalidQuery,
+		},
+		{
+			name:    "broken_cursor",
+			url:     "/api/metrics?cursor=%21%21",
+			wantErr: ErrInvalidQuery,
+		},
+		{
+			name:    "broken_label_matcher",
+			url:     "/api/metrics?label=host",
+			wantErr: ErrInvalidFilter,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, tt.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := parseListQuery(req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Error mismatch. got: %v, want: %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			assert.Equal(t, tt.wantSort, got.SortBy)
+			assert.Equal(t, tt.wantDesc, got.Desc)
+			assert.Equal(t, tt.wantLimit, got.Limit)
+		})
+	}
+}
+
+func Test_paginate(t *testing.T) {
+	metrics := map[string]*common.Metrics{
+		"A": {ID: "A", MType: common.TypeGauge, Value: ptrfloat64(3)},
+		"B": {ID: "B", MType: common.TypeCounter, Delta: ptrint64(1)},
+		"C": {ID: "C", MType: common.TypeGauge, Value: ptrfloat64(2), Labels: map[string]string{"host": "a"}},
+		"D": {ID: "D", MType: common.TypeGauge, Value: ptrfloat64(2)},
+	}
+	query, err := parseListQuery(mustRequest(t, "/api/metrics?type=gauge&sort=value&order=desc&limit=2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var pages [][]string
+	for {
+		page, err := paginate(metrics, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, m := range page.Metrics {
+			ids = append(ids, m.ID)
+		}
+		pages = append(pages, ids)
+		if page.NextCursor == "" {
+			break
+		}
+		if query.Cursor, err = decodeCursor(page.NextCursor); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assert.Equal(t, [][]string{{"A", "D"}, {"C"}}, pages)
+
+	query, err = parseListQuery(mustRequest(t, "/api/metrics?label=host!%3Da"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := paginate(metrics, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, page.Metrics, 3)
+	assert.Empty(t, page.NextCursor)
+}
+
+func mustRequest(t *testing.T, url string) *http.Request {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
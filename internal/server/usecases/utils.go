@@ -5,14 +5,41 @@ package usecases
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"regexp"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	common "github.com/matthiasBT/monitoring/internal/infra/entities"
+	"github.com/matthiasBT/monitoring/internal/server/entities"
 )
 
+// streamKeepAlive is the interval of keep-alive comments sent to idle event stream clients.
+const streamKeepAlive = 15 * time.Second
+
+// ErrInvalidFilter is returned when a metrics filter can't be parsed.
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// filterRequest is the JSON representation of a filter selecting a group of metrics.
+// Labels are given as "name=value" or "name!=value" matchers.
+type filterRequest struct {
+	IDs    []string `json:"ids,omitempty"`
+	MType  string   `json:"type,omitempty"`
+	Prefix string   `json:"prefix,omitempty"`
+	Regex  string   `json:"regex,omitempty"`
+	Labels []string `json:"labels,omitempty"`
+}
+
+// deleteResponse is the JSON response of the bulk deletion endpoints.
+type deleteResponse struct {
+	Deleted int `json:"deleted"`
+}
+
 // parseMetric parses a metric from an HTTP request. It supports JSON and URL-encoded data.
 // For URL-encoded data, it can parse with or without the metric value.
 func parseMetric(r *http.Request, asJSON bool, withValue bool) *common.Metrics {
@@ -50,6 +77,128 @@ func parseMetric(r *http.Request, asJSON bool, withValue bool) *common.Metrics {
 	return &metrics
 }
 
+// historyResponse is the JSON response of the history endpoint.
+type historyResponse struct {
+	ID      string            `json:"id"`
+	MType   string            `json:"type"`
+	Samples []entities.Sample `json:"samples"`
+}
+
+// historiesResponse is the JSON response of the endpoint returning the histories of several metrics.
+type historiesResponse struct {
+	Histories []*historyResponse `json:"histories"`
+}
+
+// writeEvent writes a metric change to the response as a server-sent event
+// and flushes it to the client.
+func writeEvent(w http.ResponseWriter, rc *http.ResponseController, event *entities.Event) error {
+	body, err := json.Marshal(event.Metrics)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Kind, body); err != nil {
+		return err
+	}
+	return rc.Flush()
+}
+
+// parseTimeRange parses the optional "from" and "to" URL query parameters formatted as RFC 3339.
+// Missing bounds are returned as zero times.
+func parseTimeRange(values url.Values) (time.Time, time.Time, error) {
+	var from, to time.Time
+	var err error
+	if raw := values.Get("from"); raw != "" {
+		if from, err = time.Parse(time.RFC3339, raw); err != nil {
+			return from, to, errors.Join(ErrInvalidQuery, err)
+		}
+	}
+	if raw := values.Get("to"); raw != "" {
+		if to, err = time.Parse(time.RFC3339, raw); err != nil {
+			return from, to, errors.Join(ErrInvalidQuery, err)
+		}
+	}
+	return from, to, nil
+}
+
+// parseFilter parses a metrics filter from the JSON body of an HTTP request.
+// It returns ErrInvalidMetricType for unknown metric types and ErrInvalidFilter
+// for malformed bodies, regular expressions or label matchers.
+func parseFilter(r *http.Request) (*entities.Filter, error) {
+	var req filterRequest
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, errors.Join(ErrInvalidFilter, err)
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, errors.Join(ErrInvalidFilter, err)
+	}
+	return buildFilter(&req)
+}
+
+// parseFilterQuery parses a metrics filter from the URL query parameters
+// "type", "prefix", "regex" and the repeatable "id" and "label".
+func parseFilterQuery(values url.Values) (*entities.Filter, error) {
+	req := filterRequest{
+		IDs:    values["id"],
+		MType:  values.Get("type"),
+		Prefix: values.Get("prefix"),
+		Regex:  values.Get("regex"),
+		Labels: values["label"],
+	}
+	return buildFilter(&req)
+}
+
+// buildFilter validates a filter request and converts it to a Filter.
+func buildFilter(req *filterRequest) (*entities.Filter, error) {
+	if req.MType != "" && req.MType != common.TypeGauge && req.MType != common.TypeCounter {
+		return nil, common.ErrInvalidMetricType
+	}
+	filter := entities.Filter{IDs: req.IDs, MType: req.MType, Prefix: req.Prefix}
+	if req.Regex != "" {
+		var err error
+		if filter.Regex, err = regexp.Compile(req.Regex); err != nil {
+			return nil, errors.Join(ErrInvalidFilter, err)
+		}
+	}
+	for _, raw := range req.Labels {
+		matcher, err := parseLabelMatcher(raw)
+		if err != nil {
+			return nil, err
+		}
+		filter.Labels = append(filter.Labels, *matcher)
+	}
+	return &filter, nil
+}
+
+// parseLabelMatcher parses a label matcher in the "name=value" or "name!=value" format.
+func parseLabelMatcher(raw string) (*entities.LabelMatcher, error) {
+	name, value, found := strings.Cut(raw, "=")
+	if !found {
+		return nil, fmt.Errorf("%w: label matcher %q must look like name=value", ErrInvalidFilter, raw)
+	}
+	matcher := entities.LabelMatcher{Name: name, Value: value}
+	if strings.HasSuffix(name, "!") {
+		matcher.Name = strings.TrimSuffix(name, "!")
+		matcher.Negate = true
+	}
+	if matcher.Name == "" {
+		return nil, fmt.Errorf("%w: label matcher %q has no label name", ErrInvalidFilter, raw)
+	}
+	return &matcher, nil
+}
+
+// writeDeleted writes the number of deleted metrics to an HTTP response as JSON.
+func writeDeleted(w http.ResponseWriter, deleted int) {
+	body, err := json.Marshal(deleteResponse{Deleted: deleted})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
 // writeMetric writes a metric to an HTTP response. It supports both JSON and plain text formats.
 func writeMetric(w http.ResponseWriter, asJSON bool, metrics *common.Metrics) error {
 	var body []byte
@@ -78,8 +227,21 @@ func handleInvalidMetric(w http.ResponseWriter, err error) {
 		w.WriteHeader(http.StatusNotFound)
 	case errors.Is(err, common.ErrInvalidMetricVal):
 		w.WriteHeader(http.StatusBadRequest)
+	case errors.Is(err, ErrInvalidFilter):
+		w.WriteHeader(http.StatusBadRequest)
+	case errors.Is(err, ErrInvalidQuery):
+		w.WriteHeader(http.StatusBadRequest)
 	default:
 		w.WriteHeader(http.StatusInternalServerError)
 	}
 	w.Write([]byte(err.Error()))
 }
+
+// replicaRole returns the role of the server replica reported by the elector.
+// A server without an elector is standalone.
+func replicaRole(elector entities.Elector) string {
+	if elector == nil {
+		return entities.RoleStandalone
+	}
+	return elector.Role()
+}
@@ -300,3 +300,54 @@ func Test_writeMetric(t *testing.T) {
 		})
 	}
 }
+
+func Test_parseFilter(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantPrefix string
+		wantRegex  string
+		wantErr    error
+	}{
+		{
+			name:       "prefix_and_regex",
+			body:       `{"prefix": "Heap", "regex": "Alloc$"}`,
+			wantPrefix: "Heap",
+			wantRegex:  "Alloc$",
+			wantErr:    nil,
+		},
+		{
+			name:    "invalid_type",
+			body:    `{"type": "histogram"}`,
+			wantErr: common.ErrInvalidMetricType,
+		},
+		{
+			name:    "invalid_regex",
+			body:    `{"regex": "(("}`,
+			wantErr: ErrInvalidFilter,
+		},
+		{
+			name:    "invalid_json",
+			body:    `{"prefix":`,
+			wantErr: ErrInvalidFilter,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("_", "/admin/delete/", bytes.NewBufferString(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := parseFilter(req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Error mismatch. got: %v, want: %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if got.Prefix != tt.wantPrefix || got.Regex == nil || got.Regex.String() != tt.wantRegex {
+				t.Errorf("parseFilter() = %v", got)
+			}
+		})
+	}
+}
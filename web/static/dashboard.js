@@ -0,0 +1,157 @@
+// Dashboard of the monitoring server: client-side search, auto-refresh of the
+// metric values and sparkline charts built from the metric history.
+(function () {
+    "use strict";
+
+    const refreshInterval = 10000;
+    // the history is requested only for a recent window, so the server doesn't send the whole raw tier
+    // and picks the rollup tier for the longer windows
+    const sparklineWindow = 15 * 60 * 1000;
+    const detailsWindow = 24 * 60 * 60 * 1000;
+    const search = document.getElementById("search");
+    const autoRefresh = document.getElementById("auto-refresh");
+    let selected = null;
+
+    function rows() {
+        return document.querySelectorAll("tr.metric");
+    }
+
+    function applySearch() {
+        const needle = search.value.trim().toLowerCase();
+        rows().forEach(function (row) {
+            row.hidden = needle !== "" && !row.dataset.id.toLowerCase().includes(needle);
+        });
+    }
+
+    function historyURL(row, span) {
+        const from = new Date(Date.now() - span).toISOString();
+        return "/api/history/" + encodeURIComponent(row.dataset.type) + "/" + encodeURIComponent(row.dataset.id) +
+            "?from=" + encodeURIComponent(from);
+    }
+
+    // the sparklines of all rows are loaded with a single request, narrowed by the search like the rows
+    function historiesURL(span) {
+        const from = new Date(Date.now() - span).toISOString();
+        let url = "/api/history?from=" + encodeURIComponent(from);
+        const needle = search.value.trim();
+        if (needle !== "") {
+            const escaped = needle.replace(/[.*+?^${}()|[\]\\]/g, "\\$&");
+            url += "&regex=" + encodeURIComponent("(?i)" + escaped);
+        }
+        return url;
+    }
+
+    function draw(svg, samples, width, height) {
+        svg.replaceChildren();
+        if (samples.length < 2) {
+            return null;
+        }
+        const values = samples.map(function (s) { return s.value; });
+        const min = Math.min.apply(null, values);
+        const max = Math.max.apply(null, values);
+        const span = max - min || 1;
+        const points = values.map(function (v, i) {
+            const x = i / (values.length - 1) * width;
+            const y = height - (v - min) / span * height;
+            return x.toFixed(2) + "," + y.toFixed(2);
+        });
+        const line = document.createElementNS("http://www.w3.org/2000/svg", "polyline");
+        line.setAttribute("points", points.join(" "));
+        svg.appendChild(line);
+        return {min: min, max: max};
+    }
+
+    function loadHistory(row, span) {
+        return fetch(historyURL(row, span))
+            .then(function (resp) { return resp.ok ? resp.json() : {samples: []}; })
+            .then(function (body) { return body.samples || []; })
+            .catch(function () { return []; });
+    }
+
+    function drawSparklines() {
+        fetch(historiesURL(sparklineWindow))
+            .then(function (resp) { return resp.ok ? resp.json() : {histories: []}; })
+            .catch(function () { return {histories: []}; })
+            .then(function (body) {
+                const byKey = {};
+                (body.histories || []).forEach(function (h) { byKey[h.type + "/" + h.id] = h.samples || []; });
+                rows().forEach(function (row) {
+                    if (!row.hidden) {
+                        const samples = byKey[row.dataset.type + "/" + row.dataset.id] || [];
+                        draw(row.querySelector(".sparkline"), samples, 100, 20);
+                    }
+                });
+            });
+    }
+
+    function showDetails(row) {
+        selected = row;
+        document.getElementById("details").hidden = false;
+        document.getElementById("details-title").textContent = row.dataset.id + " (" + row.dataset.type + ")";
+        loadHistory(row, detailsWindow).then(function (samples) {
+            const range = draw(document.getElementById("details-chart"), samples, 600, 200);
+            document.getElementById("details-min").textContent = range ? "min: " + range.min : "not enough data";
+            document.getElementById("details-max").textContent = range ? "max: " + range.max : "";
+        });
+    }
+
+    function fetchAll(cursor, acc) {
+        let url = "/api/metrics?limit=1000";
+        if (cursor) {
+            url += "&cursor=" + encodeURIComponent(cursor);
+        }
+        return fetch(url)
+            .then(function (resp) { return resp.json(); })
+            .then(function (body) {
+                acc = acc.concat(body.metrics || []);
+                return body.next_cursor ? fetchAll(body.next_cursor, acc) : acc;
+            });
+    }
+
+    function refresh() {
+        fetchAll("", []).then(function (metrics) {
+            const byKey = {};
+            metrics.forEach(function (m) { byKey[m.type + "/" + m.id] = m; });
+            rows().forEach(function (row) {
+                const m = byKey[row.dataset.type + "/" + row.dataset.id];
+                if (!m) {
+                    row.remove();
+                    return;
+                }
+                delete byKey[row.dataset.type + "/" + row.dataset.id];
+                row.querySelector(".value").textContent = m.type === "counter" ? m.delta : m.value;
+                row.querySelector(".updated").textContent = m.updated_at ? new Date(m.updated_at).toLocaleString() : "";
+                row.classList.toggle("stale", !!m.stale);
+            });
+            if (Object.keys(byKey).length > 0) {
+                // new metrics have appeared, the server renders the groups
+                window.location.reload();
+            } else {
+                drawSparklines();
+                if (selected && selected.isConnected) {
+                    showDetails(selected);
+                }
+            }
+        });
+    }
+
+    search.value = sessionStorage.getItem("search") || "";
+    applySearch();
+    let searchTimer = null;
+    search.addEventListener("input", function () {
+        sessionStorage.setItem("search", search.value);
+        applySearch();
+        // the rows shown by the search get their sparklines once the typing stops
+        clearTimeout(searchTimer);
+        searchTimer = setTimeout(drawSparklines, 300);
+    });
+    rows().forEach(function (row) {
+        row.addEventListener("click", function () { showDetails(row); });
+    });
+    drawSparklines();
+    setInterval(function () {
+        if (autoRefresh.checked) {
+            refresh();
+        }
+    }, refreshInterval);
+})();
@@ -0,0 +1,10 @@
+// Package web embeds the HTML templates and static assets of the monitoring server,
+// so that the server binary doesn't depend on the working directory it's launched from.
+package web
+
+import "embed"
+
+// Assets contains the HTML templates under template/ and the static files under static/.
+//
+//go:embed template static
+var Assets embed.FS